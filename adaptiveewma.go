@@ -0,0 +1,72 @@
+package streamstats
+
+import "math"
+
+const (
+	adaptiveEWMAThreshold  = 3.0 // the number of EW standard deviations that is a detected change
+	adaptiveEWMAStable     = 1.0 // the number of EW standard deviations that is a stable observation
+	adaptiveEWMARelaxation = 0.5 // the fraction of the excess lambda kept after each stable observation
+)
+
+// AdaptiveEWMA data structure for a "fast-slow" exponentially weighted moving average
+// that tracks the exponentially weighted mean and variance, and switches to a fast weighting when
+// an observation is more than 3 EW standard deviations from the mean to respond quickly to level shifts,
+// relaxing back toward the slow weighting by half the excess for each observation within 1 EW standard deviation
+// and keeping the current weighting in between, so the fast weighting persists until the mean catches up
+// the variance always uses the slow weighting so that a level shift does not inflate the variance
+// enough to hide itself from the change detection
+type AdaptiveEWMA struct {
+	m          float64 // the exponentially weighted mean
+	v          float64 // the exponentially weighted variance
+	lambda     float64 // the current weighting
+	baseLambda float64 // the slow weighting when stable
+	maxLambda  float64 // the fast weighting on a detected change
+}
+
+// NewAdaptiveEWMA initializes an AdaptiveEWMA with the given initial value, the slow weighting baseLambda
+// used when the stream is stable and the fast weighting maxLambda used on a detected change
+// baseLambda is bounded by 0 and 1 and maxLambda is bounded by baseLambda and 1
+func NewAdaptiveEWMA(initialValue, baseLambda, maxLambda float64) AdaptiveEWMA {
+	baseLambda = math.Min(math.Max(baseLambda, 0.0), 1.0)
+	maxLambda = math.Min(math.Max(maxLambda, baseLambda), 1.0)
+	return AdaptiveEWMA{
+		m:          initialValue,
+		lambda:     baseLambda,
+		baseLambda: baseLambda,
+		maxLambda:  maxLambda,
+	}
+}
+
+// Add updates the average value and variance, first adapting the weighting to how far x is from the average
+func (e *AdaptiveEWMA) Add(x float64) {
+	diff := x - e.m
+	sd := math.Sqrt(e.v)
+	switch {
+	case diff == 0.0 || math.Abs(diff) <= adaptiveEWMAStable*sd:
+		e.lambda = e.baseLambda + adaptiveEWMARelaxation*(e.lambda-e.baseLambda)
+	case !(math.Abs(diff) <= adaptiveEWMAThreshold*sd): // also the first deviation from a zero variance
+		e.lambda = e.maxLambda
+	}
+	e.m += e.lambda * diff
+	e.v = (1 - e.baseLambda) * (e.v + e.baseLambda*diff*diff)
+}
+
+// Mean returns the exponentially weighted average value
+func (e *AdaptiveEWMA) Mean() float64 {
+	return e.m
+}
+
+// Variance returns the exponentially weighted variance with the slow weighting
+func (e *AdaptiveEWMA) Variance() float64 {
+	return e.v
+}
+
+// StdDev returns the exponentially weighted standard deviation
+func (e *AdaptiveEWMA) StdDev() float64 {
+	return math.Sqrt(e.v)
+}
+
+// Lambda returns the current weighting, between the slow and fast weighting
+func (e *AdaptiveEWMA) Lambda() float64 {
+	return e.lambda
+}
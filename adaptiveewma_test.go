@@ -0,0 +1,52 @@
+package streamstats
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNewAdaptiveEWMA(t *testing.T) {
+	e := NewAdaptiveEWMA(1.0, 0.1, 0.05)
+	if e.Mean() != 1.0 || e.Lambda() != 0.1 || e.maxLambda != 0.1 {
+		t.Errorf("Expected mean 1.0 and maxLambda bounded by baseLambda 0.1, got %v, %v and %v", e.Mean(), e.Lambda(), e.maxLambda)
+	}
+	e = NewAdaptiveEWMA(0.0, -1.0, 2.0)
+	if e.baseLambda != 0.0 || e.maxLambda != 1.0 {
+		t.Errorf("Expected lambdas bounded by 0 and 1, got %v and %v", e.baseLambda, e.maxLambda)
+	}
+}
+
+func TestAdaptiveEWMALevelShift(t *testing.T) {
+	base, max := 0.01, 0.5
+	adaptive := NewAdaptiveEWMA(0.0, base, max)
+	slow := NewEWMA(0.0, base)
+	for i := 0; i < N/2; i++ {
+		adaptive.Add(gaussianTestData[i])
+		slow.Add(gaussianTestData[i])
+	}
+	// stable observations relax the weighting back toward the slow weighting
+	if adaptive.Lambda() > 2*base {
+		t.Errorf("Expected a stable stream to use the slow weighting %v, got %v", base, adaptive.Lambda())
+	}
+	if math.Abs(adaptive.StdDev()-1.0) > 0.3 {
+		t.Errorf("Expected the EW standard deviation near 1.0, got %v", adaptive.StdDev())
+	}
+	// a level shift of 10 standard deviations switches to the fast weighting
+	shift := 10.0
+	for i := N / 2; i < N/2+10; i++ {
+		adaptive.Add(gaussianTestData[i] + shift)
+		slow.Add(gaussianTestData[i] + shift)
+	}
+	if math.Abs(adaptive.Mean()-shift) > 1.5 {
+		t.Errorf("Expected the adaptive mean to follow the shift to %v, got %v", shift, adaptive.Mean())
+	}
+	if math.Abs(slow.Mean()-shift) < shift/2 {
+		t.Errorf("Expected the slow mean to lag the shift, got %v", slow.Mean())
+	}
+	for i := N/2 + 10; i < N; i++ {
+		adaptive.Add(gaussianTestData[i] + shift)
+	}
+	if adaptive.Lambda() > 2*base {
+		t.Errorf("Expected the weighting to relax to %v after the shift, got %v", base, adaptive.Lambda())
+	}
+}
@@ -0,0 +1,106 @@
+package streamstats
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+// Aggregator collects observations from many goroutines into a single MomentStats without locking
+// the observations are sent over a buffered channel to one goroutine that owns the MomentStats
+// Push never blocks, an observation sent while the buffer is full or after Close is dropped and counted
+// by Dropped, so the buffer should be sized for the bursts of the producers
+type Aggregator struct {
+	values    chan float64          // observations waiting to be added
+	snapshots chan chan MomentStats // requests for a copy of the current stats
+	done      chan struct{}         // closed when the aggregating goroutine exits
+	final     MomentStats           // the stats after Close
+	dropped   uint64                // observations dropped because the buffer was full or closed, only accessed atomically
+	pushing   int64                 // the number of Push calls in progress, only accessed atomically
+	closed    uint32                // set to 1 by the first Close, only accessed atomically
+}
+
+// NewAggregator returns a new Aggregator buffering up to bufferSize observations
+// and starts the goroutine that aggregates them, Close must be called to stop it
+func NewAggregator(bufferSize int) *Aggregator {
+	a := &Aggregator{
+		values:    make(chan float64, bufferSize),
+		snapshots: make(chan chan MomentStats),
+		done:      make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+// run adds observations to the stats until the values channel is closed
+func (a *Aggregator) run() {
+	var m MomentStats
+	for {
+		select {
+		case x, ok := <-a.values:
+			if !ok {
+				a.final = m
+				close(a.done)
+				return
+			}
+			m.Add(x)
+		case reply := <-a.snapshots:
+			// drain the buffer so the snapshot includes everything added before the request
+			for n := len(a.values); n > 0; n-- {
+				if x, ok := <-a.values; ok {
+					m.Add(x)
+				}
+			}
+			reply <- m
+		}
+	}
+}
+
+// Push sends an observation to be aggregated without blocking, if the buffer is full or the Aggregator
+// is closed the observation is dropped and counted instead, so producers may race Close
+func (a *Aggregator) Push(x float64) {
+	// Close sets closed before waiting for the Push calls in progress, so a Push either sees closed
+	// or is waited for before the values channel is closed
+	atomic.AddInt64(&a.pushing, 1)
+	defer atomic.AddInt64(&a.pushing, -1)
+	if atomic.LoadUint32(&a.closed) == 1 {
+		atomic.AddUint64(&a.dropped, 1)
+		return
+	}
+	select {
+	case a.values <- x:
+	default:
+		atomic.AddUint64(&a.dropped, 1)
+	}
+}
+
+// Add is an alias of Push
+func (a *Aggregator) Add(x float64) {
+	a.Push(x)
+}
+
+// Dropped returns the number of observations dropped by Push because the buffer was full or closed
+func (a *Aggregator) Dropped() uint64 {
+	return atomic.LoadUint64(&a.dropped)
+}
+
+// Snapshot returns a copy of the stats including all observations added before the call
+func (a *Aggregator) Snapshot() MomentStats {
+	reply := make(chan MomentStats)
+	select {
+	case a.snapshots <- reply:
+		return <-reply
+	case <-a.done:
+		return a.final
+	}
+}
+
+// Close stops the aggregating goroutine after adding all buffered observations, calling it again has no effect
+func (a *Aggregator) Close() {
+	if atomic.CompareAndSwapUint32(&a.closed, 0, 1) {
+		for atomic.LoadInt64(&a.pushing) != 0 {
+			runtime.Gosched()
+		}
+		close(a.values)
+	}
+	<-a.done
+}
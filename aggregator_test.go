@@ -0,0 +1,115 @@
+package streamstats
+
+import (
+	"math"
+	"sync"
+	"testing"
+)
+
+func TestAggregator(t *testing.T) {
+	a := NewAggregator(N + 2) // large enough that no observations are dropped
+	expected := NewMomentStats()
+	for i := 0; i < N; i++ {
+		expected.Add(gaussianTestData[i])
+	}
+	workers := 8
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < N; i += workers {
+				a.Push(gaussianTestData[i])
+			}
+		}(w)
+	}
+	wg.Wait()
+	m := a.Snapshot()
+	if a.Dropped() != 0 {
+		t.Errorf("Expected no dropped observations, got %d", a.Dropped())
+	}
+	if m.N() != expected.N() {
+		t.Errorf("Expected N %d, got %d", expected.N(), m.N())
+	}
+	// the order of observations differs so only expect agreement to rounding error
+	eps := 1e-9
+	if math.Abs(m.Mean()-expected.Mean()) > eps {
+		t.Errorf("Expected Mean %v, got %v", expected.Mean(), m.Mean())
+	}
+	if math.Abs(m.Variance()-expected.Variance()) > eps {
+		t.Errorf("Expected Variance %v, got %v", expected.Variance(), m.Variance())
+	}
+
+	// a snapshot includes everything added before it from the same goroutine
+	a.Push(1000.0)
+	m = a.Snapshot()
+	if m.N() != expected.N()+1 {
+		t.Errorf("Expected N %d, got %d", expected.N()+1, m.N())
+	}
+
+	// after closing the final stats are still available
+	a.Push(-1000.0)
+	a.Close()
+	m = a.Snapshot()
+	if m.N() != expected.N()+2 {
+		t.Errorf("Expected N %d after Close, got %d", expected.N()+2, m.N())
+	}
+}
+
+func TestAggregatorDropped(t *testing.T) {
+	// a small buffer drops observations instead of blocking the producers
+	a := NewAggregator(1)
+	workers := 8
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < N; i += workers {
+				a.Push(gaussianTestData[i])
+			}
+		}(w)
+	}
+	wg.Wait()
+	a.Close()
+	if m := a.Snapshot(); m.N()+a.Dropped() != N {
+		t.Errorf("Expected %d observations added or dropped, got %d added and %d dropped", N, m.N(), a.Dropped())
+	}
+}
+
+func TestAggregatorClose(t *testing.T) {
+	// producers racing Close have their observations dropped instead of panicking
+	a := NewAggregator(64)
+	workers := 8
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < N; i += workers {
+				a.Push(gaussianTestData[i])
+			}
+		}(w)
+	}
+	a.Close()
+	wg.Wait()
+	a.Close() // a second Close has no effect
+	a.Add(1.0)
+	if m := a.Snapshot(); m.N()+a.Dropped() != N+1 {
+		t.Errorf("Expected %d observations added or dropped, got %d added and %d dropped", N+1, m.N(), a.Dropped())
+	}
+}
+
+func BenchmarkAggregatorPush(b *testing.B) {
+	a := NewAggregator(1024)
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			a.Push(gaussianTestData[i&mask])
+			i++
+		}
+	})
+	a.Close()
+	m := a.Snapshot()
+	result = m.Mean() // to avoid optimizing out the loop entirely
+}
@@ -1,6 +1,9 @@
 package streamstats
 
-import "strconv"
+import (
+	"strconv"
+	"sync/atomic"
+)
 
 // BitVector represents an arbitrary length vector of bits backed by 64-bit words
 // it is used as the data structure backing the Bloom Filter and Linear Counting implementations
@@ -9,7 +12,18 @@ type BitVector []uint64
 // NewBitVector returns a new BitVector of length L
 func NewBitVector(L uint64) BitVector {
 	// length of backing slice is # of 64-bit words, lower 6 bits index index inside the word
-	return BitVector(make([]uint64, 1+((L-1)>>6), 1+((L-1)>>6)))
+	return BitVector(make([]uint64, bitVectorWords(L), bitVectorWords(L)))
+}
+
+// BitVectorFromWords returns a BitVector backed by the given 64-bit words without copying
+// e.g. to wrap memory mapped from a file, changes to the BitVector are visible in the words
+func BitVectorFromWords(words []uint64) BitVector {
+	return BitVector(words)
+}
+
+// bitVectorWords returns the number of 64-bit words backing a BitVector of length L
+func bitVectorWords(L uint64) uint64 {
+	return 1 + ((L - 1) >> 6)
 }
 
 // Set sets the bit at position N
@@ -24,12 +38,68 @@ func (b BitVector) Get(N uint64) uint64 {
 	return (b[N>>6] >> (N & 63)) & 1
 }
 
+// SetAtomic sets the bit at position N with an atomic OR of its word, so concurrent calls and GetAtomic do not race
+// and no concurrently set bit in the same word is lost, e.g. for a filter shared by many goroutines without a mutex
+// like all of sync/atomic it is sequentially consistent, a GetAtomic that observes the bit happens after the SetAtomic
+// mixing atomic and non-atomic access of the same words, e.g. Set or PopCount, concurrently is a data race
+// for N >= L this will access memory out of bounds of the backing array and panic
+func (b BitVector) SetAtomic(N uint64) {
+	atomic.OrUint64(&b[N>>6], 1<<(N&63))
+}
+
+// GetAtomic returns the bit at position N as a uint64 with an atomic load of its word
+// it may or may not observe a concurrent SetAtomic of the bit, but observes every SetAtomic that happened before it
+// for N >= L this will access memory out of bounds of the backing array and panic
+func (b BitVector) GetAtomic(N uint64) uint64 {
+	return (atomic.LoadUint64(&b[N>>6]) >> (N & 63)) & 1
+}
+
 // Clear clears the bit at position N
 // for N >= L this will access memory out of bounds of the backing array and panic
 func (b BitVector) Clear(N uint64) {
 	b[N>>6] = b[N>>6] &^ (1 << (N & 63))
 }
 
+// Resize returns the BitVector resized to length L preserving the bits below L, like the builtin append
+// the result may share the backing array of b so it should be assigned back, b = b.Resize(L)
+// growing adds cleared bits and shrinking truncates, clearing any bits at positions L and above, L must be at least 1
+func (b BitVector) Resize(L uint64) BitVector {
+	words := bitVectorWords(L)
+	if words > uint64(cap(b)) {
+		resized := NewBitVector(L)
+		copy(resized, b)
+		return resized
+	}
+	n := uint64(len(b))
+	b = b[:words]
+	for i := n; i < words; i++ {
+		b[i] = 0 // clear any words left over from a previous shrink
+	}
+	if rem := L & 63; rem != 0 {
+		b[words-1] &= 1<<rem - 1 // truncate the bits in the last word
+	}
+	return b
+}
+
+// Append returns the concatenation of b and other with the bits of other starting at position 64*len(b)
+// since a BitVector is a whole number of words, like the builtin append the result may share the backing array of b
+func (b BitVector) Append(other BitVector) BitVector {
+	return append(b, other...)
+}
+
+// Equal returns true if both BitVector have the same length in words and the same bits set
+func (b BitVector) Equal(other BitVector) bool {
+	if len(b) != len(other) {
+		return false
+	}
+	for i, word := range b {
+		if word != other[i] {
+			return false
+		}
+	}
+	return true
+}
+
 // String outputs a string representation of the binary string with the first bit at the left
 // note that any padding zeros are present on the right hand side
 func (b BitVector) String() string {
@@ -53,13 +123,18 @@ func (b BitVector) String() string {
 func (b BitVector) PopCount() uint64 {
 	var total uint64
 	for _, word := range b {
-		word = word - ((word) >> 1 & 0x5555555555555555)
-		word = (word & 0x3333333333333333) + ((word >> 2) & 0x3333333333333333)
-		word = (word + (word >> 4)) & 0x0F0F0F0F0F0F0F0F
-		word += (word >> 8)
-		word += (word >> 16)
-		word += (word >> 32)
-		total += word & 255
+		total += popCount64(word)
 	}
 	return total
 }
+
+// popCount64 returns the number of set bits in a single 64-bit word
+func popCount64(word uint64) uint64 {
+	word = word - ((word) >> 1 & 0x5555555555555555)
+	word = (word & 0x3333333333333333) + ((word >> 2) & 0x3333333333333333)
+	word = (word + (word >> 4)) & 0x0F0F0F0F0F0F0F0F
+	word += (word >> 8)
+	word += (word >> 16)
+	word += (word >> 32)
+	return word & 255
+}
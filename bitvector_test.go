@@ -1,6 +1,9 @@
 package streamstats
 
-import "testing"
+import (
+	"sync"
+	"testing"
+)
 
 func TestNewBitVector(t *testing.T) {
 	var L uint64
@@ -47,6 +50,22 @@ func TestBitVectorPopCount(t *testing.T) {
 	}
 }
 
+func TestBitVectorEqual(t *testing.T) {
+	a := NewBitVector(100)
+	b := NewBitVector(100)
+	a.Set(77)
+	if a.Equal(b) {
+		t.Errorf("Expected BitVector with different bits not to be equal")
+	}
+	b.Set(77)
+	if !a.Equal(b) {
+		t.Errorf("Expected BitVector with the same bits to be equal")
+	}
+	if a.Equal(NewBitVector(200)) {
+		t.Errorf("Expected BitVector of different lengths not to be equal")
+	}
+}
+
 func TestBitVectorString(t *testing.T) {
 	var L uint64 = 88
 	bits := NewBitVector(L)
@@ -87,3 +106,114 @@ func TestBitVectorString(t *testing.T) {
 		t.Errorf("Expected bitstring:\n%s\nGot:\n%s", bits.String(), patternBitstring)
 	}
 }
+
+func TestBitVectorFromWords(t *testing.T) {
+	words := make([]uint64, 2)
+	bits := BitVectorFromWords(words)
+	bits.Set(3)
+	bits.Set(64)
+	if words[0] != 1<<3 || words[1] != 1 {
+		t.Errorf("Expected setting bits to write through to the words, got %0x %0x", words[0], words[1])
+	}
+	words[1] = 1 << 5
+	if bits.Get(69) != 1 {
+		t.Errorf("Expected changes to the words to be visible in the BitVector")
+	}
+}
+
+func TestBitVectorResize(t *testing.T) {
+	b := NewBitVector(100)
+	for i := uint64(0); i < 100; i += 3 {
+		b.Set(i)
+	}
+	grown := b.Resize(300)
+	if len(grown) != 5 {
+		t.Errorf("Expected 5 words, got %d", len(grown))
+	}
+	for i := uint64(0); i < 300; i++ {
+		expected := uint64(0)
+		if i < 100 && i%3 == 0 {
+			expected = 1
+		}
+		if grown.Get(i) != expected {
+			t.Errorf("Expected bit %d to be %d after growing, got %d", i, expected, grown.Get(i))
+		}
+	}
+	shrunk := grown.Resize(70)
+	if len(shrunk) != 2 || shrunk.PopCount() != 24 {
+		t.Errorf("Expected 24 bits set in 2 words after truncating to 70 bits, got %d in %d", shrunk.PopCount(), len(shrunk))
+	}
+	// growing within the capacity does not resurrect truncated bits
+	regrown := shrunk.Resize(300)
+	if regrown.PopCount() != 24 || regrown.Get(72) != 0 || regrown.Get(99) != 0 {
+		t.Errorf("Expected truncated bits to stay cleared, got %d bits set", regrown.PopCount())
+	}
+}
+
+func TestBitVectorAppend(t *testing.T) {
+	a := NewBitVector(64)
+	a.Set(1)
+	b := NewBitVector(128)
+	b.Set(0)
+	b.Set(127)
+	c := a.Append(b)
+	if len(c) != 3 || c.PopCount() != 3 {
+		t.Errorf("Expected 3 bits set in 3 words, got %d in %d", c.PopCount(), len(c))
+	}
+	for _, i := range []uint64{1, 64, 191} {
+		if c.Get(i) != 1 {
+			t.Errorf("Expected bit %d to be set, got %s", i, c)
+		}
+	}
+}
+
+func TestBitVectorSetAtomic(t *testing.T) {
+	b := NewBitVector(128)
+	var wg sync.WaitGroup
+	for i := uint64(0); i < 128; i++ {
+		wg.Add(1)
+		go func(i uint64) {
+			defer wg.Done()
+			b.SetAtomic(i)
+		}(i)
+	}
+	wg.Wait()
+	for i := uint64(0); i < 128; i++ {
+		if b.GetAtomic(i) != 1 {
+			t.Errorf("Expected bit %d to be set", i)
+		}
+	}
+}
+
+func TestBitVectorAtomicConcurrent(t *testing.T) {
+	// many goroutines setting interleaved bits of the same few words while others read them
+	L := uint64(256)
+	b := NewBitVector(L)
+	writers, readers := 8, 4
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w uint64) {
+			defer wg.Done()
+			for i := w; i < L; i += uint64(writers) {
+				b.SetAtomic(i)
+				if b.GetAtomic(i) != 1 {
+					t.Errorf("Expected bit %d to be set after SetAtomic", i)
+				}
+			}
+		}(uint64(w))
+	}
+	for r := 0; r < readers; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := uint64(0); i < L; i++ {
+				b.GetAtomic(i)
+			}
+		}()
+	}
+	wg.Wait()
+	if b.PopCount() != L {
+		t.Errorf("Expected all %d bits set without lost updates, got %d", L, b.PopCount())
+	}
+}
@@ -9,30 +9,88 @@ import (
 // BloomFilter is a datastructure for approximate set membership
 // with no false negatives and limited false positives
 type BloomFilter struct {
-	hash hash.Hash64 // the base hash function
-	bits BitVector   // the underlying occupied buckets
-	k    uint64      // number of hash functions to calculate for each item
-	m    uint64      // size of the BloomFilter in bits
+	hash        hash.Hash64 // the base hash function
+	bits        BitVector   // the underlying occupied buckets
+	k           uint64      // number of hash functions to calculate for each item
+	m           uint64      // size of the BloomFilter in bits
+	ignoreEmpty bool        // skip zero-length items in Add and reject them in Check
+	triangular  bool        // generate the hash functions as h_i = h1 + i * h2 + i * (i - 1) / 2
 }
 
 // NewBloomFilter returns a pointer to a new BloomFilter that has been sized in m
 // with k hash functions to target the given false positive rate
 // at the given number of items using the given hash function
 func NewBloomFilter(Nitems uint64, FalsePositiveRate float64, hash hash.Hash64) *BloomFilter {
-	var k, m, optM uint64
-	optM = uint64(-float64(Nitems) * math.Log(FalsePositiveRate) / (math.Ln2 * math.Ln2))
+	m, k := bloomFilterSize(Nitems, FalsePositiveRate)
+	bits := NewBitVector(m)
+	return &BloomFilter{hash: hash, bits: bits, k: k, m: m}
+}
+
+// NewBloomFilterTriangular returns a pointer to a new BloomFilter sized the same as NewBloomFilter that generates
+// the k hash functions with triangular double hashing h_i = h1 + i * h2 + i * (i - 1) / 2 mod m instead of h1 + i * h2
+// with a power of two m the k bits of an item all agree in their lowest j bits when h2 is divisible by 2^j,
+// e.g. the k bits of an item with an even h2 all have the same parity, which the added triangular term breaks
+// BloomFilters of the two schemes can not be combined with Union or Intersect
+func NewBloomFilterTriangular(Nitems uint64, FalsePositiveRate float64, hash hash.Hash64) *BloomFilter {
+	bf := NewBloomFilter(Nitems, FalsePositiveRate, hash)
+	bf.triangular = true
+	return bf
+}
+
+// NewBloomFilterWithBits returns a pointer to a new BloomFilter sized the same as NewBloomFilter
+// that uses the given pre-allocated words as its bits without copying, e.g. memory mapped from a file
+// the number of words must match the size m of the filter, ceil(m/64)
+func NewBloomFilterWithBits(Nitems uint64, FalsePositiveRate float64, hash hash.Hash64, words []uint64) (*BloomFilter, error) {
+	m, k := bloomFilterSize(Nitems, FalsePositiveRate)
+	if uint64(len(words)) != bitVectorWords(m) {
+		return nil, fmt.Errorf("BloomFilter of size m = %d requires %d words, got %d", m, bitVectorWords(m), len(words))
+	}
+	return &BloomFilter{hash: hash, bits: BitVectorFromWords(words), k: k, m: m}, nil
+}
+
+// bloomFilterSize returns the size m and number of hash functions k used by NewBloomFilter
+func bloomFilterSize(Nitems uint64, FalsePositiveRate float64) (m, k uint64) {
+	optM := OptimalM(Nitems, FalsePositiveRate)
 	if optM > (1 << 32) {
 		m = 1 << 32 // maximum use is 32 bits of the 64 bit hash function
 	} else {
 		m = nextPowerOfTwo(optM)
 	}
-	bits := NewBitVector(m)
-	k = uint64(float64(m)*math.Ln2/float64(Nitems) + 0.5) // add 0.5 to round properly
-	return &BloomFilter{hash: hash, bits: bits, k: k, m: m}
+	k = OptimalK(m, Nitems)
+	return m, k
+}
+
+// OptimalM returns the optimal size m in bits of a BloomFilter holding n items
+// with the target false positive rate, m = -n * ln(fpr) / ln(2)^2
+// NewBloomFilter rounds this up to the next power of two, up to a maximum of 2^32
+func OptimalM(n uint64, fpr float64) uint64 {
+	return uint64(-float64(n) * math.Log(fpr) / (math.Ln2 * math.Ln2))
+}
+
+// OptimalK returns the optimal number of hash functions k for a BloomFilter of size m bits
+// holding n items, k = (m/n) * ln(2) rounded to the nearest integer
+func OptimalK(m, n uint64) uint64 {
+	return uint64(float64(m)*math.Ln2/float64(n) + 0.5) // add 0.5 to round properly
+}
+
+// ExpectedFPR returns the expected false positive rate of a BloomFilter of size m bits
+// with k hash functions after n distinct items have been added, (1 - exp(-k*n/m))^k
+func ExpectedFPR(m, k, n uint64) float64 {
+	return math.Pow(1-math.Exp(-float64(k)*float64(n)/float64(m)), float64(k))
+}
+
+// SetIgnoreEmpty sets whether Add skips zero-length items and Check rejects them, by default an empty item
+// is hashed like any other so it counts as one distinct item, the setting is kept by Union and Intersect
+func (bf *BloomFilter) SetIgnoreEmpty(ignore bool) {
+	bf.ignoreEmpty = ignore
 }
 
 // Add puts an item in the set represented by the BloomFilter
+// a zero-length item is added as a single item unless SetIgnoreEmpty is set
 func (bf *BloomFilter) Add(item []byte) {
+	if bf.ignoreEmpty && len(item) == 0 {
+		return
+	}
 	bf.hash.Reset()
 	bf.hash.Write(item)
 	hash := bf.hash.Sum64()
@@ -41,12 +99,18 @@ func (bf *BloomFilter) Add(item []byte) {
 	bf.bits.Set(h1 & (bf.m - 1))
 	for i := uint64(1); i < bf.k; i++ {
 		h1 += h2 // generate the k hash functions as h_i = h1 + i * h2 mod m
+		if bf.triangular {
+			h2++ // the step increases by one for each hash function adding i * (i - 1) / 2 in total
+		}
 		bf.bits.Set(h1 & (bf.m - 1))
 	}
 }
 
 // Check returns false if an item in is definitely not in the set represented by the BloomFilter
 func (bf BloomFilter) Check(item []byte) bool {
+	if bf.ignoreEmpty && len(item) == 0 {
+		return false
+	}
 	bf.hash.Reset()
 	bf.hash.Write(item)
 	hash := bf.hash.Sum64()
@@ -57,6 +121,9 @@ func (bf BloomFilter) Check(item []byte) bool {
 	}
 	for i := uint64(1); i < bf.k; i++ {
 		h1 += h2 // generate the k hash functions as h_i = h1 + i * h2 mod m
+		if bf.triangular {
+			h2++ // the step increases by one for each hash function adding i * (i - 1) / 2 in total
+		}
 		if bf.bits.Get(h1&(bf.m-1)) != 1 {
 			return false
 		}
@@ -64,6 +131,50 @@ func (bf BloomFilter) Check(item []byte) bool {
 	return true // all hash functions check out
 }
 
+// AddFloat64 puts a float64 value in the set represented by the BloomFilter
+// -0.0 and +0.0 are treated as the same value and all NaNs are treated as a single value
+func (bf *BloomFilter) AddFloat64(x float64) {
+	bf.Add(float64Bytes(x))
+}
+
+// CheckFloat64 returns false if a float64 value is definitely not in the set represented by the BloomFilter
+// using the same canonical -0.0 and NaN handling as AddFloat64
+func (bf BloomFilter) CheckFloat64(x float64) bool {
+	return bf.Check(float64Bytes(x))
+}
+
+// MayContainAll returns false if any of the items is definitely not in the set represented by the BloomFilter
+// it returns true for an empty list of items
+func (bf BloomFilter) MayContainAll(items [][]byte) bool {
+	for _, item := range items {
+		if !bf.Check(item) {
+			return false
+		}
+	}
+	return true
+}
+
+// MayContainAny returns false if all of the items are definitely not in the set represented by the BloomFilter
+// it returns false for an empty list of items
+func (bf BloomFilter) MayContainAny(items [][]byte) bool {
+	for _, item := range items {
+		if bf.Check(item) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckBatch returns the result of Check for each of the items in the same order,
+// false if an item is definitely not in the set represented by the BloomFilter
+func (bf BloomFilter) CheckBatch(items [][]byte) []bool {
+	results := make([]bool, len(items), len(items))
+	for i, item := range items {
+		results[i] = bf.Check(item)
+	}
+	return results
+}
+
 // Occupancy returns the ratio of filled buckets in the BloomFilter
 func (bf BloomFilter) Occupancy() float64 {
 	return float64(bf.bits.PopCount()) / float64(bf.m)
@@ -77,29 +188,35 @@ func (bf BloomFilter) FalsePositiveRate() float64 {
 // Distinct estimates the number of elements in the filter by using the LinearCounting estimate accounting for the
 // k hash functions calculated for each element
 func (bf BloomFilter) Distinct() uint64 {
-	return uint64(-(float64(bf.m) / float64(bf.k)) * math.Log(1-bf.Occupancy()))
+	return bf.distinctFromPopCount(bf.bits.PopCount())
+}
+
+// Cardinality is an alias of Distinct, the name used by most other cardinality estimation libraries
+func (bf BloomFilter) Cardinality() uint64 {
+	return bf.Distinct()
+}
+
+// ExpectedError returns the expected relative error of the Distinct estimate at the current filling of the BloomFilter
+// the LinearCounting error of the m buckets with each item setting k buckets, or 0 for an empty BloomFilter
+func (bf BloomFilter) ExpectedError() float64 {
+	return linearCountingErrorAt(bf.Occupancy(), float64(bf.m)/float64(bf.k))
+}
+
+// String returns the estimated number of distinct items and its expected error
+func (bf BloomFilter) String() string {
+	N := bf.Distinct()
+	delta := uint64(float64(N) * bf.ExpectedError())
+	return fmt.Sprintf("BloomFilter N: %d +/- %d", N, delta)
 }
 
 // Union combines two BloomFilters producing one that contains all of the elements in either BloomFilter
 // the BloomFilters must be the same size m and k as well as use the same hash function
+// the result is identical to a BloomFilter built from both sets of items, so it has no false negatives
+// for any item added to either BloomFilter and the false positive rate of the combined number of items
 func (bf BloomFilter) Union(bfB *BloomFilter) (*BloomFilter, error) {
 
-	if bf.m != bfB.m {
-		return nil, fmt.Errorf("BloomFilters do not have equal size m1 = %d != %d = m2", bf.m, bfB.m)
-	}
-	if bf.k != bfB.k {
-		return nil, fmt.Errorf("BloomFilters do not have equal nubmer of hash functions k1 = %d != %d = k2", bf.k, bfB.k)
-	}
-
-	// check that both hash functions get the same result for "BloomFilter"
-	bf.hash.Reset()
-	bf.hash.Write([]byte("BloomFilter"))
-	hash := bf.hash.Sum64()
-	bfB.hash.Reset()
-	bfB.hash.Write([]byte("BloomFilter"))
-	hashB := bfB.hash.Sum64()
-	if hash != hashB {
-		return nil, fmt.Errorf("Hash functions are not identical, return %0x != %0x for \"BloomFilter\"", hash, hashB)
+	if err := bf.compatible(bfB); err != nil {
+		return nil, err
 	}
 
 	bits := NewBitVector(bf.m)
@@ -107,29 +224,24 @@ func (bf BloomFilter) Union(bfB *BloomFilter) (*BloomFilter, error) {
 		bits[i] = bf.bits[i] | bfB.bits[i]
 	}
 
-	return &BloomFilter{hash: bf.hash, bits: bits, m: bf.m, k: bf.k}, nil
+	return &BloomFilter{hash: bf.hash, bits: bits, m: bf.m, k: bf.k, ignoreEmpty: bf.ignoreEmpty, triangular: bf.triangular}, nil
+}
+
+// Combine is an alias of Union
+func (bf BloomFilter) Combine(bfB *BloomFilter) (*BloomFilter, error) {
+	return bf.Union(bfB)
 }
 
 // Intersect combines two BloomFilters producing one that contains only of the elements in both BloomFilters
 // the BloomFilters must be the same size m and k as well as use the same hash function
+// the result has no false negatives for items added to both BloomFilters, but an item added to only one
+// BloomFilter is not guaranteed to be rejected, the false positive rate is at least that of a BloomFilter
+// built directly from the intersection and at most that of either input, so Check on an item from only one
+// set should be treated as a possible false positive
 func (bf BloomFilter) Intersect(bfB *BloomFilter) (*BloomFilter, error) {
 
-	if bf.m != bfB.m {
-		return nil, fmt.Errorf("BloomFilters do not have equal size m1 = %d != %d = m2", bf.m, bfB.m)
-	}
-	if bf.k != bfB.k {
-		return nil, fmt.Errorf("BloomFilters do not have equal nubmer of hash functions k1 = %d != %d = k2", bf.k, bfB.k)
-	}
-
-	// check that both hash functions get the same result for "BloomFilter"
-	bf.hash.Reset()
-	bf.hash.Write([]byte("BloomFilter"))
-	hash := bf.hash.Sum64()
-	bfB.hash.Reset()
-	bfB.hash.Write([]byte("BloomFilter"))
-	hashB := bfB.hash.Sum64()
-	if hash != hashB {
-		return nil, fmt.Errorf("Hash functions are not identical, return %d != %d for \"BloomFilter\"", hash, hashB)
+	if err := bf.compatible(bfB); err != nil {
+		return nil, err
 	}
 
 	bits := NewBitVector(bf.m)
@@ -137,7 +249,57 @@ func (bf BloomFilter) Intersect(bfB *BloomFilter) (*BloomFilter, error) {
 		bits[i] = bf.bits[i] & bfB.bits[i]
 	}
 
-	return &BloomFilter{hash: bf.hash, bits: bits, m: bf.m, k: bf.k}, nil
+	return &BloomFilter{hash: bf.hash, bits: bits, m: bf.m, k: bf.k, ignoreEmpty: bf.ignoreEmpty, triangular: bf.triangular}, nil
+}
+
+// UnionCardinality returns the estimated number of distinct items in the Union of two BloomFilters
+// without allocating the combined BloomFilter, it is equal to the Distinct of the Union
+func (bf BloomFilter) UnionCardinality(bfB *BloomFilter) (uint64, error) {
+	if err := bf.compatible(bfB); err != nil {
+		return 0, err
+	}
+	var popCount uint64
+	for i := range bf.bits {
+		popCount += popCount64(bf.bits[i] | bfB.bits[i])
+	}
+	return bf.distinctFromPopCount(popCount), nil
+}
+
+// IntersectCardinality returns the estimated number of distinct items in the Intersect of two BloomFilters
+// without allocating the combined BloomFilter, it is equal to the Distinct of the Intersect
+// and so overestimates the intersection by the false positives of the combined filter
+func (bf BloomFilter) IntersectCardinality(bfB *BloomFilter) (uint64, error) {
+	if err := bf.compatible(bfB); err != nil {
+		return 0, err
+	}
+	var popCount uint64
+	for i := range bf.bits {
+		popCount += popCount64(bf.bits[i] & bfB.bits[i])
+	}
+	return bf.distinctFromPopCount(popCount), nil
+}
+
+// distinctFromPopCount returns the LinearCounting estimate for the given number of set bits
+// accounting for the k hash functions calculated for each element
+func (bf BloomFilter) distinctFromPopCount(popCount uint64) uint64 {
+	occupancy := float64(popCount) / float64(bf.m)
+	return roundEstimate(-(float64(bf.m) / float64(bf.k)) * math.Log(1-occupancy))
+}
+
+// compatible returns an error if the BloomFilters can not be combined
+// the BloomFilters must be the same size m and k as well as use the same hash function and double hashing scheme
+func (bf BloomFilter) compatible(bfB *BloomFilter) error {
+	if bf.m != bfB.m {
+		return fmt.Errorf("BloomFilters do not have equal size m1 = %d != %d = m2", bf.m, bfB.m)
+	}
+	if bf.k != bfB.k {
+		return fmt.Errorf("BloomFilters do not have equal nubmer of hash functions k1 = %d != %d = k2", bf.k, bfB.k)
+	}
+	if bf.triangular != bfB.triangular {
+		return fmt.Errorf("BloomFilters do not use the same double hashing scheme")
+	}
+
+	return sameHash(bf.hash, bfB.hash, "BloomFilter")
 }
 
 // nextPowerOfTwo returns the next greater power of two for a given input
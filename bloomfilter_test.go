@@ -1,9 +1,9 @@
 package streamstats
 
 import (
+	"hash"
 	"hash/fnv"
 	"math"
-	"math/rand"
 	"testing"
 )
 
@@ -18,6 +18,9 @@ func TestBloomFilter(t *testing.T) {
 	expectedK = 7    // (m/maxItems) * ln(2)
 
 	bf := NewBloomFilter(maxItems, targetFalsePositiveRate, fnv.New64())
+	if bf.ExpectedError() != 0.0 {
+		t.Errorf("Expected zero error for an empty BloomFilter, got %f", bf.ExpectedError())
+	}
 	if bf.m != expectedM {
 		t.Errorf("Expected m to be %d, got %d\n", expectedM, bf.m)
 	}
@@ -25,16 +28,16 @@ func TestBloomFilter(t *testing.T) {
 		t.Errorf("Expected k to be %d, got %d\n", expectedK, bf.k)
 	}
 
-	rand.Seed(42) // fill the BloomFilter to the expected number of items
+	testRand.Seed(42) // fill the BloomFilter to the expected number of items
 	for i := uint64(0); i < maxItems; i++ {
 		b := make([]byte, 8)
-		rand.Read(b)
+		testRand.Read(b)
 		bf.Add(b)
 	}
-	rand.Seed(42) // reset and check that all of those elements are in the BloomFilter
+	testRand.Seed(42) // reset and check that all of those elements are in the BloomFilter
 	for i := uint64(0); i < maxItems; i++ {
 		b := make([]byte, 8)
-		rand.Read(b)
+		testRand.Read(b)
 		if bf.Check(b) != true {
 			t.Errorf("Expected element %d with seed 42 to be in the filter", i)
 		}
@@ -44,7 +47,7 @@ func TestBloomFilter(t *testing.T) {
 	samples = 1000
 	for i := uint64(0); i < samples; i++ {
 		b := make([]byte, 8)
-		rand.Read(b)
+		testRand.Read(b)
 		if bf.Check(b) {
 			falsePositives++
 		}
@@ -58,8 +61,7 @@ func TestBloomFilter(t *testing.T) {
 		t.Errorf("Measured false positive rate %f using %d samples exceeds expected false positive rate %f", measuredFPR, samples, expectedFalsePositiveRate)
 	}
 	estimatedItems := bf.Distinct()
-	loadFactor := bf.Occupancy()
-	expectedError := 2 * math.Sqrt((math.Exp(loadFactor)-loadFactor-1)*float64(bf.k)/float64(bf.m)) / loadFactor
+	expectedError := bf.ExpectedError()
 	actualError := math.Abs(float64(estimatedItems)-float64(maxItems)) / float64(maxItems)
 	if actualError > expectedError {
 		t.Errorf("Expected cardinality %d, got %d\n", maxItems, estimatedItems)
@@ -86,16 +88,16 @@ func TestBloomFilterCombine(t *testing.T) {
 	bfC := NewBloomFilter(maxItems, targetFalsePositiveRate, fnv.New64()) // the Union
 	bfD := NewBloomFilter(maxItems, targetFalsePositiveRate, fnv.New64()) // the Intersection
 
-	rand.Seed(42)                             // fill the BloomFilters with the first third in A & C
+	testRand.Seed(42)                         // fill the BloomFilters with the first third in A & C
 	for i := uint64(0); i < maxItems/3; i++ { // fill the BloomFilters with the first third in A & C
 		b := make([]byte, 8)
-		rand.Read(b)
+		testRand.Read(b)
 		bfA.Add(b)
 		bfC.Add(b)
 	}
 	for i := uint64(0); i < maxItems/3; i++ { // fill the BloomFilters with the middle third in A, B, C & D
 		b := make([]byte, 8)
-		rand.Read(b)
+		testRand.Read(b)
 		bfA.Add(b)
 		bfB.Add(b)
 		bfC.Add(b)
@@ -103,7 +105,7 @@ func TestBloomFilterCombine(t *testing.T) {
 	}
 	for i := uint64(0); i < maxItems/3; i++ { // fill the BloomFilters with the last third in B & C
 		b := make([]byte, 8)
-		rand.Read(b)
+		testRand.Read(b)
 		bfB.Add(b)
 		bfC.Add(b)
 	}
@@ -123,10 +125,10 @@ func TestBloomFilterCombine(t *testing.T) {
 
 	var AFalsePositives, BFalsePositives, DFalsePositives, IntersectFalsePositives uint64 // false positive rates for each filter
 
-	rand.Seed(42)                             // reset and check that all of those elements are in the BloomFilters
+	testRand.Seed(42)                         // reset and check that all of those elements are in the BloomFilters
 	for i := uint64(0); i < maxItems/3; i++ { // the initial third
 		b := make([]byte, 8)
-		rand.Read(b)
+		testRand.Read(b)
 		if bfA.Check(b) != true {
 			t.Errorf("Expected element %d with seed 42 to be in the filter A", i)
 		}
@@ -148,7 +150,7 @@ func TestBloomFilterCombine(t *testing.T) {
 	}
 	for i := uint64(0); i < maxItems/3; i++ { // the middle third
 		b := make([]byte, 8)
-		rand.Read(b)
+		testRand.Read(b)
 		if bfA.Check(b) != true {
 			t.Errorf("Expected element %d with seed 42 to be in the filter A", i)
 		}
@@ -170,7 +172,7 @@ func TestBloomFilterCombine(t *testing.T) {
 	}
 	for i := uint64(0); i < maxItems/3; i++ { // the final third
 		b := make([]byte, 8)
-		rand.Read(b)
+		testRand.Read(b)
 		if bfA.Check(b) != false {
 			AFalsePositives++
 		}
@@ -202,6 +204,20 @@ func TestBloomFilterCombine(t *testing.T) {
 	if IntersectFalsePositives < DFalsePositives {
 		t.Errorf("Intersect Filter had lass false positives %d than the individual filter D: %d", IntersectFalsePositives, DFalsePositives)
 	}
+	unionCardinality, err := bfA.UnionCardinality(bfB)
+	if err != nil {
+		t.Errorf("BloomFilter UnionCardinality failed: %s", err)
+	}
+	if unionCardinality != bfUnion.Distinct() {
+		t.Errorf("Expected UnionCardinality to equal the Union Distinct %d, got %d", bfUnion.Distinct(), unionCardinality)
+	}
+	intersectCardinality, err := bfA.IntersectCardinality(bfB)
+	if err != nil {
+		t.Errorf("BloomFilter IntersectCardinality failed: %s", err)
+	}
+	if intersectCardinality != bfIntersect.Distinct() {
+		t.Errorf("Expected IntersectCardinality to equal the Intersect Distinct %d, got %d", bfIntersect.Distinct(), intersectCardinality)
+	}
 	// test different m, k and hash functions fail to Union and Intersect
 	bfB.hash = fnv.New64a()
 	bfC.m = 13
@@ -224,6 +240,255 @@ func TestBloomFilterCombine(t *testing.T) {
 	if _, err = bfA.Intersect(bfD); err == nil {
 		t.Errorf("Expected Intersect using two different k")
 	}
+	if _, err = bfA.UnionCardinality(bfB); err == nil {
+		t.Errorf("Expected UnionCardinality using two different hash functions to return error")
+	}
+	if _, err = bfA.IntersectCardinality(bfC); err == nil {
+		t.Errorf("Expected IntersectCardinality using two different m")
+	}
+}
+
+func TestBloomFilterMayContainAll(t *testing.T) {
+	maxItems := uint64(300)
+	bfA := NewBloomFilter(maxItems, 0.01, fnv.New64())
+	bfB := NewBloomFilter(maxItems, 0.01, fnv.New64())
+	if !bfA.MayContainAll(nil) {
+		t.Errorf("Expected an empty list of items to be contained in any filter")
+	}
+	onlyA := make([][]byte, maxItems/3)
+	both := make([][]byte, maxItems/3)
+	onlyB := make([][]byte, maxItems/3)
+	testRand.Seed(42)
+	for i := range both {
+		onlyA[i] = make([]byte, 8)
+		testRand.Read(onlyA[i])
+		both[i] = make([]byte, 8)
+		testRand.Read(both[i])
+		onlyB[i] = make([]byte, 8)
+		testRand.Read(onlyB[i])
+		bfA.Add(onlyA[i])
+		bfA.Add(both[i])
+		bfB.Add(both[i])
+		bfB.Add(onlyB[i])
+	}
+	if !bfA.MayContainAll(onlyA) || !bfA.MayContainAll(both) {
+		t.Errorf("Expected no false negatives for the items added to A")
+	}
+	if bfA.MayContainAll(onlyB) {
+		t.Errorf("Expected at least one item only in B to be rejected by A")
+	}
+	if bfA.MayContainAny(nil) || !bfA.MayContainAny(append([][]byte{onlyB[0]}, onlyA[0])) {
+		t.Errorf("Expected MayContainAny to be false for no items and true if one item was added")
+	}
+	items := append(append([][]byte{}, onlyA...), onlyB...)
+	checked := bfA.CheckBatch(items)
+	if len(checked) != len(items) {
+		t.Fatalf("Expected %d results, got %d", len(items), len(checked))
+	}
+	var rejected int
+	for i, present := range checked {
+		if present != bfA.Check(items[i]) {
+			t.Errorf("Expected CheckBatch result %d to equal Check %v", i, bfA.Check(items[i]))
+		}
+		if !present {
+			rejected++
+		}
+	}
+	if rejected == 0 {
+		t.Errorf("Expected CheckBatch to reject some items only in B")
+	}
+	// Union has no false negatives for items in either filter
+	bfUnion, err := bfA.Union(bfB)
+	if err != nil {
+		t.Errorf("BloomFilter Union failed: %s", err)
+	}
+	for _, items := range [][][]byte{onlyA, both, onlyB} {
+		if !bfUnion.MayContainAll(items) {
+			t.Errorf("Expected no false negatives in the Union for items added to either filter")
+		}
+	}
+	// Intersect has no false negatives for items in both filters, but gives no guarantee for the rest
+	bfIntersect, err := bfA.Intersect(bfB)
+	if err != nil {
+		t.Errorf("BloomFilter Intersect failed: %s", err)
+	}
+	if !bfIntersect.MayContainAll(both) {
+		t.Errorf("Expected no false negatives in the Intersect for items added to both filters")
+	}
+	if bfIntersect.MayContainAll(onlyA) || bfIntersect.MayContainAll(onlyB) {
+		t.Errorf("Expected at least one item in only one filter to be rejected by the Intersect")
+	}
+}
+
+func TestBloomFilterTriangular(t *testing.T) {
+	added := uint64(1700) // overfill the filter for a measurable false positive rate
+	for _, newBloomFilter := range []struct {
+		name string
+		new  func(Nitems uint64, FalsePositiveRate float64) *BloomFilter
+	}{
+		{"double", func(n uint64, fpr float64) *BloomFilter { return NewBloomFilter(n, fpr, fnv.New64()) }},
+		{"triangular", func(n uint64, fpr float64) *BloomFilter { return NewBloomFilterTriangular(n, fpr, fnv.New64()) }},
+	} {
+		bf := newBloomFilter.new(1000, 0.01)
+		for i := uint64(0); i < added; i++ {
+			bf.Add(randomBytes[i])
+		}
+		for i := uint64(0); i < added; i++ {
+			if !bf.Check(randomBytes[i]) {
+				t.Fatalf("Expected no false negatives with %s hashing, item %d was rejected", newBloomFilter.name, i)
+			}
+		}
+		var falsePositives int
+		for i := added; i < N; i++ {
+			if bf.Check(randomBytes[i]) {
+				falsePositives++
+			}
+		}
+		expected := ExpectedFPR(bf.m, bf.k, added)
+		if fpr := float64(falsePositives) / float64(uint64(N)-added); math.Abs(fpr-expected) > 0.25*expected {
+			t.Errorf("Expected a false positive rate of %v with %s hashing, got %v", expected, newBloomFilter.name, fpr)
+		}
+	}
+	// the k bits of an item with an even h2 do not all have the same parity
+	double := NewBloomFilter(1000, 0.01, fnv.New64())
+	triangular := NewBloomFilterTriangular(1000, 0.01, fnv.New64())
+	for i := 0; ; i++ {
+		fnv64 := fnv.New64()
+		fnv64.Write(randomBytes[i])
+		if h := fnv64.Sum64(); (h>>32)%2 == 0 {
+			double.Add(randomBytes[i])
+			triangular.Add(randomBytes[i])
+			break
+		}
+	}
+	parities := func(bf *BloomFilter) (even, odd uint64) {
+		for j := uint64(0); j < bf.m; j++ {
+			if bf.bits.Get(j) == 1 {
+				if j%2 == 0 {
+					even++
+				} else {
+					odd++
+				}
+			}
+		}
+		return even, odd
+	}
+	if even, odd := parities(double); even != 0 && odd != 0 {
+		t.Errorf("Expected the bits of double hashing with an even h2 to have the same parity, got %d even and %d odd", even, odd)
+	}
+	if even, odd := parities(triangular); even == 0 || odd == 0 {
+		t.Errorf("Expected the bits of triangular hashing to have both parities, got %d even and %d odd", even, odd)
+	}
+	if _, err := double.Union(triangular); err == nil {
+		t.Errorf("Expected an error for the Union of different double hashing schemes")
+	}
+	union, err := triangular.Union(triangular)
+	if err != nil || !union.triangular {
+		t.Errorf("Expected the Union to keep triangular hashing, got error %v", err)
+	}
+}
+
+// fixedHash is a hash that always returns the same value for pinning the bits set by an item
+type fixedHash struct {
+	hash.Hash64
+	sum uint64
+}
+
+func (h fixedHash) Sum64() uint64 {
+	return h.sum
+}
+
+func TestBloomFilterTriangularBits(t *testing.T) {
+	// h1 = 60 and h2 = 2 set the bits 60 + i * 2 + i * (i - 1) / 2 mod 64 for i = 0..5
+	h := fixedHash{Hash64: fnv.New64(), sum: 2<<32 | 60}
+	bf := &BloomFilter{hash: h, bits: NewBitVector(64), m: 64, k: 6, triangular: true}
+	bf.Add([]byte("item"))
+	expected := map[uint64]bool{60: true, 62: true, 1: true, 5: true, 10: true, 16: true}
+	for j := uint64(0); j < bf.m; j++ {
+		if set := bf.bits.Get(j) == 1; set != expected[j] {
+			t.Errorf("Expected bit %d set to be %v, got %v", j, expected[j], set)
+		}
+	}
+	if !bf.Check([]byte("item")) {
+		t.Errorf("Expected Check to find the item with the same bits")
+	}
+}
+
+func TestBloomFilterSizing(t *testing.T) {
+	var testCases = []struct {
+		n     uint64
+		fpr   float64
+		wantM uint64
+		wantK uint64
+	}{
+		{107, 0.0101, 1023, 7},
+		{1000, 0.01, 9585, 7},
+		{1000, 0.001, 14377, 10},
+		{10000, 0.05, 62352, 4},
+	}
+	for _, test := range testCases {
+		m := OptimalM(test.n, test.fpr)
+		if m != test.wantM {
+			t.Errorf("Expected OptimalM(%d, %f) = %d, got %d", test.n, test.fpr, test.wantM, m)
+		}
+		k := OptimalK(m, test.n)
+		if k != test.wantK {
+			t.Errorf("Expected OptimalK(%d, %d) = %d, got %d", m, test.n, test.wantK, k)
+		}
+		// at the optimal size the expected false positive rate should be close to the target
+		fpr := ExpectedFPR(m, k, test.n)
+		if math.Abs(fpr-test.fpr)/test.fpr > 0.1 {
+			t.Errorf("Expected ExpectedFPR(%d, %d, %d) ~ %f, got %f", m, k, test.n, test.fpr, fpr)
+		}
+	}
+
+	// the constructor should agree with the helpers
+	bf := NewBloomFilter(1000, 0.01, fnv.New64())
+	if bf.m != nextPowerOfTwo(OptimalM(1000, 0.01)) {
+		t.Errorf("Expected m to be %d, got %d", nextPowerOfTwo(OptimalM(1000, 0.01)), bf.m)
+	}
+	if bf.k != OptimalK(bf.m, 1000) {
+		t.Errorf("Expected k to be %d, got %d", OptimalK(bf.m, 1000), bf.k)
+	}
+	if ExpectedFPR(bf.m, bf.k, 0) != 0.0 {
+		t.Errorf("Expected an empty filter to have zero false positive rate, got %f", ExpectedFPR(bf.m, bf.k, 0))
+	}
+}
+
+func TestNewBloomFilterWithBits(t *testing.T) {
+	maxItems := uint64(1000)
+	fpr := 0.01
+	expected := NewBloomFilter(maxItems, fpr, fnv.New64())
+	words := make([]uint64, len(expected.bits))
+	bf, err := NewBloomFilterWithBits(maxItems, fpr, fnv.New64(), words)
+	if err != nil {
+		t.Fatalf("Expected BloomFilter with %d words, got %s", len(words), err)
+	}
+	if bf.m != expected.m || bf.k != expected.k {
+		t.Errorf("Expected m=%d k=%d, got m=%d k=%d", expected.m, expected.k, bf.m, bf.k)
+	}
+	for i := uint64(0); i < maxItems; i++ {
+		bf.Add(randomBytes[i])
+		expected.Add(randomBytes[i])
+	}
+	for i := range words {
+		if words[i] != expected.bits[i] {
+			t.Errorf("Expected word %d to be %0x, got %0x", i, expected.bits[i], words[i])
+		}
+	}
+	// reloading the same words recovers the same state
+	reloaded, err := NewBloomFilterWithBits(maxItems, fpr, fnv.New64(), words)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint64(0); i < maxItems; i++ {
+		if !reloaded.Check(randomBytes[i]) {
+			t.Errorf("Expected element %d to be in the reloaded filter", i)
+		}
+	}
+	if _, err = NewBloomFilterWithBits(maxItems, fpr, fnv.New64(), append(words, 0)); err == nil {
+		t.Errorf("Expected error for mismatched number of words")
+	}
 }
 
 func TestNextPowerOfTwo(t *testing.T) {
@@ -288,3 +553,97 @@ func BenchmarkBloomFilterCheck(b *testing.B) {
 		count = 5
 	} // to avoid optimizing out the loop entirely
 }
+
+func BenchmarkBloomFilterCheckBatch(b *testing.B) {
+	bf := NewBloomFilter(10000, 0.03, fnv.New64())
+	for i := 0; i < 10000; i++ {
+		bf.Add(randomBytes[i&mask])
+	}
+	items := randomBytes[:1024]
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i += len(items) {
+		if bf.CheckBatch(items)[0] {
+			count++
+		}
+	}
+}
+
+func BenchmarkBloomFilterUnionCardinality(b *testing.B) {
+	bfA := NewBloomFilter(1<<16, 0.01, fnv.New64())
+	bfB := NewBloomFilter(1<<16, 0.01, fnv.New64())
+	for i := 0; i < N; i++ {
+		bfA.Add(randomBytes[i])
+		bfB.Add(longRandomBytes[i])
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		count, _ = bfA.UnionCardinality(bfB)
+	}
+}
+
+func TestBloomFilterString(t *testing.T) {
+	a := NewBloomFilter(1000, 0.01, fnv.New64())
+	b := NewBloomFilter(1000, 0.01, fnv.New64())
+	if a.String() != "BloomFilter N: 0 +/- 0" {
+		t.Errorf("Expected an empty BloomFilter string, got %q", a.String())
+	}
+	for i := 0; i < 500; i++ {
+		a.Add(randomBytes[i])
+		b.Add(randomBytes[i])
+	}
+	if a.String() != b.String() {
+		t.Errorf("Expected identical strings for the same items, got %q and %q", a.String(), b.String())
+	}
+}
+
+func TestBloomFilterCardinality(t *testing.T) {
+	s := NewBloomFilter(1000, 0.01, fnv.New64())
+	for i := 0; i < 500; i++ {
+		s.Add(randomBytes[i])
+	}
+	if s.Cardinality() != s.Distinct() {
+		t.Errorf("Expected Cardinality %d to equal Distinct %d", s.Cardinality(), s.Distinct())
+	}
+}
+
+func TestBloomFilterIgnoreEmpty(t *testing.T) {
+	bf := NewBloomFilter(100, 0.01, fnv.New64())
+	// by default every empty item has the same hash and is added as one item
+	bf.Add([]byte{})
+	if !bf.Check(nil) || bf.Distinct() != 1 {
+		t.Errorf("Expected the empty item to be in the set, got %s", bf)
+	}
+	ignoring := NewBloomFilter(100, 0.01, fnv.New64())
+	ignoring.SetIgnoreEmpty(true)
+	ignoring.Add([]byte{})
+	if ignoring.Distinct() != 0 {
+		t.Errorf("Expected empty items to be ignored, got %s", ignoring)
+	}
+	ignoring.Add(randomBytes[0])
+	if !ignoring.Check(randomBytes[0]) || ignoring.Distinct() != 1 {
+		t.Errorf("Expected non-empty items to be added, got %s", ignoring)
+	}
+	union, err := ignoring.Union(bf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the empty item is rejected even though its bits are set from the other BloomFilter
+	if union.Check([]byte{}) {
+		t.Errorf("Expected the ignore empty setting to be kept by Union")
+	}
+}
+
+func TestBloomFilterSaturated(t *testing.T) {
+	bf := NewBloomFilter(100, 0.01, fnv.New64())
+	for i := range bf.bits {
+		bf.bits[i] = math.MaxUint64
+	}
+	// the estimate of a full BloomFilter is +Inf which saturates rather than wrapping around
+	if bf.Distinct() != math.MaxUint64 {
+		t.Errorf("Expected a full BloomFilter to saturate at %d, got %d", uint64(math.MaxUint64), bf.Distinct())
+	}
+	if n, _ := bf.UnionCardinality(bf); n != math.MaxUint64 {
+		t.Errorf("Expected a full UnionCardinality to saturate at %d, got %d", uint64(math.MaxUint64), n)
+	}
+}
@@ -7,11 +7,57 @@ type BoxPlot struct {
 	P2Quantile
 }
 
+// BoxPlotSnapshot is the summary of a BoxPlot at a point in time
+type BoxPlotSnapshot struct {
+	N                  uint64
+	Min                float64
+	LowerWhisker       float64
+	LowerQuartile      float64
+	Median             float64
+	UpperQuartile      float64
+	UpperWhisker       float64
+	Max                float64
+	InterQuartileRange float64
+}
+
 // NewBoxPlot returns a new BoxPlot
 func NewBoxPlot() BoxPlot {
 	return BoxPlot{NewP2Quantile(0.5)}
 }
 
+// Combine merges two BoxPlots, e.g. from different shards of a stream, by combining the underlying P2Quantile
+// the quartiles and whiskers of the result are derived from the merged markers so they inherit
+// the approximation of P2Quantile.Combine
+func (bp BoxPlot) Combine(other BoxPlot) (BoxPlot, error) {
+	combined, err := bp.P2Quantile.Combine(&other.P2Quantile)
+	if err != nil {
+		return BoxPlot{}, err
+	}
+	return BoxPlot{combined}, nil
+}
+
+// Clone returns an independent copy of the BoxPlot, see P2Quantile.Clone
+func (bp BoxPlot) Clone() BoxPlot {
+	return BoxPlot{bp.P2Quantile.Clone()}
+}
+
+// Snapshot returns the summary of the BoxPlot with the quartiles estimated once
+func (bp BoxPlot) Snapshot() BoxPlotSnapshot {
+	lower, upper := bp.LowerQuartile(), bp.UpperQuartile()
+	iqr := upper - lower
+	return BoxPlotSnapshot{
+		N:                  bp.N(),
+		Min:                bp.Min(),
+		LowerWhisker:       lower - 1.5*iqr,
+		LowerQuartile:      lower,
+		Median:             bp.Median(),
+		UpperQuartile:      upper,
+		UpperWhisker:       upper + 1.5*iqr,
+		Max:                bp.Max(),
+		InterQuartileRange: iqr,
+	}
+}
+
 // Median returns the estimated median
 func (bp BoxPlot) Median() float64 {
 	return bp.Quantile()
@@ -62,6 +108,23 @@ func (bp BoxPlot) TriMean() float64 {
 	return (bp.UpperQuartile() + 2.0*bp.Median() + bp.LowerQuartile()) / 4.0
 }
 
+// FiveNumberSummary returns the classic five-number summary, the minimum, lower quartile, median, upper quartile and maximum
+func (bp BoxPlot) FiveNumberSummary() (minimum, lowerQuartile, median, upperQuartile, maximum float64) {
+	return bp.Min(), bp.LowerQuartile(), bp.Median(), bp.UpperQuartile(), bp.Max()
+}
+
+// Percentiles returns the five-number summary keyed by percentile, "min", "p25", "p50", "p75" and "max"
+func (bp BoxPlot) Percentiles() map[string]float64 {
+	minimum, lower, median, upper, maximum := bp.FiveNumberSummary()
+	return map[string]float64{
+		"min": minimum,
+		"p25": lower,
+		"p50": median,
+		"p75": upper,
+		"max": maximum,
+	}
+}
+
 func (bp BoxPlot) String() string {
 	return fmt.Sprintf("Min: %0.3f LowerQuartile: %0.3f Median: %0.3f UpperQuartile: %0.3f Max: %0.3f N: %d", bp.Min(), bp.LowerQuartile(), bp.Median(), bp.UpperQuartile(), bp.Max(), bp.N())
 }
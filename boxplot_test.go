@@ -2,12 +2,12 @@ package streamstats
 
 import (
 	"fmt"
-	"math/rand"
+	"math"
 	"testing"
 )
 
 func TestBoxPlot(t *testing.T) {
-	rand.Seed(42) // for deterministic testing
+	testRand.Seed(42) // for deterministic testing
 	N := 10000
 
 	bp := NewBoxPlot()
@@ -69,3 +69,79 @@ func TestBoxPlot(t *testing.T) {
 		t.Errorf("Expected %s got %s", expectedString, bp)
 	}
 }
+
+func TestBoxPlotCombine(t *testing.T) {
+	a := NewBoxPlot()
+	b := NewBoxPlot()
+	all := NewBoxPlot()
+	for i := 0; i < N; i++ {
+		if i%2 == 0 {
+			a.Add(exponentialTestData[i])
+		} else {
+			b.Add(exponentialTestData[i])
+		}
+		all.Add(exponentialTestData[i])
+	}
+	combined, err := a.Combine(b)
+	if err != nil {
+		t.Fatalf("BoxPlot Combine failed: %s", err)
+	}
+	if combined.N() != all.N() {
+		t.Errorf("Expected N %d, got %d", all.N(), combined.N())
+	}
+	// the shards are from the same distribution so the combined quartiles should match
+	eps := 0.05
+	if math.Abs(combined.Median()-all.Median()) > eps {
+		t.Errorf("Expected Median %f, got %f", all.Median(), combined.Median())
+	}
+	if math.Abs(combined.UpperWhisker()-all.UpperWhisker()) > 3*eps {
+		t.Errorf("Expected UpperWhisker %f, got %f", all.UpperWhisker(), combined.UpperWhisker())
+	}
+	if math.Abs(combined.LowerWhisker()-all.LowerWhisker()) > 3*eps {
+		t.Errorf("Expected LowerWhisker %f, got %f", all.LowerWhisker(), combined.LowerWhisker())
+	}
+	if _, err = a.Combine(BoxPlot{NewP2Quantile(0.9)}); err == nil {
+		t.Errorf("Expected Combine with a different quantile to return error")
+	}
+}
+
+func TestBoxPlotSnapshot(t *testing.T) {
+	bp := NewBoxPlot()
+	for i := 0; i < N; i++ {
+		bp.Add(exponentialTestData[i])
+	}
+	expected := BoxPlotSnapshot{
+		N:                  bp.N(),
+		Min:                bp.Min(),
+		LowerWhisker:       bp.LowerWhisker(),
+		LowerQuartile:      bp.LowerQuartile(),
+		Median:             bp.Median(),
+		UpperQuartile:      bp.UpperQuartile(),
+		UpperWhisker:       bp.UpperWhisker(),
+		Max:                bp.Max(),
+		InterQuartileRange: bp.InterQuartileRange(),
+	}
+	if s := bp.Snapshot(); s != expected {
+		t.Errorf("Expected snapshot %+v, got %+v", expected, s)
+	}
+}
+
+func TestBoxPlotFiveNumberSummary(t *testing.T) {
+	bp := NewBoxPlot()
+	for i := 0; i < N; i++ {
+		bp.Add(uniformTestData[i])
+	}
+	minimum, lower, median, upper, maximum := bp.FiveNumberSummary()
+	if minimum != bp.Min() || lower != bp.LowerQuartile() || median != bp.Median() || upper != bp.UpperQuartile() || maximum != bp.Max() {
+		t.Errorf("Expected summary %s, got %v %v %v %v %v", bp, minimum, lower, median, upper, maximum)
+	}
+	percentiles := bp.Percentiles()
+	for key, expected := range map[string]float64{"min": minimum, "p25": lower, "p50": median, "p75": upper, "max": maximum} {
+		if actual, ok := percentiles[key]; !ok || actual != expected {
+			t.Errorf("Expected %s %v, got %v", key, expected, actual)
+		}
+	}
+	if len(percentiles) != 5 {
+		t.Errorf("Expected 5 percentiles, got %d", len(percentiles))
+	}
+}
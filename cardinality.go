@@ -0,0 +1,60 @@
+package streamstats
+
+import (
+	"hash"
+	"math"
+)
+
+// Cardinality is the interface shared by the count distinct data structures
+// HyperLogLog, LinearCounting, BloomFilter, ExactDistinct and KMV so they can be swapped for each other,
+// e.g. Cardinality[*HyperLogLog], where Combine merges two of the same type
+// the sets merge with Union, so each also has Combine as an alias of Union giving the sketches the same
+// merge method as KMV and the stats data structures like MomentStats, GKQuantile and P2Quantile
+type Cardinality[T any] interface {
+	Add(item []byte)
+	Distinct() uint64
+	Combine(T) (T, error)
+}
+
+// DistinctCounter is the interface for estimating the number of distinct items in a stream
+// with its expected relative error, satisfied by HyperLogLog, LinearCounting, BloomFilter, ExactDistinct and KMV
+// so callers can choose the data structure at construction time depending on the expected scale
+type DistinctCounter interface {
+	Add(item []byte)
+	Distinct() uint64
+	ExpectedError() float64
+}
+
+// NewDistinctCounter returns a DistinctCounter for counting up to expectedMax distinct items with the target
+// relative error using the given hash function, choosing the data structure with the least memory
+// a LinearCounting is returned if one of at most 2^24 bits reaches the target error at expectedMax items
+// and uses fewer bytes than the HyperLogLog that does, otherwise a HyperLogLog of precision HLLPForError(targetError)
+// which has no upper bound on the number of items, so an expectedMax of 0 for an unknown maximum always chooses
+// a HyperLogLog, e.g. a small known maximum like 10000 at 1% uses a LinearCounting of 4 KiB instead of 16 KiB
+// a HyperLogLog can not reach a target error below about 0.2% and uses its maximum precision for those
+func NewDistinctCounter(expectedMax uint64, targetError float64, hash hash.Hash64) DistinctCounter {
+	p := HLLPForError(targetError)
+	if expectedMax > 0 {
+		lc, err := NewLinearCountingForCardinality(expectedMax, targetError, hash)
+		if err == nil && uint64(1<<lc.p)/8 < HLLMemoryBytes(p) {
+			return lc
+		}
+	}
+	return NewHyperLogLog(p, hash)
+}
+
+// roundEstimate converts a cardinality estimate to a uint64 rounded to the nearest integer, rather than truncated
+// which would underestimate by 1/2 on average, and clamped to [0, math.MaxUint64]
+// since the conversion of a float64 outside the range of uint64 is implementation dependent
+// when every bucket holds the maximum value 65-p the raw estimate is alpha*2^65 which exceeds the range
+// and when every bucket is occupied the linear counting estimate is +Inf
+// every estimator converts its estimate with roundEstimate so the rounding and saturation are consistent
+func roundEstimate(estimate float64) uint64 {
+	switch {
+	case !(estimate > 0.0): // also NaN
+		return 0
+	case estimate >= math.MaxUint64: // the float64 math.MaxUint64 is 2^64
+		return math.MaxUint64
+	}
+	return uint64(estimate + 0.5) // add 0.5 to round properly
+}
@@ -0,0 +1,79 @@
+package streamstats
+
+import "fmt"
+
+// CombineMoments folds any number of MomentStats into one with pairwise Combine, e.g. the stats of many shards
+// empty stats are skipped so the result is empty only if every input is empty, but their skipped counts are kept
+func CombineMoments(stats ...MomentStats) MomentStats {
+	var combined MomentStats
+	for i := range stats {
+		switch {
+		case stats[i].n == 0:
+			combined.nonFinite = combined.nonFinite.combine(stats[i].nonFinite)
+		case combined.n == 0:
+			skipped := combined.nonFinite // of the empty stats before
+			combined = stats[i]
+			combined.nonFinite = combined.nonFinite.combine(skipped)
+		default:
+			combined = combined.Combine(&stats[i])
+		}
+	}
+	return combined
+}
+
+// CombineCovar folds any number of CovarStats into one with pairwise Combine
+// empty stats are skipped so the result is empty only if every input is empty, but their skipped counts are kept
+func CombineCovar(stats ...CovarStats) CovarStats {
+	var combined CovarStats
+	for i := range stats {
+		switch {
+		case stats[i].xStats.n == 0:
+			combined.nonFinite = combined.nonFinite.combine(stats[i].nonFinite)
+		case combined.xStats.n == 0:
+			skipped := combined.nonFinite // of the empty stats before
+			combined = stats[i]
+			combined.nonFinite = combined.nonFinite.combine(skipped)
+		default:
+			combined = combined.Combine(&stats[i])
+		}
+	}
+	return combined
+}
+
+// CombineHLL folds any number of HyperLogLog into a new HyperLogLog with pairwise Union
+// the precision is reduced to the minimum of all the inputs
+// the function will return nil and an error if there are no inputs or the hash functions mismatch
+func CombineHLL(hlls ...*HyperLogLog) (*HyperLogLog, error) {
+	return combineAll(hlls, "HyperLogLog")
+}
+
+// CombineLinearCounting folds any number of LinearCounting into a new LinearCounting with pairwise Union
+// the function will return nil and an error if there are no inputs or the sizes or hash functions mismatch
+func CombineLinearCounting(lcs ...*LinearCounting) (*LinearCounting, error) {
+	return combineAll(lcs, "LinearCounting")
+}
+
+// CombineBloomFilter folds any number of BloomFilter into a new BloomFilter with pairwise Union
+// the function will return nil and an error if there are no inputs or the filters are not compatible
+func CombineBloomFilter(bfs ...*BloomFilter) (*BloomFilter, error) {
+	return combineAll(bfs, "BloomFilter")
+}
+
+// combineAll folds the sets with pairwise Combine starting from the first set combined with itself
+// so the result never aliases an input
+func combineAll[T Cardinality[T]](sets []T, name string) (T, error) {
+	var zero T
+	if len(sets) == 0 {
+		return zero, fmt.Errorf("No %s to combine", name)
+	}
+	combined, err := sets[0].Combine(sets[0])
+	if err != nil {
+		return zero, err
+	}
+	for _, set := range sets[1:] {
+		if combined, err = combined.Combine(set); err != nil {
+			return zero, err
+		}
+	}
+	return combined, nil
+}
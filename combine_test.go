@@ -0,0 +1,155 @@
+package streamstats
+
+import (
+	"hash/fnv"
+	"math"
+	"testing"
+)
+
+func TestCombineMoments(t *testing.T) {
+	shards := make([]MomentStats, 4)
+	var total MomentStats
+	for i := 0; i < N; i++ {
+		x := 2.0*gaussianTestData[i] + float64(i%4)
+		shards[i%4].Add(x)
+		total.Add(x)
+	}
+	// empty stats are skipped anywhere in the list
+	combined := CombineMoments(MomentStats{}, shards[0], shards[1], MomentStats{}, shards[2], shards[3])
+	eps := 1e-9
+	if combined.N() != total.N() {
+		t.Errorf("Expected N %d, got %d", total.N(), combined.N())
+	}
+	if math.Abs(combined.Mean()-total.Mean()) > eps {
+		t.Errorf("Expected Mean %v, got %v", total.Mean(), combined.Mean())
+	}
+	if math.Abs(combined.Variance()-total.Variance()) > eps {
+		t.Errorf("Expected Variance %v, got %v", total.Variance(), combined.Variance())
+	}
+	if math.Abs(combined.Kurtosis()-total.Kurtosis()) > eps {
+		t.Errorf("Expected Kurtosis %v, got %v", total.Kurtosis(), combined.Kurtosis())
+	}
+	if empty := CombineMoments(); empty.N() != 0 {
+		t.Errorf("Expected no stats to combine to empty stats, got N %d", empty.N())
+	}
+}
+
+func TestCombineSkippedCount(t *testing.T) {
+	// a shard of only NaN is empty but its skipped values are still counted
+	var nanShard, shard MomentStats
+	var nanCovar, covar CovarStats
+	for _, s := range []*MomentStats{&nanShard, &shard} {
+		s.SetSkipNonFinite(true)
+	}
+	for _, c := range []*CovarStats{&nanCovar, &covar} {
+		c.SetSkipNonFinite(true)
+	}
+	for i := 0; i < 3; i++ {
+		nanShard.Add(math.NaN())
+		nanCovar.Add(math.NaN(), 1.0)
+	}
+	for i := 0; i < 5; i++ {
+		shard.Add(float64(i))
+		covar.Add(float64(i), float64(i))
+	}
+	shard.Add(math.Inf(1))
+	covar.Add(1.0, math.Inf(-1))
+	for _, combined := range []MomentStats{CombineMoments(nanShard, shard), CombineMoments(shard, nanShard)} {
+		if combined.N() != 5 || combined.SkippedCount() != 4 {
+			t.Errorf("Expected N 5 with 4 skipped values, got %d with %d", combined.N(), combined.SkippedCount())
+		}
+	}
+	if combined := CombineMoments(nanShard, MomentStats{}); combined.SkippedCount() != 3 {
+		t.Errorf("Expected 3 skipped values from empty stats, got %d", combined.SkippedCount())
+	}
+	for _, combined := range []CovarStats{CombineCovar(nanCovar, covar), CombineCovar(covar, nanCovar)} {
+		if combined.N() != 5 || combined.SkippedCount() != 4 {
+			t.Errorf("Expected N 5 with 4 skipped samples, got %d with %d", combined.N(), combined.SkippedCount())
+		}
+	}
+}
+
+func TestCombineCovar(t *testing.T) {
+	shards := make([]CovarStats, 3)
+	var total CovarStats
+	for i := 0; i < N; i++ {
+		x, y := gaussianTestData[i], 2.0*gaussianTestData[i]+exponentialTestData[i]
+		shards[i%3].Add(x, y)
+		total.Add(x, y)
+	}
+	combined := CombineCovar(CovarStats{}, shards[0], shards[1], shards[2])
+	eps := 1e-9
+	if combined.N() != total.N() {
+		t.Errorf("Expected N %d, got %d", total.N(), combined.N())
+	}
+	if math.Abs(combined.Slope()-total.Slope()) > eps {
+		t.Errorf("Expected Slope %v, got %v", total.Slope(), combined.Slope())
+	}
+	if math.Abs(combined.Correlation()-total.Correlation()) > eps {
+		t.Errorf("Expected Correlation %v, got %v", total.Correlation(), combined.Correlation())
+	}
+}
+
+func TestCombineHLL(t *testing.T) {
+	total := NewHyperLogLog(10, fnv.New64())
+	shards := []*HyperLogLog{NewHyperLogLog(10, fnv.New64()), NewHyperLogLog(12, fnv.New64()), NewHyperLogLog(10, fnv.New64())}
+	for i := 0; i < N; i++ {
+		shards[i%3].Add(randomBytes[i])
+		total.Add(randomBytes[i])
+	}
+	combined, err := CombineHLL(shards...)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !combined.Equal(total) {
+		t.Errorf("Expected the combined registers to equal a HyperLogLog of all items")
+	}
+	single, err := CombineHLL(shards[0])
+	if err != nil || single == shards[0] || !single.Equal(shards[0]) {
+		t.Errorf("Expected a single HyperLogLog to be copied, got %v", err)
+	}
+	if _, err = CombineHLL(); err == nil {
+		t.Errorf("Expected an error combining no HyperLogLog")
+	}
+	if _, err = CombineHLL(shards[0], NewHyperLogLog(10, fnv.New64a())); err == nil {
+		t.Errorf("Expected an error combining mismatched hash functions")
+	}
+}
+
+func TestCombineLinearCounting(t *testing.T) {
+	total := NewLinearCounting(12, fnv.New64())
+	shards := []*LinearCounting{NewLinearCounting(12, fnv.New64()), NewLinearCounting(12, fnv.New64())}
+	for i := 0; i < 1000; i++ {
+		shards[i%2].Add(randomBytes[i])
+		total.Add(randomBytes[i])
+	}
+	combined, err := CombineLinearCounting(shards...)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !combined.Equal(total) {
+		t.Errorf("Expected the combined bits to equal a LinearCounting of all items")
+	}
+	if _, err = CombineLinearCounting(); err == nil {
+		t.Errorf("Expected an error combining no LinearCounting")
+	}
+}
+
+func TestCombineBloomFilter(t *testing.T) {
+	total := NewBloomFilter(1000, 0.01, fnv.New64())
+	shards := []*BloomFilter{NewBloomFilter(1000, 0.01, fnv.New64()), NewBloomFilter(1000, 0.01, fnv.New64())}
+	for i := 0; i < 1000; i++ {
+		shards[i%2].Add(randomBytes[i])
+		total.Add(randomBytes[i])
+	}
+	combined, err := CombineBloomFilter(shards...)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !combined.bits.Equal(total.bits) {
+		t.Errorf("Expected the combined bits to equal a BloomFilter of all items")
+	}
+	if _, err = CombineBloomFilter(shards[0], NewBloomFilter(2000, 0.01, fnv.New64())); err == nil {
+		t.Errorf("Expected an error combining different sizes")
+	}
+}
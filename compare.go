@@ -0,0 +1,97 @@
+package streamstats
+
+import (
+	"encoding/binary"
+	"hash"
+	"math"
+	"time"
+)
+
+// EstimatorResult is the cost and accuracy of one count distinct data structure in an EstimatorReport
+type EstimatorResult struct {
+	MemoryBytes   uint64        // the bytes used to store the buckets
+	Distinct      uint64        // the estimated number of distinct items
+	Error         float64       // the actual relative error of Distinct
+	ExpectedError float64       // the relative error expected by the data structure at its filling
+	AddTime       time.Duration // the total time to add every item
+	DistinctTime  time.Duration // the time to compute Distinct once
+}
+
+// EstimatorReport compares a LinearCounting and a HyperLogLog with the same number of buckets 2^P built from the same items
+// the LinearCounting uses one bit per bucket, 1/8 of the memory of the HyperLogLog, and is more accurate
+// until it approaches saturation, while the HyperLogLog keeps the same relative error to virtually unlimited cardinalities
+type EstimatorReport struct {
+	Cardinality    uint64 // the exact number of distinct items
+	P              byte   // the precision of both data structures
+	LinearCounting EstimatorResult
+	HyperLogLog    EstimatorResult
+}
+
+// CompareEstimators returns the comparison of a LinearCounting and a HyperLogLog of precision p
+// built from cardinality distinct items, the little-endian 8 byte encodings of 0 to cardinality-1, using WyHash64
+// which mixes the sequential items into the top bits used for the buckets much better than FNV
+// p is bounded by the precisions supported by both, 6 and 18
+func CompareEstimators(cardinality uint64, p byte) EstimatorReport {
+	items := make([][]byte, cardinality)
+	for i := range items {
+		items[i] = make([]byte, 8)
+		binary.LittleEndian.PutUint64(items[i], uint64(i))
+	}
+	return CompareEstimatorsOn(items, p, func() hash.Hash64 { return NewWyHash64(0) })
+}
+
+// CompareEstimatorsOn returns the comparison of a LinearCounting and a HyperLogLog of precision p
+// built from the given items, e.g. a sample of production data, using hash functions from newHash
+// the exact cardinality is computed from a set of the items, so it uses memory proportional to the items
+// p is bounded by the precisions supported by both, 6 and 18
+func CompareEstimatorsOn(items [][]byte, p byte, newHash func() hash.Hash64) EstimatorReport {
+	if p < minLinearCountingP {
+		p = minLinearCountingP
+	} else if p > maximumHyperLogLogP {
+		p = maximumHyperLogLogP
+	}
+	exact := make(map[string]struct{}, len(items))
+	for _, item := range items {
+		exact[string(item)] = struct{}{}
+	}
+	report := EstimatorReport{Cardinality: uint64(len(exact)), P: p}
+
+	lc := NewLinearCounting(p, newHash())
+	start := time.Now()
+	for _, item := range items {
+		lc.Add(item)
+	}
+	report.LinearCounting.AddTime = time.Since(start)
+	start = time.Now()
+	report.LinearCounting.Distinct = lc.Distinct()
+	report.LinearCounting.DistinctTime = time.Since(start)
+	report.LinearCounting.MemoryBytes = 8 * uint64(len(lc.bits))
+	report.LinearCounting.ExpectedError = lc.ExpectedError()
+	report.LinearCounting.Error = relativeError(report.LinearCounting.Distinct, report.Cardinality)
+
+	hll := NewHyperLogLog(p, newHash())
+	start = time.Now()
+	for _, item := range items {
+		hll.Add(item)
+	}
+	report.HyperLogLog.AddTime = time.Since(start)
+	start = time.Now()
+	report.HyperLogLog.Distinct = hll.Distinct()
+	report.HyperLogLog.DistinctTime = time.Since(start)
+	report.HyperLogLog.MemoryBytes = HLLMemoryBytes(p)
+	report.HyperLogLog.ExpectedError = hll.ExpectedError()
+	report.HyperLogLog.Error = relativeError(report.HyperLogLog.Distinct, report.Cardinality)
+
+	return report
+}
+
+// relativeError returns |estimate - actual| / actual, or 0 if both are 0
+func relativeError(estimate, actual uint64) float64 {
+	if actual == 0 {
+		if estimate == 0 {
+			return 0.0
+		}
+		return math.Inf(1)
+	}
+	return math.Abs(float64(estimate)-float64(actual)) / float64(actual)
+}
@@ -0,0 +1,52 @@
+package streamstats
+
+import (
+	"hash/fnv"
+	"math"
+	"testing"
+)
+
+func TestCompareEstimators(t *testing.T) {
+	report := CompareEstimators(1234, 13)
+	if report.Cardinality != 1234 || report.P != 13 {
+		t.Errorf("Expected cardinality 1234 at p=13, got %d at p=%d", report.Cardinality, report.P)
+	}
+	// LinearCounting uses one bit per bucket, 1/8 of the HyperLogLog
+	if 8*report.LinearCounting.MemoryBytes != report.HyperLogLog.MemoryBytes {
+		t.Errorf("Expected LinearCounting to use 1/8 of the memory, got %d and %d bytes", report.LinearCounting.MemoryBytes, report.HyperLogLog.MemoryBytes)
+	}
+	// at low cardinality the HyperLogLog uses the same linear counting estimate
+	if report.LinearCounting.Distinct != report.HyperLogLog.Distinct {
+		t.Errorf("Expected equal estimates at low cardinality, got %d and %d", report.LinearCounting.Distinct, report.HyperLogLog.Distinct)
+	}
+	for name, result := range map[string]EstimatorResult{"LinearCounting": report.LinearCounting, "HyperLogLog": report.HyperLogLog} {
+		expected := math.Abs(float64(result.Distinct)-1234.0) / 1234.0
+		if result.Error != expected {
+			t.Errorf("%s: Expected relative error %v, got %v", name, expected, result.Error)
+		}
+		if result.Error > 3*result.ExpectedError {
+			t.Errorf("%s: Expected relative error %v within 3 times the expected error %v", name, result.Error, result.ExpectedError)
+		}
+		if result.AddTime <= 0 {
+			t.Errorf("%s: Expected a positive time to add the items, got %v", name, result.AddTime)
+		}
+	}
+	// p is bounded by the precisions supported by both
+	if r := CompareEstimators(10, 2); r.P != minLinearCountingP {
+		t.Errorf("Expected p bounded below by %d, got %d", minLinearCountingP, r.P)
+	}
+	if r := CompareEstimators(10, 30); r.P != maximumHyperLogLogP {
+		t.Errorf("Expected p bounded above by %d, got %d", maximumHyperLogLogP, r.P)
+	}
+}
+
+func TestCompareEstimatorsOn(t *testing.T) {
+	items := append(randomBytes[:500:500], randomBytes[:100]...) // duplicates are counted once
+	report := CompareEstimatorsOn(items, 10, fnv.New64)
+	if report.Cardinality != 500 {
+		t.Errorf("Expected cardinality 500, got %d", report.Cardinality)
+	}
+	if empty := CompareEstimatorsOn(nil, 10, fnv.New64); empty.LinearCounting.Error != 0.0 || empty.HyperLogLog.Error != 0.0 {
+		t.Errorf("Expected no error without items, got %+v", empty)
+	}
+}
@@ -0,0 +1,157 @@
+package streamstats
+
+import (
+	"hash"
+	"math"
+)
+
+const (
+	minimumCounterWidth = 2
+	maximumCounterWidth = 16
+)
+
+// CountingBloomFilter is a BloomFilter that stores a small counter in each bucket instead of a single bit
+// so that items can be removed as well as added
+type CountingBloomFilter struct {
+	hash      hash.Hash64 // the base hash function
+	counters  []uint64    // the bucket counters packed into 64-bit words
+	width     uint64      // the number of bits in each counter
+	max       uint64      // the saturation value of a counter, 2^width - 1
+	k         uint64      // number of hash functions to calculate for each item
+	m         uint64      // number of counters in the CountingBloomFilter
+	saturated bool        // whether any counter has reached the saturation value
+}
+
+// NewCountingBloomFilter returns a pointer to a new CountingBloomFilter sized in m and k the same as NewBloomFilter
+// to target the given false positive rate at the given number of items using the given hash function
+// each counter uses width bits, which is rounded up to a power of two and bounded by 2 and 16
+// so that counters pack evenly into 64-bit words, e.g. 4 bits for low multiplicity and 8 bits for high multiplicity
+// a counter that reaches the maximum value 2^width - 1 saturates and is never decremented again, so
+// after saturation Remove can no longer be exact for that bucket and removed items may remain as false positives
+func NewCountingBloomFilter(Nitems uint64, FalsePositiveRate float64, width uint, hash hash.Hash64) *CountingBloomFilter {
+	w := nextPowerOfTwo(uint64(width))
+	if w < minimumCounterWidth {
+		w = minimumCounterWidth
+	} else if w > maximumCounterWidth {
+		w = maximumCounterWidth
+	}
+	m, k := bloomFilterSize(Nitems, FalsePositiveRate)
+	words := (m*w + 63) / 64
+	return &CountingBloomFilter{
+		hash:     hash,
+		counters: make([]uint64, words, words),
+		width:    w,
+		max:      (1 << w) - 1,
+		k:        k,
+		m:        m,
+	}
+}
+
+// Add puts an item in the set represented by the CountingBloomFilter incrementing each of its k counters
+func (cbf *CountingBloomFilter) Add(item []byte) {
+	h1, h2 := cbf.hashes(item)
+	for i := uint64(0); i < cbf.k; i++ {
+		bucket := (h1 + i*h2) & (cbf.m - 1) // generate the k hash functions as h_i = h1 + i * h2 mod m
+		count := cbf.get(bucket)
+		if count < cbf.max {
+			count++
+			cbf.set(bucket, count)
+		}
+		if count == cbf.max {
+			cbf.saturated = true
+		}
+	}
+}
+
+// Remove takes an item out of the set represented by the CountingBloomFilter decrementing each of its k counters
+// it returns false without modifying the filter if the item is definitely not in the set
+// saturated counters are not decremented since their true count is unknown
+func (cbf *CountingBloomFilter) Remove(item []byte) bool {
+	if !cbf.Check(item) {
+		return false
+	}
+	h1, h2 := cbf.hashes(item)
+	for i := uint64(0); i < cbf.k; i++ {
+		bucket := (h1 + i*h2) & (cbf.m - 1)
+		count := cbf.get(bucket)
+		if count < cbf.max {
+			cbf.set(bucket, count-1)
+		}
+	}
+	return true
+}
+
+// Check returns false if an item in is definitely not in the set represented by the CountingBloomFilter
+func (cbf CountingBloomFilter) Check(item []byte) bool {
+	h1, h2 := cbf.hashes(item)
+	for i := uint64(0); i < cbf.k; i++ {
+		if cbf.get((h1+i*h2)&(cbf.m-1)) == 0 { // if any counter is zero the item is not in the set
+			return false
+		}
+	}
+	return true // all hash functions check out
+}
+
+// AddFloat64 puts a float64 value in the set represented by the CountingBloomFilter
+// -0.0 and +0.0 are treated as the same value and all NaNs are treated as a single value
+func (cbf *CountingBloomFilter) AddFloat64(x float64) {
+	cbf.Add(float64Bytes(x))
+}
+
+// RemoveFloat64 takes a float64 value out of the set represented by the CountingBloomFilter
+// using the same canonical -0.0 and NaN handling as AddFloat64
+func (cbf *CountingBloomFilter) RemoveFloat64(x float64) bool {
+	return cbf.Remove(float64Bytes(x))
+}
+
+// CheckFloat64 returns false if a float64 value is definitely not in the set represented by the CountingBloomFilter
+// using the same canonical -0.0 and NaN handling as AddFloat64
+func (cbf CountingBloomFilter) CheckFloat64(x float64) bool {
+	return cbf.Check(float64Bytes(x))
+}
+
+// Saturated returns true if any counter has reached its maximum value
+// once saturated, Remove can no longer be exact for the saturated buckets
+func (cbf CountingBloomFilter) Saturated() bool {
+	return cbf.saturated
+}
+
+// Occupancy returns the ratio of non-zero counters in the CountingBloomFilter
+func (cbf CountingBloomFilter) Occupancy() float64 {
+	var occupied uint64
+	for i := uint64(0); i < cbf.m; i++ {
+		if cbf.get(i) != 0 {
+			occupied++
+		}
+	}
+	return float64(occupied) / float64(cbf.m)
+}
+
+// Distinct estimates the number of elements in the filter by using the LinearCounting estimate accounting for the
+// k hash functions calculated for each element
+func (cbf CountingBloomFilter) Distinct() uint64 {
+	return roundEstimate(-(float64(cbf.m) / float64(cbf.k)) * math.Log(1-cbf.Occupancy()))
+}
+
+// hashes returns the two 32-bit hashes used to generate the k hash functions for an item
+func (cbf CountingBloomFilter) hashes(item []byte) (h1, h2 uint64) {
+	cbf.hash.Reset()
+	cbf.hash.Write(item)
+	hash := cbf.hash.Sum64()
+	h1 = hash & ((1 << 32) - 1) // take the bottom 32 bits as the first hash
+	h2 = hash >> 32             // take the top 32 bits as the second hash
+	return h1, h2
+}
+
+// get returns the value of the counter for the given bucket
+func (cbf CountingBloomFilter) get(bucket uint64) uint64 {
+	offset := bucket * cbf.width
+	return (cbf.counters[offset/64] >> (offset % 64)) & cbf.max
+}
+
+// set stores the value of the counter for the given bucket
+func (cbf CountingBloomFilter) set(bucket, count uint64) {
+	offset := bucket * cbf.width
+	shift := offset % 64
+	cbf.counters[offset/64] = cbf.counters[offset/64]&^(cbf.max<<shift) | (count&cbf.max)<<shift
+}
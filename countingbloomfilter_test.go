@@ -0,0 +1,125 @@
+package streamstats
+
+import (
+	"hash/fnv"
+	"testing"
+)
+
+func TestNewCountingBloomFilter(t *testing.T) {
+	var testCases = []struct {
+		width uint
+		want  uint64
+	}{
+		{0, minimumCounterWidth},
+		{1, minimumCounterWidth},
+		{2, 2},
+		{3, 4},
+		{4, 4},
+		{8, 8},
+		{16, maximumCounterWidth},
+		{32, maximumCounterWidth},
+	}
+	for _, test := range testCases {
+		cbf := NewCountingBloomFilter(107, 0.0101, test.width, fnv.New64())
+		if cbf.width != test.want {
+			t.Errorf("Expected width %d to be %d, got %d", test.width, test.want, cbf.width)
+		}
+		if cbf.max != 1<<test.want-1 {
+			t.Errorf("Expected max counter %d, got %d", 1<<test.want-1, cbf.max)
+		}
+		// the size matches the equivalent BloomFilter
+		if cbf.m != 1024 || cbf.k != 7 {
+			t.Errorf("Expected m = 1024 and k = 7, got m = %d and k = %d", cbf.m, cbf.k)
+		}
+		if uint64(len(cbf.counters)) != cbf.m*cbf.width/64 {
+			t.Errorf("Expected %d words for width %d, got %d", cbf.m*cbf.width/64, cbf.width, len(cbf.counters))
+		}
+	}
+}
+
+func TestCountingBloomFilterPacking(t *testing.T) {
+	for _, width := range []uint{2, 4, 8, 16} {
+		cbf := NewCountingBloomFilter(107, 0.0101, width, fnv.New64())
+		for bucket := uint64(0); bucket < cbf.m; bucket++ {
+			cbf.set(bucket, bucket%(cbf.max+1))
+		}
+		for bucket := uint64(0); bucket < cbf.m; bucket++ {
+			if cbf.get(bucket) != bucket%(cbf.max+1) {
+				t.Errorf("Expected width %d bucket %d to be %d, got %d", width, bucket, bucket%(cbf.max+1), cbf.get(bucket))
+			}
+		}
+	}
+}
+
+func TestCountingBloomFilterRemove(t *testing.T) {
+	maxItems := uint64(300)
+	cbf := NewCountingBloomFilter(maxItems, 0.01, 4, fnv.New64())
+	bf := NewBloomFilter(maxItems, 0.01, fnv.New64())
+	items := make([][]byte, maxItems)
+	testRand.Seed(42)
+	for i := range items {
+		items[i] = make([]byte, 8)
+		testRand.Read(items[i])
+		cbf.Add(items[i])
+	}
+	if cbf.Saturated() {
+		t.Errorf("Expected 4-bit counters not to saturate at the target number of items")
+	}
+	// remove the first half and check the second half against a BloomFilter of only those items
+	for _, item := range items[:maxItems/2] {
+		if !cbf.Remove(item) {
+			t.Errorf("Expected Remove to find an added item")
+		}
+	}
+	for _, item := range items[maxItems/2:] {
+		bf.Add(item)
+		if !cbf.Check(item) {
+			t.Errorf("Expected no false negatives for items that were not removed")
+		}
+	}
+	if cbf.Occupancy() != bf.Occupancy() {
+		t.Errorf("Expected Occupancy %f equal to a BloomFilter of the remaining items, got %f", bf.Occupancy(), cbf.Occupancy())
+	}
+	if cbf.Distinct() != bf.Distinct() {
+		t.Errorf("Expected Distinct %d equal to a BloomFilter of the remaining items, got %d", bf.Distinct(), cbf.Distinct())
+	}
+	for _, item := range items[maxItems/2:] {
+		cbf.Remove(item)
+	}
+	if cbf.Occupancy() != 0.0 {
+		t.Errorf("Expected an empty filter after removing all items, got occupancy %f", cbf.Occupancy())
+	}
+	if cbf.Remove(items[0]) {
+		t.Errorf("Expected Remove of an item not in the filter to return false")
+	}
+}
+
+func TestCountingBloomFilterSaturated(t *testing.T) {
+	cbf := NewCountingBloomFilter(107, 0.0101, 2, fnv.New64())
+	item := []byte("saturate")
+	for i := uint64(0); i < cbf.max; i++ {
+		if cbf.Saturated() {
+			t.Errorf("Expected counters not to saturate after %d adds", i)
+		}
+		cbf.Add(item)
+	}
+	cbf.Add(item) // adding beyond saturation does not overflow
+	if !cbf.Saturated() {
+		t.Errorf("Expected counters to saturate after %d adds", cbf.max+1)
+	}
+	// saturated counters are never decremented so the item remains
+	for i := uint64(0); i < cbf.max+1; i++ {
+		cbf.Remove(item)
+	}
+	if !cbf.Check(item) {
+		t.Errorf("Expected a saturated item to remain in the filter after Remove")
+	}
+}
+
+func BenchmarkCountingBloomFilterAdd(b *testing.B) {
+	cbf := NewCountingBloomFilter(1<<16, 0.01, 4, fnv.New64())
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cbf.Add(randomBytes[i&mask])
+	}
+}
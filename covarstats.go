@@ -1,10 +1,23 @@
 package streamstats
 
+import "math"
+
 // CovarStats is a data structure for computing stats on two related variables x,y from a stream
 type CovarStats struct {
 	xStats MomentStats
 	yStats MomentStats
 	sXY    float64
+	nonFinite
+}
+
+// CovarSnapshot is the derived values of a CovarStats at a point in time
+type CovarSnapshot struct {
+	N           uint64
+	X           MomentSnapshot
+	Y           MomentSnapshot
+	Slope       float64
+	Intercept   float64
+	Correlation float64
 }
 
 // NewCovarStats returns an empty CovarStats structure with no values
@@ -13,16 +26,31 @@ func NewCovarStats() *CovarStats {
 }
 
 // Add adds a sample of the two variables to the CovarStats data structure
+// a sample with a NaN or infinite x or y is skipped and counted instead if SetSkipNonFinite is set
 func (c *CovarStats) Add(x, y float64) {
-	c.sXY += (c.xStats.Mean() - x) * (c.yStats.Mean() - y) * float64(c.xStats.n) / float64(c.xStats.n+1)
+	if c.skip(x, y) {
+		return
+	}
+	// the co-moment update uses the count and means before this observation, so sXY must be
+	// updated before the observation is added to xStats and yStats
+	n := float64(c.N())
+	c.sXY += (c.xStats.Mean() - x) * (c.yStats.Mean() - y) * n / (n + 1.0)
 	c.xStats.Add(x)
 	c.yStats.Add(y)
 }
 
 // Slope returns the slope of the correlation between x and y samples seen so far
+// or 0 if there are fewer than two samples or the variance of x is 0, like Correlation
 func (c *CovarStats) Slope() float64 {
-	sXX := c.xStats.Variance() * float64(c.xStats.n-1.0)
-	return c.sXY / sXX
+	return c.slope(c.xStats.Variance())
+}
+
+// slope returns the slope given the variance of x
+func (c *CovarStats) slope(xVariance float64) float64 {
+	if c.xStats.n < 2 || xVariance == 0.0 {
+		return 0.0
+	}
+	return c.sXY / (xVariance * float64(c.xStats.n-1))
 }
 
 // Intercept returns the intercept of the correlation between x and y samples seen so far
@@ -31,9 +59,31 @@ func (c *CovarStats) Intercept() float64 {
 }
 
 // Correlation returns the Pearson product-moment correlation coefficient of the x and y samples seen so far
+// clamped to [-1, 1] against rounding error, or 0 if there are fewer than two samples or either variance is 0
 func (c *CovarStats) Correlation() float64 {
-	t := c.xStats.StdDev() * c.yStats.StdDev()
-	return c.sXY / (float64(c.xStats.n-1) * t)
+	return c.correlation(c.xStats.StdDev(), c.yStats.StdDev())
+}
+
+// correlation returns the clamped correlation coefficient given the standard deviations of x and y
+func (c *CovarStats) correlation(xStdDev, yStdDev float64) float64 {
+	t := xStdDev * yStdDev
+	if c.xStats.n < 2 || t == 0.0 {
+		return 0.0
+	}
+	return math.Max(-1.0, math.Min(1.0, c.sXY/(float64(c.xStats.n-1)*t)))
+}
+
+// Snapshot returns all of the derived values of the x and y samples seen so far computed once
+func (c *CovarStats) Snapshot() CovarSnapshot {
+	s := CovarSnapshot{
+		N: c.xStats.n,
+		X: c.xStats.Snapshot(),
+		Y: c.yStats.Snapshot(),
+	}
+	s.Slope = c.slope(s.X.Variance)
+	s.Intercept = s.Y.Mean - s.Slope*s.X.Mean
+	s.Correlation = c.correlation(s.X.StdDev, s.Y.StdDev)
+	return s
 }
 
 // N returns the number of samples seen so far
@@ -97,6 +147,7 @@ func (c *CovarStats) Combine(b *CovarStats) CovarStats {
 
 	combined.xStats = c.xStats.Combine(&b.xStats)
 	combined.yStats = c.yStats.Combine(&b.yStats)
+	combined.nonFinite = c.nonFinite.combine(b.nonFinite)
 
 	deltaX := b.xStats.Mean() - c.xStats.Mean()
 	deltaY := b.yStats.Mean() - c.yStats.Mean()
@@ -2,12 +2,11 @@ package streamstats
 
 import (
 	"math"
-	"math/rand"
 	"testing"
 )
 
 func TestCovarStats(t *testing.T) {
-	rand.Seed(42) // for deterministic testing
+	testRand.Seed(42) // for deterministic testing
 	N := 10000
 
 	cv := NewCovarStats()
@@ -94,3 +93,99 @@ func TestCovarStats(t *testing.T) {
 		t.Errorf("Expected %f Correlation got %f", expectedCorrelation, cvC.Correlation())
 	}
 }
+
+func TestCovarStatsTwoPass(t *testing.T) {
+	xs := []float64{2.0, -1.0, 4.5, 3.0, 0.5, 7.0, -2.5, 1.0}
+	ys := []float64{1.0, 0.5, 6.0, 2.0, -1.5, 9.0, -3.0, 2.5}
+	cv := NewCovarStats()
+	var xMean, yMean float64
+	for i := range xs {
+		cv.Add(xs[i], ys[i])
+		xMean += xs[i]
+		yMean += ys[i]
+	}
+	n := float64(len(xs))
+	xMean /= n
+	yMean /= n
+	var sXX, sYY, sXY float64
+	for i := range xs {
+		sXX += (xs[i] - xMean) * (xs[i] - xMean)
+		sYY += (ys[i] - yMean) * (ys[i] - yMean)
+		sXY += (xs[i] - xMean) * (ys[i] - yMean)
+	}
+	for _, tc := range []struct {
+		name             string
+		expected, actual float64
+	}{
+		{"co-moment", sXY, cv.sXY},
+		{"slope", sXY / sXX, cv.Slope()},
+		{"intercept", yMean - sXY/sXX*xMean, cv.Intercept()},
+		{"correlation", sXY / math.Sqrt(sXX*sYY), cv.Correlation()},
+	} {
+		if math.Abs(tc.expected-tc.actual) > 1e-12*math.Max(1.0, math.Abs(tc.expected)) {
+			t.Errorf("Expected %s %v, got %v", tc.name, tc.expected, tc.actual)
+		}
+	}
+}
+
+func TestCovarStatsCorrelationBounds(t *testing.T) {
+	cv := NewCovarStats()
+	if cv.Correlation() != 0.0 {
+		t.Errorf("Expected 0 Correlation with no samples, got %f", cv.Correlation())
+	}
+	cv.Add(1.0, 2.0)
+	if cv.Correlation() != 0.0 {
+		t.Errorf("Expected 0 Correlation with one sample, got %f", cv.Correlation())
+	}
+	constant := NewCovarStats()
+	for i := 0; i < 100; i++ {
+		x := gaussianTestData[i]
+		cv.Add(x, 2.0*x)
+		constant.Add(x, 3.0)
+		if r := cv.Correlation(); r > 1.0 {
+			t.Errorf("Expected Correlation <= 1.0 for y = 2x, got %v", r)
+		}
+		if r := constant.Correlation(); r != 0.0 {
+			t.Errorf("Expected 0 Correlation with zero variance in y, got %v", r)
+		}
+	}
+	cv = NewCovarStats()
+	for i := 0; i < N; i++ {
+		x := 10.0 + gaussianTestData[i]
+		cv.Add(x, -2.0*x)
+		if r := cv.Correlation(); r < -1.0 {
+			t.Errorf("Expected Correlation >= -1.0 for y = -2x, got %v", r)
+		}
+	}
+}
+
+func TestCovarStatsSnapshot(t *testing.T) {
+	cv := NewCovarStats()
+	for i := 0; i < N; i++ {
+		x := gaussianTestData[i]
+		cv.Add(x, 3.0*x+1.0+exponentialTestData[i])
+	}
+	expected := CovarSnapshot{
+		N:           cv.N(),
+		X:           MomentSnapshot{cv.N(), cv.XMean(), cv.XVariance(), cv.XStdDev(), cv.XSkewness(), cv.XKurtosis()},
+		Y:           MomentSnapshot{cv.N(), cv.YMean(), cv.YVariance(), cv.YStdDev(), cv.YSkewness(), cv.YKurtosis()},
+		Slope:       cv.Slope(),
+		Intercept:   cv.Intercept(),
+		Correlation: cv.Correlation(),
+	}
+	if s := cv.Snapshot(); s != expected {
+		t.Errorf("Expected snapshot %+v, got %+v", expected, s)
+	}
+}
+
+func TestCovarStatsSnapshotEmpty(t *testing.T) {
+	// the derived values of an empty CovarStats are 0 rather than NaN
+	cv := NewCovarStats()
+	if s := cv.Snapshot(); s != (CovarSnapshot{}) {
+		t.Errorf("Expected an empty snapshot to be all 0, got %+v", s)
+	}
+	cv.Add(1.0, 2.0)
+	if s := cv.Snapshot(); s.Slope != 0.0 || s.Intercept != 2.0 || cv.Slope() != 0.0 {
+		t.Errorf("Expected a slope of 0 and an intercept of 2 for a single sample, got %v and %v", s.Slope, s.Intercept)
+	}
+}
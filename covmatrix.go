@@ -0,0 +1,201 @@
+package streamstats
+
+import (
+	"fmt"
+	"math"
+)
+
+// CovMatrix is a data structure for computing the means and covariance matrix of d related variables from a stream
+type CovMatrix struct {
+	d        int       // the number of variables
+	n        uint64    // the number of samples
+	mean     []float64 // the mean of each variable
+	comoment []float64 // the d x d co-moments sum((x_i - mean_i)*(x_j - mean_j)) in row-major order
+	delta    []float64 // scratch space for the differences from the mean in Add
+}
+
+// NewCovMatrix returns an empty CovMatrix for d variables, d is bounded below by 1
+func NewCovMatrix(d int) *CovMatrix {
+	if d < 1 {
+		d = 1
+	}
+	return &CovMatrix{
+		d:        d,
+		mean:     make([]float64, d, d),
+		comoment: make([]float64, d*d, d*d),
+		delta:    make([]float64, d, d),
+	}
+}
+
+// Add adds a sample of the d variables to the CovMatrix
+// x must have length d, otherwise Add panics
+func (c *CovMatrix) Add(x []float64) {
+	if len(x) != c.d {
+		panic(fmt.Sprintf("streamstats: CovMatrix of dimension %d can not Add a sample of length %d", c.d, len(x)))
+	}
+	c.n++
+	fN := float64(c.n)
+	// the co-moments are updated with the difference from the previous mean times the difference from the new mean
+	delta := c.delta
+	for i := range x {
+		delta[i] = x[i] - c.mean[i]
+		c.mean[i] += delta[i] / fN
+	}
+	for i := 0; i < c.d; i++ {
+		for j := i; j < c.d; j++ {
+			c.comoment[i*c.d+j] += delta[i] * (x[j] - c.mean[j])
+			c.comoment[j*c.d+i] = c.comoment[i*c.d+j] // keep the matrix exactly symmetric
+		}
+	}
+}
+
+// N returns the number of samples seen so far
+func (c *CovMatrix) N() uint64 {
+	return c.n
+}
+
+// Dim returns the number of variables d
+func (c *CovMatrix) Dim() int {
+	return c.d
+}
+
+// Mean returns the mean of variable i of the samples seen so far
+func (c *CovMatrix) Mean(i int) float64 {
+	return c.mean[i]
+}
+
+// Variance returns the variance of variable i of the samples seen so far
+func (c *CovMatrix) Variance(i int) float64 {
+	return c.Covariance(i, i)
+}
+
+// Covariance returns the sample covariance of variables i and j of the samples seen so far
+func (c *CovMatrix) Covariance(i, j int) float64 {
+	if c.n < 2 {
+		return 0.0
+	}
+	return c.comoment[i*c.d+j] / float64(c.n-1)
+}
+
+// Correlation returns the Pearson product-moment correlation coefficient of variables i and j
+// of the samples seen so far, or 0 if either variable has zero variance
+func (c *CovMatrix) Correlation(i, j int) float64 {
+	t := math.Sqrt(c.comoment[i*c.d+i] * c.comoment[j*c.d+j])
+	if t == 0.0 {
+		return 0.0
+	}
+	return c.comoment[i*c.d+j] / t
+}
+
+// powerIterations is the maximum number of iterations used by TopComponent
+const powerIterations = 1000
+
+// TopComponent returns the top principal component of the samples seen so far, the unit eigenvector of the
+// covariance matrix with the largest eigenvalue and the eigenvalue, i.e. the variance along the component
+// the eigenvector is found by power iteration so convergence is slow if the top two eigenvalues are nearly equal
+// the sign of the eigenvector is chosen so its largest magnitude component is positive
+// a zero vector and eigenvalue are returned if there are fewer than two samples or no variance
+func (c *CovMatrix) TopComponent() ([]float64, float64) {
+	v := make([]float64, c.d, c.d)
+	if c.n < 2 {
+		return v, 0.0
+	}
+	var variance float64
+	for i := 0; i < c.d; i++ {
+		variance += c.comoment[i*c.d+i]
+	}
+	if variance == 0.0 {
+		return v, 0.0
+	}
+	// start from a generic vector rather than a column of the matrix, which may already be an eigenvector
+	// of a smaller eigenvalue that the iteration would never leave, e.g. for a block-diagonal covariance
+	for i := range v {
+		v[i] = 1.0 + 0.5*math.Sin(float64(i+1))
+	}
+	normalize(v)
+	next := make([]float64, c.d, c.d)
+	for iteration := 0; iteration < powerIterations; iteration++ {
+		c.multiply(v, next)
+		if normalize(next) == 0.0 {
+			break
+		}
+		var change float64
+		for i := range v {
+			change += (next[i] - v[i]) * (next[i] - v[i])
+		}
+		v, next = next, v
+		if change < 1e-24 {
+			break
+		}
+	}
+	// the eigenvalue is the Rayleigh quotient v^T S v of the unit vector v
+	c.multiply(v, next)
+	var eigenvalue float64
+	largest := 0
+	for i := range v {
+		eigenvalue += v[i] * next[i]
+		if math.Abs(v[i]) > math.Abs(v[largest]) {
+			largest = i
+		}
+	}
+	if v[largest] < 0 {
+		for i := range v {
+			v[i] = -v[i]
+		}
+	}
+	return v, eigenvalue / float64(c.n-1)
+}
+
+// multiply sets y to the co-moment matrix times x
+func (c *CovMatrix) multiply(x, y []float64) {
+	for i := range y {
+		y[i] = 0.0
+		for j := range x {
+			y[i] += c.comoment[i*c.d+j] * x[j]
+		}
+	}
+}
+
+// normalize scales v to unit length and returns the original length
+func normalize(v []float64) float64 {
+	var norm float64
+	for _, x := range v {
+		norm += x * x
+	}
+	norm = math.Sqrt(norm)
+	if norm == 0.0 {
+		return 0.0
+	}
+	for i := range v {
+		v[i] /= norm
+	}
+	return norm
+}
+
+// Combine returns the combination of two CovMatrix datastructures
+// the function will return nil and an error if the number of variables mismatch
+func (c *CovMatrix) Combine(b *CovMatrix) (*CovMatrix, error) {
+	if c.d != b.d {
+		return nil, fmt.Errorf("CovMatrix do not have equal dimension d1 = %d != %d = d2", c.d, b.d)
+	}
+	combined := NewCovMatrix(c.d)
+	combined.n = c.n + b.n
+	if combined.n == 0 {
+		return combined, nil
+	}
+	cN := float64(c.n) // convert to floats for arithmetic operations
+	bN := float64(b.n)
+	fN := float64(combined.n)
+	delta := make([]float64, c.d, c.d)
+	for i := range delta {
+		delta[i] = b.mean[i] - c.mean[i]
+		combined.mean[i] = c.mean[i] + delta[i]*bN/fN
+	}
+	for i := 0; i < c.d; i++ {
+		for j := 0; j < c.d; j++ {
+			k := i*c.d + j
+			combined.comoment[k] = c.comoment[k] + b.comoment[k] + delta[i]*delta[j]*cN*bN/fN
+		}
+	}
+	return combined, nil
+}
@@ -0,0 +1,206 @@
+package streamstats
+
+import (
+	"math"
+	"testing"
+)
+
+// correlatedSample returns x = A*z for independent standard normal z so the covariance is A*A^T
+func correlatedSample(A [3][3]float64) []float64 {
+	z := [3]float64{testRand.NormFloat64(), testRand.NormFloat64(), testRand.NormFloat64()}
+	x := make([]float64, 3)
+	for i := range x {
+		for j := range z {
+			x[i] += A[i][j] * z[j]
+		}
+	}
+	x[0] += 1.0 // shift the means
+	x[2] -= 2.0
+	return x
+}
+
+func TestCovMatrix(t *testing.T) {
+	testRand.Seed(42)
+	A := [3][3]float64{
+		{1.0, 0.0, 0.0},
+		{0.5, 2.0, 0.0},
+		{-1.0, 0.3, 0.7},
+	}
+	var expected [3][3]float64 // A * A^T
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				expected[i][j] += A[i][k] * A[j][k]
+			}
+		}
+	}
+	c := NewCovMatrix(3)
+	a := NewCovMatrix(3)
+	b := NewCovMatrix(3)
+	covar := NewCovarStats()
+	n := 100000
+	for s := 0; s < n; s++ {
+		x := correlatedSample(A)
+		c.Add(x)
+		if s%3 == 0 {
+			a.Add(x)
+		} else {
+			b.Add(x)
+		}
+		covar.Add(x[0], x[1])
+	}
+	if c.N() != uint64(n) || c.Dim() != 3 {
+		t.Errorf("Expected N %d and Dim 3, got %d and %d", n, c.N(), c.Dim())
+	}
+	eps := 0.05
+	means := []float64{1.0, 0.0, -2.0}
+	for i := 0; i < 3; i++ {
+		if math.Abs(c.Mean(i)-means[i]) > eps {
+			t.Errorf("Expected Mean(%d) %f, got %f", i, means[i], c.Mean(i))
+		}
+		for j := 0; j < 3; j++ {
+			if math.Abs(c.Covariance(i, j)-expected[i][j]) > eps*math.Max(1.0, expected[i][j]) {
+				t.Errorf("Expected Covariance(%d, %d) %f, got %f", i, j, expected[i][j], c.Covariance(i, j))
+			}
+			if c.Covariance(i, j) != c.Covariance(j, i) {
+				t.Errorf("Expected a symmetric covariance matrix, got %f != %f", c.Covariance(i, j), c.Covariance(j, i))
+			}
+			correlation := expected[i][j] / math.Sqrt(expected[i][i]*expected[j][j])
+			if math.Abs(c.Correlation(i, j)-correlation) > eps {
+				t.Errorf("Expected Correlation(%d, %d) %f, got %f", i, j, correlation, c.Correlation(i, j))
+			}
+		}
+	}
+	// agrees with CovarStats for a pair of variables
+	if math.Abs(c.Correlation(0, 1)-covar.Correlation()) > 1e-9 {
+		t.Errorf("Expected Correlation %f matching CovarStats, got %f", covar.Correlation(), c.Correlation(0, 1))
+	}
+	if math.Abs(c.Variance(1)-covar.YVariance()) > 1e-9 {
+		t.Errorf("Expected Variance %f matching CovarStats, got %f", covar.YVariance(), c.Variance(1))
+	}
+	combined, err := a.Combine(b)
+	if err != nil {
+		t.Fatalf("CovMatrix Combine failed: %s", err)
+	}
+	if combined.N() != c.N() {
+		t.Errorf("Expected combined N %d, got %d", c.N(), combined.N())
+	}
+	for i := 0; i < 3; i++ {
+		if math.Abs(combined.Mean(i)-c.Mean(i)) > 1e-9 {
+			t.Errorf("Expected combined Mean(%d) %f, got %f", i, c.Mean(i), combined.Mean(i))
+		}
+		for j := 0; j < 3; j++ {
+			if math.Abs(combined.Covariance(i, j)-c.Covariance(i, j)) > 1e-9 {
+				t.Errorf("Expected combined Covariance(%d, %d) %f, got %f", i, j, c.Covariance(i, j), combined.Covariance(i, j))
+			}
+		}
+	}
+	if _, err = a.Combine(NewCovMatrix(2)); err == nil {
+		t.Errorf("Expected Combine of different dimensions to return error")
+	}
+}
+
+func TestCovMatrixEdgeCases(t *testing.T) {
+	c := NewCovMatrix(0)
+	if c.Dim() != 1 {
+		t.Errorf("Expected a minimum dimension of 1, got %d", c.Dim())
+	}
+	c = NewCovMatrix(2)
+	c.Add([]float64{1.0, 2.0})
+	if c.Covariance(0, 1) != 0.0 || c.Correlation(0, 1) != 0.0 {
+		t.Errorf("Expected zero covariance and correlation for a single sample, got %f and %f", c.Covariance(0, 1), c.Correlation(0, 1))
+	}
+	empty, err := NewCovMatrix(2).Combine(NewCovMatrix(2))
+	if err != nil || empty.N() != 0 || math.IsNaN(empty.Mean(0)) {
+		t.Errorf("Expected combining two empty CovMatrix to be empty, got N %d Mean %f error %v", empty.N(), empty.Mean(0), err)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected Add of the wrong dimension to panic")
+		}
+	}()
+	c.Add([]float64{1.0})
+}
+
+func TestCovMatrixTopComponent(t *testing.T) {
+	testRand.Seed(42)
+	// independent variables with standard deviations 3, 1 and 0.5 rotated so the top component is (1, 1, 0)/sqrt(2)
+	r := 1 / math.Sqrt(2)
+	A := [3][3]float64{
+		{3 * r, -r, 0.0},
+		{3 * r, r, 0.0},
+		{0.0, 0.0, 0.5},
+	}
+	c := NewCovMatrix(3)
+	if v, lambda := c.TopComponent(); lambda != 0.0 || v[0] != 0.0 {
+		t.Errorf("Expected a zero component for an empty CovMatrix, got %v %f", v, lambda)
+	}
+	for s := 0; s < 100000; s++ {
+		c.Add(correlatedSample(A))
+	}
+	v, lambda := c.TopComponent()
+	if math.Abs(lambda-9.0) > 0.2 {
+		t.Errorf("Expected top eigenvalue 9.0, got %f", lambda)
+	}
+	expected := []float64{r, r, 0.0}
+	for i := range v {
+		if math.Abs(v[i]-expected[i]) > 0.01 {
+			t.Errorf("Expected top eigenvector %v, got %v", expected, v)
+			break
+		}
+	}
+	// the eigenvector satisfies S*v = lambda*v
+	for i := range v {
+		var sv float64
+		for j := range v {
+			sv += c.Covariance(i, j) * v[j]
+		}
+		if math.Abs(sv-lambda*v[i]) > 1e-6 {
+			t.Errorf("Expected S*v = lambda*v in component %d, got %f != %f", i, sv, lambda*v[i])
+		}
+	}
+	// constant samples have no principal component
+	c = NewCovMatrix(2)
+	c.Add([]float64{1.0, 1.0})
+	c.Add([]float64{1.0, 1.0})
+	if v, lambda := c.TopComponent(); lambda != 0.0 || v[0] != 0.0 || v[1] != 0.0 {
+		t.Errorf("Expected a zero component without variance, got %v %f", v, lambda)
+	}
+}
+
+func TestCovMatrixTopComponentBlockDiagonal(t *testing.T) {
+	// x0 has variance 2 and is uncorrelated with x1 and x2, which have variance 1.25 and covariance 1
+	// so x0 is an eigenvector with eigenvalue 2 and the top component is (0, 1, 1)/sqrt(2) with eigenvalue 2.25
+	s := math.Sqrt(7.0 / 4.0)
+	u := (math.Sqrt(63.0) + math.Sqrt(7.0)) / 8.0
+	w := (math.Sqrt(63.0) - math.Sqrt(7.0)) / 8.0
+	c := NewCovMatrix(3)
+	for _, x0 := range []float64{s, -s} {
+		for _, pair := range [][2]float64{{u, w}, {-u, -w}, {w, u}, {-w, -u}} {
+			c.Add([]float64{x0, pair[0], pair[1]})
+		}
+	}
+	v, lambda := c.TopComponent()
+	if math.Abs(lambda-2.25) > 1e-9 {
+		t.Errorf("Expected top eigenvalue 2.25, got %f", lambda)
+	}
+	r := 1 / math.Sqrt(2)
+	expected := []float64{0.0, r, r}
+	for i := range v {
+		if math.Abs(v[i]-expected[i]) > 1e-6 {
+			t.Errorf("Expected top eigenvector %v, got %v", expected, v)
+			break
+		}
+	}
+}
+
+func BenchmarkCovMatrixAdd(b *testing.B) {
+	c := NewCovMatrix(3)
+	x := make([]float64, 3)
+	for i := 0; i < b.N; i++ {
+		x[0] = gaussianTestData[i&mask]
+		x[1] = exponentialTestData[i&mask]
+		x[2] = uniformTestData[i&mask]
+		c.Add(x)
+	}
+}
@@ -0,0 +1,68 @@
+package streamstats
+
+import "math"
+
+// CUSUM is a tabular cumulative sum change point detector for sustained shifts in the mean of a stream
+// relative to a reference mean and standard deviation, based on
+// Continuous Inspection Schemes, E. S. Page, Biometrika Vol. 41, No. 1/2 (1954), pp. 100-115
+// each observation is standardized to z = (x - mean) / stdDev and accumulated in the one-sided sums
+// S+ = max(0, S+ + z - k) and S- = max(0, S- - z - k), a shift is detected when either exceeds h
+// the allowance k is typically half the size of the shift to detect and h around 4 or 5, both in standard deviations
+type CUSUM struct {
+	mean     float64 // the reference mean
+	stdDev   float64 // the reference standard deviation
+	k        float64 // the allowance in standard deviations
+	h        float64 // the decision threshold in standard deviations
+	positive float64 // the cumulative sum of upward deviations
+	negative float64 // the cumulative sum of downward deviations
+}
+
+// NewCUSUM returns a CUSUM detecting shifts from the reference mean and standard deviation
+// with the allowance k and decision threshold h in standard deviations
+// a non-positive standard deviation is replaced by 1 so the sums are in the units of x
+func NewCUSUM(mean, stdDev, k, h float64) *CUSUM {
+	if !(stdDev > 0.0) {
+		stdDev = 1.0
+	}
+	return &CUSUM{mean: mean, stdDev: stdDev, k: k, h: h}
+}
+
+// NewCUSUMFromMomentStats returns a CUSUM using the mean and standard deviation of a reference period
+// e.g. a MomentStats of a training window, with the allowance k and decision threshold h in standard deviations
+func NewCUSUMFromMomentStats(m *MomentStats, k, h float64) *CUSUM {
+	return NewCUSUM(m.Mean(), m.StdDev(), k, h)
+}
+
+// Add is an alias of Push
+func (c *CUSUM) Add(x float64) {
+	c.Push(x)
+}
+
+// Push updates the cumulative sums with the observation x
+func (c *CUSUM) Push(x float64) {
+	z := (x - c.mean) / c.stdDev
+	c.positive = math.Max(0.0, c.positive+z-c.k)
+	c.negative = math.Max(0.0, c.negative-z-c.k)
+}
+
+// PositiveSum returns the cumulative sum of upward deviations S+ in standard deviations
+func (c *CUSUM) PositiveSum() float64 {
+	return c.positive
+}
+
+// NegativeSum returns the cumulative sum of downward deviations S- in standard deviations
+// as a non-negative magnitude
+func (c *CUSUM) NegativeSum() float64 {
+	return c.negative
+}
+
+// ShiftDetected returns true if either cumulative sum exceeds the decision threshold h
+func (c *CUSUM) ShiftDetected() bool {
+	return c.positive > c.h || c.negative > c.h
+}
+
+// Reset clears the cumulative sums keeping the reference mean and standard deviation, e.g. after an alert
+func (c *CUSUM) Reset() {
+	c.positive = 0.0
+	c.negative = 0.0
+}
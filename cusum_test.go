@@ -0,0 +1,56 @@
+package streamstats
+
+import "testing"
+
+func TestCUSUM(t *testing.T) {
+	var reference MomentStats
+	for i := 0; i < N/2; i++ {
+		reference.Add(10.0 + 2.0*gaussianTestData[i])
+	}
+	c := NewCUSUMFromMomentStats(&reference, 0.5, 8.0)
+	// an in-control stream of 1000 observations should not alarm with h = 8
+	for i := N / 2; i < N/2+1000; i++ {
+		c.Push(10.0 + 2.0*gaussianTestData[i])
+		if c.ShiftDetected() {
+			t.Fatalf("Expected no shift detected in control, got S+ %v S- %v after %d", c.PositiveSum(), c.NegativeSum(), i-N/2)
+		}
+	}
+	// a downward shift of one standard deviation is detected within a few average run lengths
+	var detectedAfter int
+	for i := 0; i < 100; i++ {
+		c.Push(8.0 + 2.0*gaussianTestData[i])
+		if c.ShiftDetected() {
+			detectedAfter = i + 1
+			break
+		}
+	}
+	if detectedAfter == 0 {
+		t.Errorf("Expected a shift of one standard deviation to be detected")
+	}
+	if c.NegativeSum() <= c.PositiveSum() {
+		t.Errorf("Expected the downward shift in the negative sum, got S+ %v S- %v", c.PositiveSum(), c.NegativeSum())
+	}
+	c.Reset()
+	if c.PositiveSum() != 0.0 || c.NegativeSum() != 0.0 || c.ShiftDetected() {
+		t.Errorf("Expected Reset to clear the sums, got S+ %v S- %v", c.PositiveSum(), c.NegativeSum())
+	}
+}
+
+func TestCUSUMSums(t *testing.T) {
+	c := NewCUSUM(0.0, 0.0, 0.5, 2.0) // a zero standard deviation is replaced by 1
+	for _, tc := range []struct {
+		x, positive, negative float64
+		detected              bool
+	}{
+		{1.5, 1.0, 0.0, false},
+		{1.5, 2.0, 0.0, false},
+		{1.5, 3.0, 0.0, true},
+		{-4.0, 0.0, 3.5, true},
+		{0.0, 0.0, 3.0, true},
+	} {
+		c.Add(tc.x)
+		if c.PositiveSum() != tc.positive || c.NegativeSum() != tc.negative || c.ShiftDetected() != tc.detected {
+			t.Errorf("Expected S+ %v S- %v detected %v, got %v %v %v", tc.positive, tc.negative, tc.detected, c.PositiveSum(), c.NegativeSum(), c.ShiftDetected())
+		}
+	}
+}
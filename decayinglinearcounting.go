@@ -0,0 +1,96 @@
+package streamstats
+
+import (
+	"hash"
+	"math"
+	"math/bits"
+	"math/rand"
+	"time"
+)
+
+// decayingLinearCountingSteps is the number of steps per half-life in which the bits are decayed
+const decayingLinearCountingSteps = 32
+
+// DecayingLinearCounting is a LinearCounting whose set bits clear at random over time for an estimate of the
+// recent distinct items, each set bit survives an elapsed time dt with probability 2^(-dt/halfLife) and an item
+// sets its bit again each time it is added, so an item last added one half-life ago is counted about 1/2
+// and Distinct estimates the number of distinct items weighted by the age of their latest occurrence
+// it uses the memory of a LinearCounting and no timestamps, at the cost of accuracy compared to a
+// SlidingHyperLogLog: the random clearing adds binomial noise to the LinearCounting error, about sqrt(n)/n
+// for n weighted items, the bits decay in steps of halfLife/32 so the ages are up to that stale,
+// and the estimate saturates at m ln(m) like any LinearCounting sized by p for the recent items
+type DecayingLinearCounting struct {
+	counter  *LinearCounting
+	halfLife time.Duration
+	last     time.Time  // the time the bits were last decayed
+	started  bool       // whether any items have been added
+	rand     *rand.Rand // the source of randomness, nil for the package level source of math/rand
+}
+
+// NewDecayingLinearCounting returns a new DecayingLinearCounting of size m=2^p the same as NewLinearCounting
+// whose bits decay with the given half-life, which is bounded below by 1ns
+// if r is nil the package level source of math/rand is used
+func NewDecayingLinearCounting(p byte, hash hash.Hash64, halfLife time.Duration, r *rand.Rand) *DecayingLinearCounting {
+	if halfLife < 1 {
+		halfLife = 1
+	}
+	return &DecayingLinearCounting{counter: NewLinearCounting(p, hash), halfLife: halfLife, rand: r}
+}
+
+// Add adds an item at the current time
+func (d *DecayingLinearCounting) Add(item []byte) {
+	d.AddAt(item, time.Now())
+}
+
+// AddAt decays the bits to time t and adds an item, an item earlier than the last decay is added without decay
+func (d *DecayingLinearCounting) AddAt(item []byte, t time.Time) {
+	d.decay(t)
+	d.counter.Add(item)
+}
+
+// Distinct returns the estimated number of recent distinct items at the current time
+func (d *DecayingLinearCounting) Distinct() uint64 {
+	return d.DistinctAt(time.Now())
+}
+
+// DistinctAt decays the bits to time t and returns the estimated number of recent distinct items
+func (d *DecayingLinearCounting) DistinctAt(t time.Time) uint64 {
+	d.decay(t)
+	return d.counter.Distinct()
+}
+
+// HalfLife returns the time over which a set bit clears with probability 1/2
+func (d *DecayingLinearCounting) HalfLife() time.Duration {
+	return d.halfLife
+}
+
+// Reset clears all of the bits
+func (d *DecayingLinearCounting) Reset() {
+	for i := range d.counter.bits {
+		d.counter.bits[i] = 0
+	}
+	d.started = false
+}
+
+// decay clears each set bit with probability 1 - 2^(-dt/halfLife) once the time dt since the last decay
+// is at least a step of the half-life
+func (d *DecayingLinearCounting) decay(t time.Time) {
+	if !d.started {
+		d.last = t
+		d.started = true
+		return
+	}
+	elapsed := t.Sub(d.last)
+	if elapsed <= 0 || elapsed < d.halfLife/decayingLinearCountingSteps {
+		return // an earlier or equal time never decays or moves the last decay, even when a step rounds to 0
+	}
+	survival := math.Exp2(-float64(elapsed) / float64(d.halfLife))
+	for i, word := range d.counter.bits {
+		for w := word; w != 0; w &= w - 1 {
+			if randFloat64(d.rand) >= survival {
+				d.counter.bits[i] &^= 1 << bits.TrailingZeros64(w)
+			}
+		}
+	}
+	d.last = t
+}
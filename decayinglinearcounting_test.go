@@ -0,0 +1,80 @@
+package streamstats
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestDecayingLinearCounting(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	halfLife := time.Minute
+	d := NewDecayingLinearCounting(16, fnv.New64(), halfLife, rand.New(rand.NewSource(42)))
+	if d.HalfLife() != halfLife || d.DistinctAt(start) != 0 {
+		t.Errorf("Expected an empty counter with a half-life of a minute, got %v and %d", d.HalfLife(), d.DistinctAt(start))
+	}
+	items := 8000
+	for i := 0; i < items; i++ {
+		d.AddAt(randomBytes[i], start)
+	}
+	// each half-life halves the estimate
+	for halfLives, expected := range []float64{8000, 4000, 2000, 1000, 500} {
+		at := start.Add(time.Duration(halfLives) * halfLife)
+		if distinct := d.DistinctAt(at); relativeError(distinct, uint64(expected)) > 0.1 {
+			t.Errorf("Expected about %v distinct items after %d half-lives, got %d", expected, halfLives, distinct)
+		}
+	}
+	// the decay is not applied before a step of the half-life has elapsed
+	before := d.DistinctAt(start.Add(4 * halfLife))
+	if after := d.DistinctAt(start.Add(4*halfLife + halfLife/64)); after != before {
+		t.Errorf("Expected no decay within a step of the half-life, got %d and %d", before, after)
+	}
+	// adding the items again restores them
+	for i := 0; i < items; i++ {
+		d.AddAt(randomBytes[i], start.Add(4*halfLife))
+	}
+	if distinct := d.DistinctAt(start.Add(4 * halfLife)); relativeError(distinct, uint64(items)) > 0.05 {
+		t.Errorf("Expected about %d distinct items after adding them again, got %d", items, distinct)
+	}
+	d.Reset()
+	if d.DistinctAt(start) != 0 {
+		t.Errorf("Expected Reset to clear the bits, got %d", d.DistinctAt(start))
+	}
+}
+
+func TestDecayingLinearCountingSteadyState(t *testing.T) {
+	// a constant stream of new items at rate r per second settles at r * halfLife / ln(2) weighted items
+	start := time.Unix(1700000000, 0)
+	halfLife := 10 * time.Second
+	d := NewDecayingLinearCounting(16, fnv.New64(), halfLife, rand.New(rand.NewSource(42)))
+	for i := 0; i < N; i++ {
+		d.AddAt(randomBytes[i], start.Add(time.Duration(i)*time.Second/200)) // 200 items per second
+	}
+	expected := 200.0 * halfLife.Seconds() / 0.6931471805599453
+	if distinct := d.DistinctAt(start.Add(time.Duration(N-1) * time.Second / 200)); relativeError(distinct, uint64(expected)) > 0.1 {
+		t.Errorf("Expected about %v weighted distinct items, got %d", expected, distinct)
+	}
+}
+
+func TestDecayingLinearCountingShortHalfLife(t *testing.T) {
+	// with a half-life under 32ns a step rounds to 0, an earlier time still does not move the last decay back
+	start := time.Unix(1700000000, 0)
+	d := NewDecayingLinearCounting(10, fnv.New64(), 10*time.Nanosecond, rand.New(rand.NewSource(42)))
+	d.AddAt(randomBytes[0], start)
+	d.AddAt(randomBytes[1], start.Add(-time.Second))
+	if !d.last.Equal(start) {
+		t.Errorf("Expected the last decay to stay at %v, got %v", start, d.last)
+	}
+	if distinct := d.DistinctAt(start); distinct != 2 {
+		t.Errorf("Expected 2 distinct items without decay, got %d", distinct)
+	}
+}
+
+func BenchmarkDecayingLinearCountingAddAt(b *testing.B) {
+	d := NewDecayingLinearCounting(12, fnv.New64(), time.Second, rand.New(rand.NewSource(42)))
+	start := time.Unix(1700000000, 0)
+	for i := 0; i < b.N; i++ {
+		d.AddAt(randomBytes[i&mask], start.Add(time.Duration(i)*time.Millisecond))
+	}
+}
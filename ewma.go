@@ -1,9 +1,13 @@
 package streamstats
 
+import "fmt"
+
 // EWMA data structure for exponentially weighted moving average
 type EWMA struct {
 	m      float64
 	lambda float64
+	n      uint64 // the number of observations added
+	nonFinite
 }
 
 // NewEWMA initializes an EWMA with weighting lambda and given initial value
@@ -15,11 +19,53 @@ func NewEWMA(initialValue float64, lambda float64) EWMA {
 }
 
 // Add updates the average value with the stored weight
+// a NaN or infinite x is skipped and counted instead if SetSkipNonFinite is set
 func (e *EWMA) Add(x float64) {
+	if e.skip(x) {
+		return
+	}
 	e.m = (1-e.lambda)*e.m + e.lambda*x
+	e.n++
+}
+
+// SetLambda changes the weighting of subsequent observations without discarding the current average
+// the change takes effect on the next Add, lambda must be strictly between 0 and 1
+func (e *EWMA) SetLambda(lambda float64) error {
+	if !(0.0 < lambda && lambda < 1.0) {
+		return fmt.Errorf("EWMA lambda must be between 0 and 1, got %f", lambda)
+	}
+	e.lambda = lambda
+	return nil
+}
+
+// Lambda returns the weighting of new observations
+func (e *EWMA) Lambda() float64 {
+	return e.lambda
+}
+
+// N returns the number of observations added, not including the initial value
+func (e *EWMA) N() uint64 {
+	return e.n
 }
 
 // Mean returns the exponentially weighted average value
 func (e *EWMA) Mean() float64 {
 	return e.m
 }
+
+// Combine returns an EWMA whose average is the blend of the two averages weighted by wSelf and wOther,
+// e.g. by the number of observations N in each shard, to roll up per-shard EWMAs into an approximate global EWMA
+// this is an approximation since the true EWMA of the interleaved streams depends on the order of the observations
+// the EWMAs must have the same lambda and the weights must be non-negative and not both zero
+func (e *EWMA) Combine(b *EWMA, wSelf, wOther float64) (EWMA, error) {
+	if e.lambda != b.lambda {
+		return EWMA{}, fmt.Errorf("EWMA lambdas do not match %f != %f", e.lambda, b.lambda)
+	}
+	if !(wSelf >= 0.0 && wOther >= 0.0 && wSelf+wOther > 0.0) {
+		return EWMA{}, fmt.Errorf("EWMA weights must be non-negative and not both zero, got %f and %f", wSelf, wOther)
+	}
+	combined := NewEWMA((wSelf*e.m+wOther*b.m)/(wSelf+wOther), e.lambda)
+	combined.n = e.n + b.n
+	combined.nonFinite = e.nonFinite.combine(b.nonFinite)
+	return combined, nil
+}
@@ -1,6 +1,9 @@
 package streamstats
 
-import "testing"
+import (
+	"math"
+	"testing"
+)
 
 func TestEWMA(t *testing.T) {
 	initialVal := 4.0
@@ -43,6 +46,29 @@ func TestEWMA(t *testing.T) {
 	}
 }
 
+func TestEWMASetLambda(t *testing.T) {
+	e := NewEWMA(4.0, 0.5)
+	for _, lambda := range []float64{0.0, 1.0, -0.5, 1.5, math.NaN()} {
+		if err := e.SetLambda(lambda); err == nil {
+			t.Errorf("Expected an error for lambda %v", lambda)
+		}
+	}
+	if e.Lambda() != 0.5 {
+		t.Errorf("Expected an invalid lambda to leave lambda 0.5, got %v", e.Lambda())
+	}
+	if err := e.SetLambda(0.25); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if e.Mean() != 4.0 {
+		t.Errorf("Expected the mean to be kept %f, got %f", 4.0, e.Mean())
+	}
+	e.Add(8.0)
+	expectedVal := 5.0 // the new lambda applies to the next observation
+	if e.Mean() != expectedVal {
+		t.Errorf("expected value %f, got %f", expectedVal, e.Mean())
+	}
+}
+
 func BenchmarkEWMAAdd(b *testing.B) {
 	e := NewEWMA(0.0, 0.5)
 	for i := 0; i < b.N; i++ {
@@ -50,3 +76,59 @@ func BenchmarkEWMAAdd(b *testing.B) {
 	}
 	result = e.Mean() // to avoid optimizing out the loop entirely
 }
+
+func TestEWMACombine(t *testing.T) {
+	a := NewEWMA(0.0, 0.1)
+	b := NewEWMA(0.0, 0.1)
+	for i := 0; i < 1000; i++ {
+		a.Add(1.0 + gaussianTestData[i])
+		b.Add(5.0 + gaussianTestData[i+1000])
+	}
+	combined, err := a.Combine(&b, 3.0, 1.0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (3.0*a.Mean() + b.Mean()) / 4.0; math.Abs(combined.Mean()-expected) > 1e-12 {
+		t.Errorf("Expected weighted Mean %v, got %v", expected, combined.Mean())
+	}
+	if combined.Lambda() != a.Lambda() {
+		t.Errorf("Expected lambda %v, got %v", a.Lambda(), combined.Lambda())
+	}
+	// a zero weight ignores the other EWMA
+	if combined, _ = a.Combine(&b, 1.0, 0.0); combined.Mean() != a.Mean() {
+		t.Errorf("Expected Mean %v with zero weight, got %v", a.Mean(), combined.Mean())
+	}
+	c := NewEWMA(0.0, 0.2)
+	if _, err = a.Combine(&c, 1.0, 1.0); err == nil {
+		t.Errorf("Expected error combining EWMAs with different lambdas")
+	}
+	for _, w := range [][2]float64{{0.0, 0.0}, {-1.0, 2.0}, {1.0, math.NaN()}} {
+		if _, err = a.Combine(&b, w[0], w[1]); err == nil {
+			t.Errorf("Expected error combining with weights %v", w)
+		}
+	}
+}
+
+func TestEWMAN(t *testing.T) {
+	e := NewEWMA(1.0, 0.5)
+	if e.N() != 0 || e.Mean() != 1.0 {
+		t.Errorf("Expected no observations with the initial mean, got N %d Mean %v", e.N(), e.Mean())
+	}
+	e.SetSkipNonFinite(true)
+	for i := 0; i < 10; i++ {
+		e.Add(float64(i))
+	}
+	e.Add(math.NaN())
+	if e.N() != 10 {
+		t.Errorf("Expected 10 observations not counting the skipped, got %d", e.N())
+	}
+	b := NewEWMA(0.0, 0.5)
+	b.Add(1.0)
+	combined, err := e.Combine(&b, float64(e.N()), float64(b.N()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if combined.N() != 11 {
+		t.Errorf("Expected the combined count 11, got %d", combined.N())
+	}
+}
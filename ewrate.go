@@ -0,0 +1,68 @@
+package streamstats
+
+import (
+	"math"
+	"time"
+)
+
+// EWRate is a data structure for an exponentially weighted rate of events per second, e.g. the 1m/5m/15m rates of a meter
+// it holds the exponentially decayed count of events, which decays by exp(-dt/window) over an elapsed time dt,
+// the continuous time equivalent of an EWMA with lambda = 1-exp(-dt/window), so no ticker is required
+// for a steady rate r the decayed count converges to r*window, so the rate starts at zero and
+// approaches the true rate over a few windows
+type EWRate struct {
+	window  float64   // the time constant of the decay in seconds
+	count   float64   // the decayed count of events as of last
+	last    time.Time // the time of the last update
+	started bool      // whether any events have been marked
+}
+
+// NewEWRate returns an EWRate with the given time constant, e.g. time.Minute for a 1m rate
+// the window is bounded below by 1ns
+func NewEWRate(window time.Duration) EWRate {
+	if window < 1 {
+		window = 1
+	}
+	return EWRate{window: window.Seconds()}
+}
+
+// Mark records n events at the current time
+func (r *EWRate) Mark(n uint64) {
+	r.MarkAt(n, time.Now())
+}
+
+// MarkAt records n events at time t, events earlier than the last update are counted at the last update
+func (r *EWRate) MarkAt(n uint64, t time.Time) {
+	r.count = r.decayedCount(t) + float64(n)
+	if !r.started || t.After(r.last) {
+		r.last = t
+		r.started = true
+	}
+}
+
+// Rate returns the exponentially weighted rate of events per second at the current time
+func (r *EWRate) Rate() float64 {
+	return r.RateAt(time.Now())
+}
+
+// RateAt returns the exponentially weighted rate of events per second at time t
+func (r *EWRate) RateAt(t time.Time) float64 {
+	return r.decayedCount(t) / r.window
+}
+
+// Window returns the time constant of the decay
+func (r *EWRate) Window() time.Duration {
+	return time.Duration(r.window * float64(time.Second))
+}
+
+// decayedCount returns the count decayed from the last update to time t
+func (r *EWRate) decayedCount(t time.Time) float64 {
+	if !r.started {
+		return 0.0
+	}
+	dt := t.Sub(r.last).Seconds()
+	if dt <= 0.0 {
+		return r.count
+	}
+	return r.count * math.Exp(-dt/r.window)
+}
@@ -0,0 +1,61 @@
+package streamstats
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestEWRate(t *testing.T) {
+	r := NewEWRate(time.Second)
+	start := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	if r.RateAt(start) != 0.0 {
+		t.Errorf("Expected no rate before any events, got %v", r.RateAt(start))
+	}
+	if r.Window() != time.Second {
+		t.Errorf("Expected Window %v, got %v", time.Second, r.Window())
+	}
+	// 10 events every 100ms is 100 events per second
+	dt := 100 * time.Millisecond
+	var now time.Time
+	for i := 0; i < 200; i++ {
+		now = start.Add(time.Duration(i) * dt)
+		r.MarkAt(10, now)
+	}
+	// in the steady state the decayed count just after a mark is the geometric sum 10/(1-exp(-dt/window))
+	eps := 1e-6
+	expected := 10.0 / (1.0 - math.Exp(-dt.Seconds()))
+	if math.Abs(r.RateAt(now)-expected) > eps {
+		t.Errorf("Expected Rate %v, got %v", expected, r.RateAt(now))
+	}
+	// averaged over the interval between marks the rate is 100 per second
+	var mean float64
+	steps := 100
+	for i := 0; i < steps; i++ {
+		mean += r.RateAt(now.Add(time.Duration(i)*dt/time.Duration(steps))) / float64(steps)
+	}
+	if math.Abs(mean-100.0) > 0.5 {
+		t.Errorf("Expected the mean rate between marks to be 100, got %v", mean)
+	}
+	// without events the rate decays by 1/e every window
+	if decayed := r.RateAt(now.Add(time.Second)); math.Abs(decayed-expected/math.E) > eps {
+		t.Errorf("Expected the Rate to decay to %v, got %v", expected/math.E, decayed)
+	}
+	// events marked out of order are counted without decay
+	r.MarkAt(10, now.Add(-time.Second))
+	if math.Abs(r.RateAt(now)-expected-10.0) > eps {
+		t.Errorf("Expected an out of order Mark to add to the Rate %v, got %v", expected+10.0, r.RateAt(now))
+	}
+}
+
+func TestNewEWRate(t *testing.T) {
+	r := NewEWRate(0)
+	if r.Window() != 1 {
+		t.Errorf("Expected the window to be bounded by 1ns, got %v", r.Window())
+	}
+	r = NewEWRate(time.Minute)
+	r.Mark(1)
+	if r.Rate() <= 0.0 {
+		t.Errorf("Expected a positive Rate after Mark, got %v", r.Rate())
+	}
+}
@@ -0,0 +1,81 @@
+package streamstats
+
+import "hash"
+
+// ExactDistinct is a datastructure for computing count distinct exactly by storing the hash of every item
+// it uses O(N) space but is faster than the sketches for small cardinalities, e.g. under a few hundred,
+// and is exact up to collisions of the 64-bit hash function
+type ExactDistinct struct {
+	hash   hash.Hash64
+	hashes map[uint64]struct{}
+}
+
+// NewExactDistinct returns a pointer to a new empty ExactDistinct using the given hash function
+func NewExactDistinct(hash hash.Hash64) *ExactDistinct {
+	return &ExactDistinct{hash: hash, hashes: make(map[uint64]struct{})}
+}
+
+// Add adds an item to the multiset represented by the ExactDistinct
+func (ed *ExactDistinct) Add(item []byte) {
+	ed.hash.Reset()
+	ed.hash.Write(item)
+	ed.hashes[ed.hash.Sum64()] = struct{}{}
+}
+
+// AddFloat64 adds a float64 value to the multiset represented by the ExactDistinct
+// -0.0 and +0.0 are counted as the same value and all NaNs are counted as a single value
+func (ed *ExactDistinct) AddFloat64(x float64) {
+	ed.Add(float64Bytes(x))
+}
+
+// Distinct returns the number of distinct items in the multiset
+func (ed *ExactDistinct) Distinct() uint64 {
+	return uint64(len(ed.hashes))
+}
+
+// ExpectedError returns the expected relative error of the Distinct estimate, which is always 0
+// ignoring collisions of the 64-bit hash function
+func (ed *ExactDistinct) ExpectedError() float64 {
+	return 0.0
+}
+
+// Reset removes all items from the multiset
+func (ed *ExactDistinct) Reset() {
+	ed.hashes = make(map[uint64]struct{})
+}
+
+// Union returns a new ExactDistinct containing the items in either ExactDistinct
+// the function will return nil and an error if the hash functions mismatch
+func (ed *ExactDistinct) Union(edB *ExactDistinct) (*ExactDistinct, error) {
+	if err := sameHash(ed.hash, edB.hash, "ExactDistinct"); err != nil {
+		return nil, err
+	}
+	combined := &ExactDistinct{hash: ed.hash, hashes: make(map[uint64]struct{}, len(ed.hashes)+len(edB.hashes))}
+	for h := range ed.hashes {
+		combined.hashes[h] = struct{}{}
+	}
+	for h := range edB.hashes {
+		combined.hashes[h] = struct{}{}
+	}
+	return combined, nil
+}
+
+// Combine is an alias of Union
+func (ed *ExactDistinct) Combine(edB *ExactDistinct) (*ExactDistinct, error) {
+	return ed.Union(edB)
+}
+
+// Intersect returns a new ExactDistinct containing only the items in both ExactDistinct
+// the function will return nil and an error if the hash functions mismatch
+func (ed *ExactDistinct) Intersect(edB *ExactDistinct) (*ExactDistinct, error) {
+	if err := sameHash(ed.hash, edB.hash, "ExactDistinct"); err != nil {
+		return nil, err
+	}
+	combined := &ExactDistinct{hash: ed.hash, hashes: make(map[uint64]struct{})}
+	for h := range ed.hashes {
+		if _, ok := edB.hashes[h]; ok {
+			combined.hashes[h] = struct{}{}
+		}
+	}
+	return combined, nil
+}
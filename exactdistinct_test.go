@@ -0,0 +1,197 @@
+package streamstats
+
+import (
+	"hash/fnv"
+	"math"
+	"testing"
+)
+
+// the count distinct data structures are interchangeable
+var (
+	_ Cardinality[*ExactDistinct]  = (*ExactDistinct)(nil)
+	_ Cardinality[*HyperLogLog]    = (*HyperLogLog)(nil)
+	_ Cardinality[*LinearCounting] = (*LinearCounting)(nil)
+	_ Cardinality[*BloomFilter]    = (*BloomFilter)(nil)
+	_ Cardinality[*KMV]            = (*KMV)(nil)
+)
+
+func TestExactDistinct(t *testing.T) {
+	a := NewExactDistinct(fnv.New64())
+	b := NewExactDistinct(fnv.New64())
+	if a.Distinct() != 0 {
+		t.Errorf("Expected an empty ExactDistinct, got %d", a.Distinct())
+	}
+	// A holds the first 300 items and B the last 300 with 100 in common
+	for i := 0; i < 300; i++ {
+		a.Add(randomBytes[i])
+		a.Add(randomBytes[i]) // duplicates are only counted once
+		b.Add(randomBytes[i+200])
+	}
+	if a.Distinct() != 300 || b.Distinct() != 300 {
+		t.Errorf("Expected 300 distinct items, got %d and %d", a.Distinct(), b.Distinct())
+	}
+	union, err := a.Union(b)
+	if err != nil {
+		t.Errorf("ExactDistinct Union failed: %s", err)
+	}
+	if union.Distinct() != 500 {
+		t.Errorf("Expected 500 distinct items in the Union, got %d", union.Distinct())
+	}
+	intersect, err := a.Intersect(b)
+	if err != nil {
+		t.Errorf("ExactDistinct Intersect failed: %s", err)
+	}
+	if intersect.Distinct() != 100 {
+		t.Errorf("Expected 100 distinct items in the Intersect, got %d", intersect.Distinct())
+	}
+	if a.Distinct() != 300 {
+		t.Errorf("Expected Union and Intersect not to modify the inputs, got %d", a.Distinct())
+	}
+	a.AddFloat64(0.0)
+	a.AddFloat64(math.Copysign(0, -1))
+	if a.Distinct() != 301 {
+		t.Errorf("Expected -0.0 and +0.0 to be counted once, got %d", a.Distinct())
+	}
+	a.Reset()
+	if a.Distinct() != 0 {
+		t.Errorf("Expected Reset to empty the ExactDistinct, got %d", a.Distinct())
+	}
+	if _, err = a.Union(NewExactDistinct(fnv.New64a())); err == nil {
+		t.Errorf("Expected Union using two different hash functions to return error")
+	}
+	if _, err = a.Intersect(NewExactDistinct(fnv.New64a())); err == nil {
+		t.Errorf("Expected Intersect using two different hash functions to return error")
+	}
+}
+
+// distinctOf adds the items to any of the count distinct data structures
+func distinctOf[T any](c Cardinality[T], items [][]byte) uint64 {
+	for _, item := range items {
+		c.Add(item)
+	}
+	return c.Distinct()
+}
+
+// combinedDistinctOf adds half of the items to each of a and b and returns the Distinct of their Combine
+func combinedDistinctOf[T Cardinality[T]](a, b T, items [][]byte) (uint64, error) {
+	distinctOf[T](a, items[:len(items)/2])
+	distinctOf[T](b, items[len(items)/2:])
+	combined, err := a.Combine(b)
+	if err != nil {
+		return 0, err
+	}
+	return combined.Distinct(), nil
+}
+
+func TestCardinalityInterface(t *testing.T) {
+	items := randomBytes[:200]
+	exact := distinctOf[*ExactDistinct](NewExactDistinct(fnv.New64()), items)
+	if exact != 200 {
+		t.Errorf("Expected exact cardinality 200, got %d", exact)
+	}
+	var testCases = []struct {
+		name     string
+		distinct uint64
+	}{
+		{"HyperLogLog", distinctOf[*HyperLogLog](NewHyperLogLog(10, fnv.New64()), items)},
+		{"LinearCounting", distinctOf[*LinearCounting](NewLinearCounting(12, fnv.New64()), items)},
+		{"BloomFilter", distinctOf[*BloomFilter](NewBloomFilter(1000, 0.01, fnv.New64()), items)},
+		{"KMV", distinctOf[*KMV](NewKMV(1024, fnv.New64()), items)},
+	}
+	for _, test := range testCases {
+		if math.Abs(float64(test.distinct)-float64(exact)) > 0.1*float64(exact) {
+			t.Errorf("Expected %s cardinality near %d, got %d", test.name, exact, test.distinct)
+		}
+	}
+	// every data structure merges with Combine, the same name as the stats data structures
+	if combined, err := combinedDistinctOf(NewExactDistinct(fnv.New64()), NewExactDistinct(fnv.New64()), items); err != nil || combined != exact {
+		t.Errorf("Expected the Combine of ExactDistinct to have cardinality %d, got %d with error %v", exact, combined, err)
+	}
+	if combined, err := combinedDistinctOf(NewHyperLogLog(10, fnv.New64()), NewHyperLogLog(10, fnv.New64()), items); err != nil || combined != testCases[0].distinct {
+		t.Errorf("Expected the Combine of HyperLogLog to have cardinality %d, got %d with error %v", testCases[0].distinct, combined, err)
+	}
+	if combined, err := combinedDistinctOf(NewLinearCounting(12, fnv.New64()), NewLinearCounting(12, fnv.New64()), items); err != nil || combined != testCases[1].distinct {
+		t.Errorf("Expected the Combine of LinearCounting to have cardinality %d, got %d with error %v", testCases[1].distinct, combined, err)
+	}
+	if combined, err := combinedDistinctOf(NewBloomFilter(1000, 0.01, fnv.New64()), NewBloomFilter(1000, 0.01, fnv.New64()), items); err != nil || combined != testCases[2].distinct {
+		t.Errorf("Expected the Combine of BloomFilter to have cardinality %d, got %d with error %v", testCases[2].distinct, combined, err)
+	}
+	if combined, err := combinedDistinctOf(NewKMV(1024, fnv.New64()), NewKMV(1024, fnv.New64()), items); err != nil || combined != testCases[3].distinct {
+		t.Errorf("Expected the Combine of KMV to have cardinality %d, got %d with error %v", testCases[3].distinct, combined, err)
+	}
+}
+
+func TestDistinctCounter(t *testing.T) {
+	counters := map[string]DistinctCounter{
+		"ExactDistinct":  NewExactDistinct(fnv.New64()),
+		"HyperLogLog":    NewHyperLogLog(10, fnv.New64()),
+		"LinearCounting": NewLinearCounting(12, fnv.New64()),
+		"BloomFilter":    NewBloomFilter(1000, 0.01, fnv.New64()),
+		"KMV":            NewKMV(256, fnv.New64()),
+	}
+	cardinality := 500
+	for name, counter := range counters {
+		for i := 0; i < cardinality; i++ {
+			counter.Add(randomBytes[i])
+		}
+		expectedError := counter.ExpectedError()
+		if math.IsNaN(expectedError) || expectedError < 0.0 || expectedError > 0.1 {
+			t.Errorf("Expected %s ExpectedError in [0, 0.1], got %f", name, expectedError)
+		}
+		// allow three standard deviations
+		actualError := math.Abs(float64(counter.Distinct())-float64(cardinality)) / float64(cardinality)
+		if actualError > 3*expectedError {
+			t.Errorf("Expected %s error %f within 3 * %f", name, actualError, expectedError)
+		}
+	}
+}
+
+func TestNewDistinctCounter(t *testing.T) {
+	var testCases = []struct {
+		expectedMax uint64
+		targetError float64
+		want        string
+	}{
+		{10000, 0.01, "LinearCounting"}, // 4 KiB instead of 16 KiB
+		{1000, 0.05, "LinearCounting"},
+		{0, 0.01, "HyperLogLog"}, // an unknown maximum
+		{1 << 30, 0.01, "HyperLogLog"},
+		{100000, 0.05, "HyperLogLog"}, // the LinearCounting is larger than the HyperLogLog
+	}
+	for _, test := range testCases {
+		counter := NewDistinctCounter(test.expectedMax, test.targetError, fnv.New64())
+		var got string
+		switch c := counter.(type) {
+		case *LinearCounting:
+			got = "LinearCounting"
+			if m := float64(uint64(1) << c.p); linearCountingError(float64(test.expectedMax), m) > test.targetError {
+				t.Errorf("Expected the LinearCounting for %d items to reach error %v", test.expectedMax, test.targetError)
+			}
+		case *HyperLogLog:
+			got = "HyperLogLog"
+			if c.p != HLLPForError(test.targetError) {
+				t.Errorf("Expected a HyperLogLog of precision %d, got %d", HLLPForError(test.targetError), c.p)
+			}
+		}
+		if got != test.want {
+			t.Errorf("Expected a %s for %d items at error %v, got %s", test.want, test.expectedMax, test.targetError, got)
+		}
+		limit := test.expectedMax
+		if limit == 0 || limit > N {
+			limit = N
+		}
+		for i := uint64(0); i < limit; i++ {
+			counter.Add(randomBytes[i])
+		}
+		if relativeError(counter.Distinct(), limit) > 3.0*test.targetError {
+			t.Errorf("Expected the %s Distinct near %d, got %d", got, limit, counter.Distinct())
+		}
+	}
+}
+
+func BenchmarkExactDistinctAdd(b *testing.B) {
+	ed := NewExactDistinct(fnv.New64())
+	for i := 0; i < b.N; i++ {
+		ed.Add(randomBytes[i&mask])
+	}
+}
@@ -0,0 +1,206 @@
+package streamstats
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	minimumGKEpsilon = 1e-6
+	maximumGKEpsilon = 0.5
+)
+
+// GKQuantile is the Greenwald-Khanna epsilon-approximate quantile summary based on
+// Space-Efficient Online Computation of Quantile Summaries
+// Michael Greenwald and Sanjeev Khanna, SIGMOD '01
+// unlike the P2 estimators the quantiles have a guaranteed error, the value returned for the p-quantile
+// has a rank within epsilon*N of the rank p*N of the exact quantile for any input order and distribution
+// it keeps a sorted list of values with bounds on their ranks, using O((1/epsilon) log(epsilon*N)) space
+type GKQuantile struct {
+	epsilon float64
+	n       uint64
+	tuples  []gkTuple // sorted by value
+	nonFinite
+}
+
+// gkTuple is a value of the summary with the difference g between its minimum rank and that of the previous value
+// and the difference delta between its maximum and minimum rank
+type gkTuple struct {
+	v        float64
+	g, delta uint64
+}
+
+// NewGKQuantile returns a pointer to a new empty GKQuantile with rank error at most epsilon*N
+// epsilon is bounded by 1e-6 and 0.5
+func NewGKQuantile(epsilon float64) *GKQuantile {
+	if !(epsilon >= minimumGKEpsilon) { // also NaN
+		epsilon = minimumGKEpsilon
+	} else if epsilon > maximumGKEpsilon {
+		epsilon = maximumGKEpsilon
+	}
+	return &GKQuantile{epsilon: epsilon}
+}
+
+// Add inserts the value x into the summary
+// a NaN or infinite x is skipped and counted instead if SetSkipNonFinite is set, a NaN must not be added otherwise
+func (gk *GKQuantile) Add(x float64) {
+	if gk.skip(x) {
+		return
+	}
+	i := sort.Search(len(gk.tuples), func(j int) bool { return gk.tuples[j].v > x })
+	var delta uint64
+	if i > 0 && i < len(gk.tuples) { // a new minimum or maximum has an exact rank
+		next := gk.tuples[i]
+		delta = next.g + next.delta - 1 // the maximum rank is at most that of the next larger value
+	}
+	gk.tuples = append(gk.tuples, gkTuple{})
+	copy(gk.tuples[i+1:], gk.tuples[i:])
+	gk.tuples[i] = gkTuple{v: x, g: 1, delta: delta}
+	gk.n++
+	if period := uint64(1.0 / (2.0 * gk.epsilon)); period == 0 || gk.n%period == 0 {
+		gk.compress()
+	}
+}
+
+// compress merges each value into the next larger value while the merged rank bounds stay within 2*epsilon*N
+// the minimum and maximum are never merged so they stay exact
+func (gk *GKQuantile) compress() {
+	if len(gk.tuples) < 3 {
+		return
+	}
+	limit := uint64(2.0 * gk.epsilon * float64(gk.n))
+	merged := len(gk.tuples) - 1 // the position of the last kept tuple, merging from the maximum down
+	for i := len(gk.tuples) - 2; i >= 1; i-- {
+		next := gk.tuples[merged]
+		if t := gk.tuples[i]; t.g+next.g+next.delta <= limit {
+			gk.tuples[merged].g += t.g
+			continue
+		}
+		merged--
+		gk.tuples[merged] = gk.tuples[i]
+	}
+	merged--
+	gk.tuples[merged] = gk.tuples[0]
+	gk.tuples = append(gk.tuples[:0], gk.tuples[merged:]...)
+}
+
+// Quantile returns a value whose rank is within epsilon*N of the rank p*N of the exact p-quantile
+// p is bounded by 0 and 1 for the minimum and maximum, and 0 is returned if no values have been seen
+func (gk *GKQuantile) Quantile(p float64) float64 {
+	if len(gk.tuples) == 0 {
+		return 0.0
+	}
+	if p <= 0.0 {
+		return gk.tuples[0].v
+	}
+	if p >= 1.0 {
+		return gk.tuples[len(gk.tuples)-1].v
+	}
+	r := math.Ceil(p * float64(gk.n)) // the target rank
+	// the value whose rank bounds are closest to the target rank is within epsilon*N
+	best, bestError := gk.tuples[0].v, math.Inf(1)
+	var rMin float64
+	for _, t := range gk.tuples {
+		rMin += float64(t.g)
+		if e := math.Max(r-rMin, rMin+float64(t.delta)-r); e < bestError {
+			best, bestError = t.v, e
+		}
+		if rMin > r {
+			break // the rank bounds of the larger values are further from r
+		}
+	}
+	return best
+}
+
+// N returns the number of values seen so far
+func (gk *GKQuantile) N() uint64 {
+	return gk.n
+}
+
+// Epsilon returns the bound on the rank error of the quantiles as a fraction of N
+func (gk *GKQuantile) Epsilon() float64 {
+	return gk.epsilon
+}
+
+// Size returns the number of values kept in the summary
+func (gk *GKQuantile) Size() int {
+	return len(gk.tuples)
+}
+
+// Min returns the minimum value seen so far, or 0 if no values have been seen
+func (gk *GKQuantile) Min() float64 {
+	return gk.Quantile(0.0)
+}
+
+// Max returns the maximum value seen so far, or 0 if no values have been seen
+func (gk *GKQuantile) Max() float64 {
+	return gk.Quantile(1.0)
+}
+
+// Reset removes all values from the summary
+func (gk *GKQuantile) Reset() {
+	gk.n = 0
+	gk.tuples = gk.tuples[:0]
+}
+
+// Combine returns the summary of the values in both GKQuantile, e.g. from parallel streams, with the larger epsilon
+// the rank bounds of each value are the sum of its bounds in its own summary and those of the neighbouring
+// values in the other summary, so the rank error of the combined quantiles is still within epsilon*N
+func (gk *GKQuantile) Combine(b *GKQuantile) *GKQuantile {
+	combined := &GKQuantile{
+		epsilon:   math.Max(gk.epsilon, b.epsilon),
+		n:         gk.n + b.n,
+		tuples:    make([]gkTuple, 0, len(gk.tuples)+len(b.tuples)),
+		nonFinite: gk.nonFinite.combine(b.nonFinite),
+	}
+	aMin, aMax := gkRanks(gk.tuples)
+	bMin, bMax := gkRanks(b.tuples)
+	var prevMin uint64
+	i, j := 0, 0
+	for i < len(gk.tuples) || j < len(b.tuples) {
+		var v float64
+		var rMin, rMax uint64
+		if j == len(b.tuples) || (i < len(gk.tuples) && gk.tuples[i].v <= b.tuples[j].v) {
+			// a value of the receiver, with the values of b before it up to j and after it from j
+			v, rMin, rMax = gk.tuples[i].v, aMin[i], aMax[i]
+			rMin, rMax = rMin+gkRankBefore(bMin, j), rMax+gkRankAfter(bMax, j, b.n)
+			i++
+		} else {
+			v, rMin, rMax = b.tuples[j].v, bMin[j], bMax[j]
+			rMin, rMax = rMin+gkRankBefore(aMin, i), rMax+gkRankAfter(aMax, i, gk.n)
+			j++
+		}
+		combined.tuples = append(combined.tuples, gkTuple{v: v, g: rMin - prevMin, delta: rMax - rMin})
+		prevMin = rMin
+	}
+	combined.compress()
+	return combined
+}
+
+// gkRanks returns the minimum and maximum rank of each of the tuples
+func gkRanks(tuples []gkTuple) (rMin, rMax []uint64) {
+	rMin = make([]uint64, len(tuples))
+	rMax = make([]uint64, len(tuples))
+	var r uint64
+	for i, t := range tuples {
+		r += t.g
+		rMin[i], rMax[i] = r, r+t.delta
+	}
+	return rMin, rMax
+}
+
+// gkRankBefore returns the minimum rank of the value before position j, or 0 if there is none
+func gkRankBefore(rMin []uint64, j int) uint64 {
+	if j == 0 {
+		return 0
+	}
+	return rMin[j-1]
+}
+
+// gkRankAfter returns one less than the maximum rank of the value at position j, or n if there is none
+func gkRankAfter(rMax []uint64, j int, n uint64) uint64 {
+	if j == len(rMax) {
+		return n
+	}
+	return rMax[j] - 1
+}
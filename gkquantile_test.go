@@ -0,0 +1,127 @@
+package streamstats
+
+import (
+	"math"
+	"sort"
+	"testing"
+)
+
+// gkRankError returns the smallest distance of the ranks of x in the sorted values from the rank ceil(p*N)
+func gkRankError(sorted []float64, x, p float64) float64 {
+	r := math.Max(1.0, math.Ceil(p*float64(len(sorted))))
+	lo := float64(sort.SearchFloat64s(sorted, x) + 1) // the ranks of x are lo to hi
+	hi := float64(sort.Search(len(sorted), func(i int) bool { return sorted[i] > x }))
+	switch {
+	case r < lo:
+		return lo - r
+	case r > hi:
+		return r - hi
+	}
+	return 0.0
+}
+
+func TestGKQuantile(t *testing.T) {
+	for _, epsilon := range []float64{0.1, 0.01, 0.001} {
+		for _, data := range []struct {
+			name   string
+			values []float64
+		}{
+			{"gaussian", gaussianTestData[:]},
+			{"sorted", func() []float64 {
+				sorted := append([]float64{}, exponentialTestData[:]...)
+				sort.Float64s(sorted)
+				return sorted
+			}()},
+			{"ties", func() []float64 {
+				ties := make([]float64, N)
+				for i := range ties {
+					ties[i] = math.Floor(uniformTestData[i] * 10.0)
+				}
+				return ties
+			}()},
+		} {
+			gk := NewGKQuantile(epsilon)
+			for _, x := range data.values {
+				gk.Add(x)
+			}
+			sorted := append([]float64{}, data.values...)
+			sort.Float64s(sorted)
+			if gk.N() != uint64(len(sorted)) || gk.Min() != sorted[0] || gk.Max() != sorted[len(sorted)-1] {
+				t.Errorf("Expected %d %s values from %v to %v, got %d from %v to %v", len(sorted), data.name, sorted[0], sorted[len(sorted)-1], gk.N(), gk.Min(), gk.Max())
+			}
+			for p := 0.0; p <= 1.0; p += 0.01 {
+				if e := gkRankError(sorted, gk.Quantile(p), p); e > epsilon*float64(len(sorted)) {
+					t.Errorf("Expected the rank error of the %v quantile of %s values within %v, got %v", p, data.name, epsilon*float64(len(sorted)), e)
+				}
+			}
+			// the summary is much smaller than the data, O((1/epsilon) log(epsilon*N))
+			if maxSize := 11.0 / (2.0 * epsilon) * math.Log2(2.0+2.0*epsilon*float64(len(sorted))); float64(gk.Size()) > maxSize {
+				t.Errorf("Expected at most %v values kept for epsilon %v, got %d", maxSize, epsilon, gk.Size())
+			}
+		}
+	}
+}
+
+func TestGKQuantileCombine(t *testing.T) {
+	epsilon := 0.01
+	a, b := NewGKQuantile(epsilon), NewGKQuantile(epsilon/2.0)
+	for i := 0; i < N; i++ {
+		if i%3 == 0 {
+			a.Add(gaussianTestData[i])
+		} else {
+			b.Add(gaussianTestData[i] + 1.0)
+		}
+	}
+	combined := a.Combine(b)
+	if combined.N() != uint64(N) || combined.Epsilon() != epsilon {
+		t.Errorf("Expected %d values with epsilon %v, got %d with %v", N, epsilon, combined.N(), combined.Epsilon())
+	}
+	sorted := make([]float64, N)
+	for i := range sorted {
+		sorted[i] = gaussianTestData[i]
+		if i%3 != 0 {
+			sorted[i] += 1.0
+		}
+	}
+	sort.Float64s(sorted)
+	for p := 0.0; p <= 1.0; p += 0.01 {
+		if e := gkRankError(sorted, combined.Quantile(p), p); e > epsilon*float64(N) {
+			t.Errorf("Expected the rank error of the combined %v quantile within %v, got %v", p, epsilon*float64(N), e)
+		}
+	}
+	// combining with an empty summary keeps the values
+	empty := NewGKQuantile(epsilon)
+	if same := empty.Combine(a); same.N() != a.N() || same.Min() != a.Min() || same.Max() != a.Max() {
+		t.Errorf("Expected combining with an empty summary to keep the values")
+	}
+}
+
+func TestGKQuantileEdgeCases(t *testing.T) {
+	gk := NewGKQuantile(0.0)
+	if gk.Epsilon() != minimumGKEpsilon || gk.Quantile(0.5) != 0.0 {
+		t.Errorf("Expected the minimum epsilon and 0 for an empty summary, got %v and %v", gk.Epsilon(), gk.Quantile(0.5))
+	}
+	if NewGKQuantile(1.0).Epsilon() != maximumGKEpsilon {
+		t.Errorf("Expected epsilon to be bounded by %v", maximumGKEpsilon)
+	}
+	gk.Add(2.0)
+	if gk.Quantile(0.0) != 2.0 || gk.Quantile(0.5) != 2.0 || gk.Quantile(1.0) != 2.0 {
+		t.Errorf("Expected every quantile of a single value to be the value")
+	}
+	gk.SetSkipNonFinite(true)
+	gk.Add(math.NaN())
+	if gk.N() != 1 || gk.SkippedCount() != 1 {
+		t.Errorf("Expected the NaN to be skipped, got N %d skipped %d", gk.N(), gk.SkippedCount())
+	}
+	gk.Reset()
+	if gk.N() != 0 || gk.Size() != 0 {
+		t.Errorf("Expected Reset to remove all values, got N %d size %d", gk.N(), gk.Size())
+	}
+}
+
+func BenchmarkGKQuantileAdd(b *testing.B) {
+	gk := NewGKQuantile(0.001)
+	for i := 0; i < b.N; i++ {
+		gk.Add(gaussianTestData[i&mask])
+	}
+}
@@ -0,0 +1,172 @@
+package streamstats
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"math"
+	"math/bits"
+)
+
+// HashIdentifier is an optional interface for a hash.Hash64 to identify itself including any seed
+// so that Union and Intersect can reliably check two sketches use identical hash functions
+// two hash functions with equal HashID must return identical hashes for all inputs
+type HashIdentifier interface {
+	HashID() string
+}
+
+// sameHash returns an error if the two hash functions are not identical
+// if both implement HashIdentifier their HashID are compared without modifying either hash function
+// otherwise both hash functions are reset and must return the same hash for the probe string
+func sameHash(a, b hash.Hash64, probe string) error {
+	idA, okA := a.(HashIdentifier)
+	idB, okB := b.(HashIdentifier)
+	if okA && okB {
+		if idA.HashID() != idB.HashID() {
+			return fmt.Errorf("Hash functions are not identical, HashID %q != %q", idA.HashID(), idB.HashID())
+		}
+		return nil
+	}
+	// check that both hash functions get the same result for the probe
+	a.Reset()
+	a.Write([]byte(probe))
+	hashA := a.Sum64()
+	b.Reset()
+	b.Write([]byte(probe))
+	hashB := b.Sum64()
+	if hashA != hashB {
+		return fmt.Errorf("Hash functions are not identical, return %0x != %0x for \"%s\"", hashA, hashB, probe)
+	}
+	return nil
+}
+
+// canonicalNaN is the single bit pattern used to hash every NaN, the quiet NaN with an empty payload
+const canonicalNaN = 0x7FF8000000000000
+
+// float64Bytes returns the canonical big-endian bytes of a float64 for hashing
+// -0.0 is hashed as +0.0 and every NaN, regardless of sign or payload, is hashed as canonicalNaN
+// so that semantically equal values are counted once and all NaNs are counted as a single value
+func float64Bytes(x float64) []byte {
+	var u uint64
+	switch {
+	case math.IsNaN(x):
+		u = canonicalNaN
+	case x == 0:
+		u = 0 // both -0.0 and +0.0
+	default:
+		u = math.Float64bits(x)
+	}
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, u) // the sign and exponent are hashed first
+	return b
+}
+
+// the default secret constants of wyhash final version 4
+const (
+	wyp0 = 0xa0761d6478bd642f
+	wyp1 = 0xe7037ed1a0b428db
+	wyp2 = 0x8ebc6af09c88c6e3
+	wyp3 = 0x589965cc75374cc3
+)
+
+// wyHash64 is a hash.Hash64 that buffers written bytes and hashes them when summed
+type wyHash64 struct {
+	seed uint64
+	buf  []byte
+}
+
+// NewWyHash64 returns a new 64-bit hash.Hash64 of the wyhash algorithm by Wang Yi, final version 4 with its
+// default secret, https://github.com/wangyi-fudan/wyhash, whose output matches the reference test vectors
+// it is dependency free, comparable to FNV for 8 byte items and faster for longer items,
+// with much better mixing of every input byte into the top bits used for the HyperLogLog and LinearCounting buckets
+// the written bytes are buffered until Sum64 so it is best suited to the Reset, Write, Sum64 pattern of the sketches
+func NewWyHash64(seed uint64) hash.Hash64 {
+	return &wyHash64{seed: seed, buf: make([]byte, 0, 64)}
+}
+
+// Write adds more data to the running hash, it never returns an error
+func (w *wyHash64) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	return len(p), nil
+}
+
+// Sum appends the current hash to b in big-endian byte order and returns the resulting slice
+func (w *wyHash64) Sum(b []byte) []byte {
+	s := w.Sum64()
+	return append(b, byte(s>>56), byte(s>>48), byte(s>>40), byte(s>>32), byte(s>>24), byte(s>>16), byte(s>>8), byte(s))
+}
+
+// Reset resets the hash to its initial state
+func (w *wyHash64) Reset() {
+	w.buf = w.buf[:0]
+}
+
+// Size returns the number of bytes Sum will return
+func (w *wyHash64) Size() int {
+	return 8
+}
+
+// BlockSize returns the hash's underlying block size
+func (w *wyHash64) BlockSize() int {
+	return 48
+}
+
+// HashID identifies the hash function and its seed
+func (w *wyHash64) HashID() string {
+	return fmt.Sprintf("wyhash64/%0x", w.seed)
+}
+
+// Sum64 returns the hash of the written bytes
+func (w *wyHash64) Sum64() uint64 {
+	p := w.buf
+	n := uint64(len(p))
+	seed := w.seed ^ wyMix(w.seed^wyp0, wyp1)
+	var a, b uint64
+	switch {
+	case n == 0:
+	case n < 4:
+		a = uint64(p[0])<<16 | uint64(p[n>>1])<<8 | uint64(p[n-1])
+	case n <= 16:
+		a = wyRead4(p)<<32 | wyRead4(p[(n>>3)<<2:])
+		b = wyRead4(p[n-4:])<<32 | wyRead4(p[n-4-((n>>3)<<2):])
+	default:
+		i, off := n, uint64(0)
+		if i > 48 {
+			see1, see2 := seed, seed
+			for i > 48 {
+				seed = wyMix(wyRead8(p[off:])^wyp1, wyRead8(p[off+8:])^seed)
+				see1 = wyMix(wyRead8(p[off+16:])^wyp2, wyRead8(p[off+24:])^see1)
+				see2 = wyMix(wyRead8(p[off+32:])^wyp3, wyRead8(p[off+40:])^see2)
+				off += 48
+				i -= 48
+			}
+			seed ^= see1 ^ see2
+		}
+		for i > 16 {
+			seed = wyMix(wyRead8(p[off:])^wyp1, wyRead8(p[off+8:])^seed)
+			off += 16
+			i -= 16
+		}
+		// the final 16 bytes may overlap bytes already mixed in
+		a = wyRead8(p[off+i-16:])
+		b = wyRead8(p[off+i-8:])
+	}
+	hi, lo := bits.Mul64(a^wyp1, b^seed)
+	return wyMix(lo^wyp0^n, hi^wyp1)
+}
+
+// wyMix returns the xor of the high and low words of the 128-bit product of a and b
+func wyMix(a, b uint64) uint64 {
+	hi, lo := bits.Mul64(a, b)
+	return hi ^ lo
+}
+
+// wyRead8 returns the first 8 bytes of p as a little-endian uint64
+func wyRead8(p []byte) uint64 {
+	return binary.LittleEndian.Uint64(p)
+}
+
+// wyRead4 returns the first 4 bytes of p as a little-endian uint64
+func wyRead4(p []byte) uint64 {
+	return uint64(binary.LittleEndian.Uint32(p))
+}
@@ -0,0 +1,241 @@
+package streamstats
+
+import (
+	"bytes"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"math"
+	"testing"
+)
+
+func TestFloat64Bytes(t *testing.T) {
+	negativeNaN := math.Float64frombits(0xFFF8000000000000)
+	payloadNaN := math.Float64frombits(0x7FF0000000000001)
+	var testCases = []struct {
+		a, b  float64
+		equal bool
+	}{
+		{0.0, math.Copysign(0, -1), true},
+		{math.NaN(), negativeNaN, true},
+		{math.NaN(), payloadNaN, true},
+		{1.0, 1.0, true},
+		{1.0, -1.0, false},
+		{math.Inf(1), math.Inf(-1), false},
+		{math.NaN(), math.Inf(1), false},
+		{0.0, math.SmallestNonzeroFloat64, false},
+	}
+	for _, test := range testCases {
+		if equal := bytes.Equal(float64Bytes(test.a), float64Bytes(test.b)); equal != test.equal {
+			t.Errorf("Expected float64Bytes(%v) == float64Bytes(%v) to be %t, got %t", test.a, test.b, test.equal, equal)
+		}
+	}
+}
+
+func TestAddFloat64(t *testing.T) {
+	values := []float64{0.0, math.Copysign(0, -1), math.NaN(), math.Float64frombits(0xFFF8000000000001), 1.5, 1.5}
+	hll := NewHyperLogLog(10, fnv.New64())
+	lc := NewLinearCounting(10, fnv.New64())
+	bf := NewBloomFilter(100, 0.01, fnv.New64())
+	cbf := NewCountingBloomFilter(100, 0.01, 4, fnv.New64())
+	for _, x := range values {
+		hll.AddFloat64(x)
+		lc.AddFloat64(x)
+		bf.AddFloat64(x)
+		cbf.AddFloat64(x)
+	}
+	// 0.0, NaN and 1.5
+	if hll.Distinct() != 3 {
+		t.Errorf("Expected HyperLogLog to count 3 distinct values, got %d", hll.Distinct())
+	}
+	if lc.Distinct() != 3 {
+		t.Errorf("Expected LinearCounting to count 3 distinct values, got %d", lc.Distinct())
+	}
+	if !bf.CheckFloat64(math.Copysign(0, -1)) || !bf.CheckFloat64(math.Float64frombits(0x7FF0000000000001)) {
+		t.Errorf("Expected -0.0 and every NaN to be in the BloomFilter")
+	}
+	if !cbf.RemoveFloat64(math.Copysign(0, -1)) || !cbf.RemoveFloat64(0.0) {
+		t.Errorf("Expected -0.0 and +0.0 to be removed as the same value from the CountingBloomFilter")
+	}
+	if cbf.CheckFloat64(0.0) {
+		t.Errorf("Expected 0.0 to be removed from the CountingBloomFilter")
+	}
+}
+
+func TestWyHash64(t *testing.T) {
+	h := NewWyHash64(0)
+	if h.Size() != 8 {
+		t.Errorf("Expected Size 8, got %d", h.Size())
+	}
+	// every length takes a different path through Sum64, check the streaming writes match a single write
+	data := make([]byte, 100)
+	testRand.Seed(42)
+	testRand.Read(data)
+	seen := make(map[uint64]int)
+	for n := 0; n <= len(data); n++ {
+		h.Reset()
+		h.Write(data[:n])
+		sum := h.Sum64()
+		h.Reset()
+		h.Write(data[:n/2])
+		h.Write(data[n/2 : n])
+		if h.Sum64() != sum {
+			t.Errorf("Expected streaming writes of %d bytes to hash to %0x, got %0x", n, sum, h.Sum64())
+		}
+		if prev, ok := seen[sum]; ok {
+			t.Errorf("Expected distinct hashes for prefixes of length %d and %d, got %0x", prev, n, sum)
+		}
+		seen[sum] = n
+		b := h.Sum(nil)
+		if len(b) != 8 || uint64(b[0])<<56|uint64(b[7]) != sum&0xFF000000000000FF {
+			t.Errorf("Expected Sum to return the big-endian bytes of %0x, got %v", sum, b)
+		}
+	}
+	h2 := NewWyHash64(1)
+	h.Reset()
+	h.Write(data)
+	h2.Write(data)
+	if h.Sum64() == h2.Sum64() {
+		t.Errorf("Expected different seeds to give different hashes")
+	}
+	// sequential integers should be well mixed into the top bits used for buckets
+	hll := NewHyperLogLog(10, NewWyHash64(0))
+	for i := 0; i < 10000; i++ {
+		hll.AddFloat64(float64(i))
+	}
+	if chiSquared := hll.ChiSquaredUniformity(); chiSquared > 2*float64(64-10) {
+		t.Errorf("Expected a well mixed hash to have a small chi-squared, got %f", chiSquared)
+	}
+}
+
+func TestWyHash64KnownAnswers(t *testing.T) {
+	// the test vectors of the reference wyhash final version 4, each message hashed with its index as the seed
+	var vectors = []struct {
+		message  string
+		expected uint64
+	}{
+		{"", 0x0409638ee2bde459},
+		{"a", 0xa8412d091b5fe0a9},
+		{"abc", 0x32dd92e4b2915153},
+		{"message digest", 0x8619124089a3a16b},
+		{"abcdefghijklmnopqrstuvwxyz", 0x7a43afb61d7f5f40},
+		{"ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789", 0xff42329b90e50d58},
+		{"12345678901234567890123456789012345678901234567890123456789012345678901234567890", 0xc39cab13b115aad3},
+	}
+	for seed, vector := range vectors {
+		h := NewWyHash64(uint64(seed))
+		h.Write([]byte(vector.message))
+		if h.Sum64() != vector.expected {
+			t.Errorf("Expected the hash of %q with seed %d to be %016x, got %016x", vector.message, seed, vector.expected, h.Sum64())
+		}
+	}
+	// the bytes 0, 1, 2, ... for a length on each path through Sum64 from the reference implementation
+	data := make([]byte, 100)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	var testCases = []struct {
+		n             int
+		seed0, seed42 uint64
+	}{
+		{0, 0x0409638ee2bde459, 0x72014e4eed7eeb7d},
+		{3, 0xf971e76c35096d43, 0x5d247effdc833ef7},
+		{4, 0xed0d4340e81b7c4d, 0x83b0eeaf75d246a6},
+		{8, 0xb425a02f871eb75f, 0x36327b59864c912c},
+		{16, 0xff5ae257316b07b5, 0x135a728cd3ef36ad},
+		{17, 0x7ed011944b0c00ad, 0x07a6f9555a8dabad},
+		{48, 0xce6cc055c4aa2354, 0x1a0920f357089738},
+		{100, 0x283276ba3800b507, 0x3c6a53dc13a36060},
+	}
+	for _, test := range testCases {
+		for seed, expected := range map[uint64]uint64{0: test.seed0, 42: test.seed42} {
+			h := NewWyHash64(seed)
+			h.Write(data[:test.n])
+			if h.Sum64() != expected {
+				t.Errorf("Expected the hash of %d bytes with seed %d to be %016x, got %016x", test.n, seed, expected, h.Sum64())
+			}
+		}
+	}
+}
+
+func BenchmarkWyHash64(b *testing.B) {
+	for _, size := range []int{8, 16, 29} {
+		data := make([]byte, size)
+		testRand.Read(data)
+		b.Run(fmt.Sprintf("WyHash64-%d", size), func(b *testing.B) {
+			h := NewWyHash64(0)
+			for i := 0; i < b.N; i++ {
+				h.Reset()
+				h.Write(data)
+				count = h.Sum64()
+			}
+		})
+		b.Run(fmt.Sprintf("FNV64-%d", size), func(b *testing.B) {
+			h := fnv.New64()
+			for i := 0; i < b.N; i++ {
+				h.Reset()
+				h.Write(data)
+				count = h.Sum64()
+			}
+		})
+	}
+}
+
+// taggedHash is a hash with an explicit HashID
+type taggedHash struct {
+	hash.Hash64
+	id string
+}
+
+func (h taggedHash) HashID() string {
+	return h.id
+}
+
+func TestSameHash(t *testing.T) {
+	var testCases = []struct {
+		name string
+		a, b hash.Hash64
+		same bool
+	}{
+		{"fnv", fnv.New64(), fnv.New64(), true},
+		{"fnv and fnva", fnv.New64(), fnv.New64a(), false},
+		{"wyhash", NewWyHash64(7), NewWyHash64(7), true},
+		{"wyhash seeds", NewWyHash64(7), NewWyHash64(8), false},
+		// the HashID takes precedence over the probe
+		{"tagged", taggedHash{fnv.New64(), "a"}, taggedHash{fnv.New64a(), "a"}, true},
+		{"tagged ids", taggedHash{fnv.New64(), "a"}, taggedHash{fnv.New64(), "b"}, false},
+		// a single HashID falls back to the probe
+		{"one tagged", taggedHash{fnv.New64(), "a"}, fnv.New64(), true},
+	}
+	for _, test := range testCases {
+		if err := sameHash(test.a, test.b, "test"); (err == nil) != test.same {
+			t.Errorf("Expected %s same hash to be %t, got error %v", test.name, test.same, err)
+		}
+	}
+	// comparing HashID does not modify the hash state
+	a, b := NewWyHash64(0), NewWyHash64(0)
+	a.Write([]byte("state"))
+	sum := a.Sum64()
+	if err := sameHash(a, b, "test"); err != nil {
+		t.Errorf("Expected identical hashes, got error %s", err)
+	}
+	if a.Sum64() != sum {
+		t.Errorf("Expected sameHash not to modify the hash state %0x, got %0x", sum, a.Sum64())
+	}
+	// the sketches use the HashID check
+	hllA := NewHyperLogLog(8, NewWyHash64(0))
+	hllB := NewHyperLogLog(8, NewWyHash64(1))
+	if _, err := hllA.Union(hllB); err == nil {
+		t.Errorf("Expected Union of HyperLogLog with different HashID to return error")
+	}
+	lcA := NewLinearCounting(8, taggedHash{fnv.New64(), "a"})
+	lcB := NewLinearCounting(8, taggedHash{fnv.New64(), "b"})
+	if _, err := lcA.Intersect(lcB); err == nil {
+		t.Errorf("Expected Intersect of LinearCounting with different HashID to return error")
+	}
+	bfA := NewBloomFilter(100, 0.01, NewWyHash64(0))
+	bfB := NewBloomFilter(100, 0.01, NewWyHash64(0))
+	if _, err := bfA.Union(bfB); err != nil {
+		t.Errorf("Expected Union of BloomFilter with equal HashID to succeed, got error %s", err)
+	}
+}
@@ -9,15 +9,17 @@ import "fmt"
 
 // HyperLogLog a data structure for computing count distinct on arbitrary sized data
 type HyperLogLog struct {
-	hash  hash.Hash64
-	alpha float64
-	p     byte
-	data  []byte
+	hash        hash.Hash64
+	alpha       float64
+	bias        func(raw, C float64) float64 // the bias correction for intermediate estimates, nil for the default
+	p           byte
+	data        registerStore // the registers, one byte each unless packed or sparse
+	ignoreEmpty bool          // skip zero-length items in Add
 }
 
 const (
 	minimumHyperLogLogP = 4
-	maximumHyperLogLogP = 16
+	maximumHyperLogLogP = 18
 )
 
 // NewHyperLogLog returns a new HyperLogLog data structure with 2^p buckets based on
@@ -27,98 +29,277 @@ const (
 // This implementation does not include any of the HyperLogLog++ enhancments except for the 64-bit hash function
 // which eliminates the large cardinality correction for hash collisions
 // this is also space in-efficient since bytes are used to store the counts which could be at most 60 < 2^6
+// p is bounded by 4 and 18, at the maximum p=18 the buckets use 2^18 bytes (256 KiB) for an expected error of ~0.2%
 func NewHyperLogLog(p byte, hash hash.Hash64) *HyperLogLog {
-	// p is bounded by 4 and 16 for practical implementations
+	// p is bounded by 4 and 18 for practical implementations
 	if p < minimumHyperLogLogP {
 		p = minimumHyperLogLogP
 	} else if p > maximumHyperLogLogP {
 		p = maximumHyperLogLogP
 	}
 	m := 1 << p
-	var alpha float64 // the normalization constant dependent on m
+	return &HyperLogLog{
+		hash:  hash,
+		alpha: hyperLogLogAlpha(m),
+		p:     p,
+		data:  make(denseRegisters, m, m),
+	}
+}
+
+// NewHyperLogLogPacked returns a new HyperLogLog data structure with 2^p buckets the same as NewHyperLogLog
+// that packs the buckets in 6 bits each instead of a byte, using 3/4 of the memory at the cost of slower access
+func NewHyperLogLogPacked(p byte, hash hash.Hash64) *HyperLogLog {
+	hll := NewHyperLogLog(p, hash)
+	hll.data = newPackedRegisters(hll.data.len())
+	return hll
+}
+
+// NewHyperLogLogSparse returns a new HyperLogLog data structure with 2^p buckets the same as NewHyperLogLog
+// that stores only the non-zero buckets, using 4 bytes per bucket, until more than threshold are non-zero
+// when it converts to one byte per bucket, so a small multiset uses much less memory than 2^p bytes
+// the sparse buckets use less memory than dense up to a threshold of 2^p/4, which is used if threshold <= 0,
+// a smaller threshold converts sooner and bounds the memory and the slower sparse Add, threshold is bounded above by 2^p
+// the estimates are identical to NewHyperLogLog before and after the conversion
+func NewHyperLogLogSparse(p byte, hash hash.Hash64, threshold int) *HyperLogLog {
+	hll := NewHyperLogLog(p, hash)
+	m := hll.data.len()
+	if threshold <= 0 {
+		threshold = int(m / sparseRegisterBytes)
+	}
+	hll.data = newSparseRegisters(m, threshold)
+	return hll
+}
+
+// LoadRegisters returns a new HyperLogLog data structure with 2^p buckets and the given hash function
+// that uses the given pre-allocated bytes as its registers without copying, e.g. memory mapped from a file
+// the number of bytes must match the number of buckets 2^p, and the registers are aliased so any
+// change to data outside of the HyperLogLog changes its estimates
+func LoadRegisters(p byte, hash hash.Hash64, data []byte) (*HyperLogLog, error) {
+	if p < minimumHyperLogLogP {
+		p = minimumHyperLogLogP
+	} else if p > maximumHyperLogLogP {
+		p = maximumHyperLogLogP
+	}
+	m := 1 << p
+	if len(data) != m {
+		return nil, fmt.Errorf("HyperLogLog of precision p = %d requires %d registers, got %d", p, m, len(data))
+	}
+	return &HyperLogLog{
+		hash:  hash,
+		alpha: hyperLogLogAlpha(m),
+		p:     p,
+		data:  denseRegisters(data),
+	}, nil
+}
+
+// NewHyperLogLogWithRegisters is an alias of LoadRegisters following the naming of the other constructors
+func NewHyperLogLogWithRegisters(p byte, hash hash.Hash64, data []byte) (*HyperLogLog, error) {
+	return LoadRegisters(p, hash, data)
+}
+
+// Registers returns the registers, one byte per bucket, e.g. to persist them for LoadRegisters
+// the returned slice is the live storage of the HyperLogLog and not a copy, so it changes with every Add and
+// writing to it corrupts the estimates, copy it before modifying it or keeping it across Adds
+// packed and sparse registers are not stored one byte per bucket so a HyperLogLog from NewHyperLogLogPacked
+// or NewHyperLogLogSparse returns a copy
+func (hll *HyperLogLog) Registers() []byte {
+	if dense, ok := hll.data.(denseRegisters); ok {
+		return []byte(dense)
+	}
+	registers := make([]byte, hll.data.len())
+	hll.data.each(func(i uint64, v byte) { registers[i] = v })
+	return registers
+}
+
+// IsSparse returns true if the HyperLogLog from NewHyperLogLogSparse stores only its non-zero buckets
+// and false once it has converted to one byte per bucket or if it was not created sparse
+func (hll *HyperLogLog) IsSparse() bool {
+	s, ok := hll.data.(*sparseRegisters)
+	return ok && s.isSparse()
+}
+
+// SparseEntries returns the number of non-zero buckets stored while the HyperLogLog is sparse, or 0 if it is not
+// the HyperLogLog converts to one byte per bucket when this exceeds the threshold of NewHyperLogLogSparse
+func (hll *HyperLogLog) SparseEntries() int {
+	if s, ok := hll.data.(*sparseRegisters); ok {
+		return s.size()
+	}
+	return 0
+}
+
+// hyperLogLogAlpha returns the normalization constant dependent on m
+func hyperLogLogAlpha(m int) float64 {
 	switch {
 	case m == 16:
-		alpha = 0.673
+		return 0.673
 	case m == 32:
-		alpha = 0.697
+		return 0.697
 	case m == 64:
-		alpha = 0.709
-	default:
-		alpha = 0.7213 / (1 + 1.079/float64(m))
+		return 0.709
 	}
-	return &HyperLogLog{
-		hash:  hash,
-		alpha: alpha,
-		p:     p,
-		data:  make([]byte, m, m),
+	return 0.7213 / (1 + 1.079/float64(m))
+}
+
+// SetAlpha overrides the normalization constant of the raw estimate, e.g. to compare estimator variants
+// alpha <= 0 restores the default for the number of buckets
+// the override is kept by Compress, Union and Intersect only when the precision of the receiver is unchanged
+func (hll *HyperLogLog) SetAlpha(alpha float64) {
+	if !(alpha > 0.0) {
+		alpha = hyperLogLogAlpha(1 << hll.p)
 	}
+	hll.alpha = alpha
+}
+
+// SetBiasCorrection overrides the bias correction Distinct and BiasCorrected apply to intermediate estimates
+// the function is given the raw estimate and C = alpha*m and returns the corrected estimate
+// nil restores the default empirical correction, the override is kept by Compress, Union and Intersect
+func (hll *HyperLogLog) SetBiasCorrection(bias func(raw, C float64) float64) {
+	hll.bias = bias
+}
+
+// biasCorrection returns the raw estimate corrected by the custom or default bias correction
+func (hll *HyperLogLog) biasCorrection(raw, C float64) float64 {
+	if hll.bias != nil {
+		return hll.bias(raw, C)
+	}
+	return defaultBiasCorrection(raw, C)
+}
+
+// defaultBiasCorrection applies an empirical bias correction to intermediate values
+func defaultBiasCorrection(raw, C float64) float64 {
+	t := (raw - C) / C
+	return raw - C*(math.Exp(-t)+0.125*t*(t-0.82)*math.Exp(-1.85*t))
+}
+
+// SetIgnoreEmpty sets whether Add skips zero-length items, by default an empty item is hashed like any other
+// so it counts as one distinct item, the setting is kept by Compress, Union and Intersect
+func (hll *HyperLogLog) SetIgnoreEmpty(ignore bool) {
+	hll.ignoreEmpty = ignore
 }
 
 // Add adds an item to the multiset represented by the HyperLogLog
+// a zero-length item is counted as a single distinct item unless SetIgnoreEmpty is set
 func (hll *HyperLogLog) Add(item []byte) {
+	if hll.ignoreEmpty && len(item) == 0 {
+		return
+	}
 
 	hll.hash.Reset()
 	hll.hash.Write(item)
-	hash := hll.hash.Sum64()
-	bucket := hash >> (64 - hll.p) // top p bits are the bucket
-	trailingZeroCount := byte(1)   // the cardinality estimate based on number of zeros
-	for k := 1; int(hash&uint64(1)) != 1 && k <= int((64-hll.p)); k++ {
+	bucket, trailingZeroCount := hyperLogLogRegister(hll.hash.Sum64(), hll.p)
+	// if the new estimate for the bucket is larger update it
+	if trailingZeroCount > hll.data.get(bucket) {
+		hll.data.set(bucket, trailingZeroCount)
+	}
+}
+
+// hyperLogLogRegister returns the bucket of a hash, its top p bits, and the register value of the item
+// one more than the number of trailing zeros of the remaining 64-p bits
+func hyperLogLogRegister(hash uint64, p byte) (bucket uint64, value byte) {
+	bucket = hash >> (64 - p)    // top p bits are the bucket
+	trailingZeroCount := byte(1) // the cardinality estimate based on number of zeros
+	for k := 1; int(hash&uint64(1)) != 1 && k <= int((64-p)); k++ {
 		trailingZeroCount = byte(k) + 1
 		hash = hash >> 1
 	}
-	// if the new estimate for the bucket is larger update it
-	if trailingZeroCount > hll.data[bucket] {
-		hll.data[bucket] = trailingZeroCount
-	}
+	return bucket, trailingZeroCount
+}
+
+// AddFloat64 adds a float64 value to the multiset represented by the HyperLogLog
+// -0.0 and +0.0 are counted as the same value and all NaNs are counted as a single value
+func (hll *HyperLogLog) AddFloat64(x float64) {
+	hll.Add(float64Bytes(x))
 }
 
 // Distinct returns the estimated number of distinct items in the multiset
+// the estimate is clamped to the maximum representable value math.MaxUint64
 func (hll *HyperLogLog) Distinct() uint64 {
 
 	alpha := hll.alpha
 	m := float64(uint64(1 << hll.p))
 	C := alpha * m
-	var sum, zeroCount float64
-	for _, d := range hll.data {
-		sum += inversePowersOfTwo[int(d)]
-		if d == 0 {
-			zeroCount++
-		}
-	}
+	sum, zeroCount := hll.registerSums()
 	rawEstimate := alpha * m * m / sum
 	t := (rawEstimate - C) / C
 	if t < 1.0 && zeroCount > 0 {
 		// Use the linear counting estimate at low values because it has less variance
 		rawEstimate = m * math.Log(m/float64(zeroCount))
 	} else if t < 12.0 {
-		// apply an empirical bias correction to intermediate values
-		rawEstimate = rawEstimate - C*(math.Exp(-t)+0.125*t*(t-0.82)*math.Exp(-1.85*t))
+		// apply a bias correction to intermediate values
+		rawEstimate = hll.biasCorrection(rawEstimate, C)
 	}
-	return uint64(rawEstimate)
+	return roundEstimate(rawEstimate)
 }
 
-// LinearCounting returns the linear counting estimated number of distinct items in the multiset
-func (hll *HyperLogLog) LinearCounting() uint64 {
+// hyperLogLogSmoothBand is the half-width in t = (raw - C)/C of the bands around the thresholds t = 1 and t = 12
+// of Distinct over which DistinctSmooth blends the adjacent estimates
+const hyperLogLogSmoothBand = 0.5
+
+// registerSums returns the sum of 2^-register and the number of zero registers
+// visiting only the non-zero registers, each zero register adds 2^0 = 1 to the sum
+func (hll *HyperLogLog) registerSums() (sum, zeroCount float64) {
+	nonZero := hll.data.each(func(i uint64, v byte) { sum += inversePowersOfTwo[int(v)] })
+	zeroCount = float64(hll.data.len() - nonZero)
+	return sum + zeroCount, zeroCount
+}
 
+// DistinctSmooth returns the estimated number of distinct items in the multiset the same as Distinct
+// except near the thresholds t = 1 and t = 12 where Distinct switches from linear counting to the bias corrected
+// estimate and from the bias corrected to the raw estimate, within 0.5 of a threshold the two adjacent estimates
+// are linearly interpolated so the estimate does not step as the cardinality crosses the threshold
+// the estimate is clamped to the maximum representable value math.MaxUint64
+func (hll *HyperLogLog) DistinctSmooth() uint64 {
 	m := float64(uint64(1 << hll.p))
-	zeroCount := 0
-	for _, d := range hll.data {
-		if d == 0 {
-			zeroCount++
+	sum, zeroCount := hll.registerSums()
+	return roundEstimate(hll.smoothEstimate(hll.alpha*m*m/sum, m, zeroCount))
+}
+
+// smoothEstimate returns the estimate of DistinctSmooth from the raw estimate and the number of zero registers
+func (hll *HyperLogLog) smoothEstimate(rawEstimate, m, zeroCount float64) float64 {
+	C := hll.alpha * m
+	t := (rawEstimate - C) / C
+	linearCounting := func() float64 {
+		if zeroCount == 0 { // linear counting is infinite, so use the bias corrected estimate
+			return hll.biasCorrection(rawEstimate, C)
 		}
+		return m * math.Log(m/zeroCount)
+	}
+	blend := func(low, high, threshold float64) float64 {
+		w := (t - threshold + hyperLogLogSmoothBand) / (2.0 * hyperLogLogSmoothBand)
+		return (1.0-w)*low + w*high
 	}
-	return uint64(m * math.Log(m/float64(zeroCount)))
+	switch {
+	case t < 1.0-hyperLogLogSmoothBand:
+		return linearCounting()
+	case t < 1.0+hyperLogLogSmoothBand:
+		return blend(linearCounting(), hll.biasCorrection(rawEstimate, C), 1.0)
+	case t < 12.0-hyperLogLogSmoothBand:
+		return hll.biasCorrection(rawEstimate, C)
+	case t < 12.0+hyperLogLogSmoothBand:
+		return blend(hll.biasCorrection(rawEstimate, C), rawEstimate, 12.0)
+	}
+	return rawEstimate
+}
+
+// Cardinality is an alias of Distinct, the name used by most other cardinality estimation libraries
+func (hll *HyperLogLog) Cardinality() uint64 {
+	return hll.Distinct()
+}
+
+// LinearCounting returns the linear counting estimated number of distinct items in the multiset
+func (hll *HyperLogLog) LinearCounting() uint64 {
+
+	m := float64(uint64(1 << hll.p))
+	_, zeroCount := hll.registerSums()
+	return roundEstimate(m * math.Log(m/zeroCount))
 }
 
 // RawEstimate returns the raw estimated number of distinct items in the multiset
 func (hll *HyperLogLog) RawEstimate() uint64 {
 
 	m := float64(uint64(1 << hll.p))
-	var sum float64
-	for _, d := range hll.data {
-		sum += math.Pow(2.0, -1.0*float64(d))
-	}
-	return uint64(hll.alpha * m * m / sum)
+	sum, _ := hll.registerSums()
+	return roundEstimate(hll.alpha * m * m / sum)
 }
 
 // BiasCorrected returns the bias corrected estimated number of distinct items in the multiset
@@ -128,13 +309,9 @@ func (hll *HyperLogLog) BiasCorrected() uint64 {
 	m := float64(uint64(1 << hll.p))
 	C := alpha * m
 
-	var sum float64
-	for _, d := range hll.data {
-		sum += math.Pow(2.0, -1.0*float64(d))
-	}
+	sum, _ := hll.registerSums()
 	rawEstimate := (alpha * m * m / sum)
-	t := (rawEstimate - C) / C
-	return uint64(rawEstimate - C*(math.Exp(-t)+0.125*t*(t-0.82)*math.Exp(-1.85*t)))
+	return roundEstimate(hll.biasCorrection(rawEstimate, C))
 }
 
 // ExpectedError returns the estimated error in the number of distinct items in the multiset
@@ -143,11 +320,179 @@ func (hll *HyperLogLog) ExpectedError() float64 {
 	return 1.04 / math.Sqrt(m)
 }
 
+// RegisterHistogram returns the number of buckets holding each value, e.g. many zero buckets
+// at high cardinality indicates a hash function that does not mix the input well
+func (hll *HyperLogLog) RegisterHistogram() [64]uint64 {
+	var histogram [64]uint64
+	nonZero := hll.data.each(func(i uint64, v byte) { histogram[v]++ })
+	histogram[0] = hll.data.len() - nonZero
+	return histogram
+}
+
+// MaxRegister returns the largest value held in any bucket
+func (hll *HyperLogLog) MaxRegister() byte {
+	var max byte
+	hll.data.each(func(i uint64, v byte) {
+		if v > max {
+			max = v
+		}
+	})
+	return max
+}
+
+// ChiSquaredUniformity returns Pearson's chi-squared statistic comparing the histogram of bucket values
+// to the distribution expected from a uniform hash at the estimated cardinality
+// adjacent values are pooled so each has an expected count of at least 5, so the statistic is approximately
+// chi-squared distributed with degrees of freedom one less than the number of pooled values, at most 64-p
+// a statistic much larger than the number of values indicates a broken or low-entropy hash function
+func (hll *HyperLogLog) ChiSquaredUniformity() float64 {
+	histogram := hll.RegisterHistogram()
+	m := float64(hll.data.len())
+	lambda := float64(hll.Distinct()) / m // the expected number of items per bucket
+	maxValue := 65 - int(hll.p)
+	observed := make([]float64, maxValue+1)
+	expected := make([]float64, maxValue+1)
+	var prevCDF float64
+	for d := 0; d <= maxValue; d++ {
+		// the probability a bucket holds at most d is exp(-lambda*2^-d)
+		cdf := 1.0
+		if d < maxValue {
+			cdf = math.Exp(-lambda * inversePowersOfTwo[d])
+		}
+		observed[d] = float64(histogram[d])
+		expected[d] = m * (cdf - prevCDF)
+		prevCDF = cdf
+	}
+	return pooledChiSquared(observed, expected)
+}
+
+// pooledChiSquared returns Pearson's chi-squared statistic for the observed and expected counts
+// pooling adjacent counts until the expected count is at least 5
+func pooledChiSquared(observed, expected []float64) float64 {
+	var chiSquared, o, e float64
+	for i := range observed {
+		o += observed[i]
+		e += expected[i]
+		if e >= 5.0 {
+			chiSquared += (o - e) * (o - e) / e
+			o, e = 0.0, 0.0
+		}
+	}
+	if e > 0.0 { // any remainder is pooled in a final bin
+		chiSquared += (o - e) * (o - e) / e
+	}
+	return chiSquared
+}
+
+// HLLPForError returns the smallest precision p such that the expected error of a HyperLogLog
+// with 2^p buckets, 1.04/sqrt(2^p), is at most the target error
+// the result is bounded by the minimum and maximum p supported by NewHyperLogLog
+func HLLPForError(targetError float64) byte {
+	p := byte(minimumHyperLogLogP)
+	for p < maximumHyperLogLogP && 1.04/math.Sqrt(float64(uint64(1<<p))) > targetError {
+		p++
+	}
+	return p
+}
+
+// HLLMemoryBytes returns the number of bytes used to store the buckets of a HyperLogLog with precision p
+// created by NewHyperLogLog, NewHyperLogLogPacked uses 3/4 as many bytes
+func HLLMemoryBytes(p byte) uint64 {
+	if p < minimumHyperLogLogP {
+		p = minimumHyperLogLogP
+	} else if p > maximumHyperLogLogP {
+		p = maximumHyperLogLogP
+	}
+	return uint64(1 << p) // one byte per bucket
+}
+
 // Reset zeros out the estimated number of distinct items in the multiset
 func (hll *HyperLogLog) Reset() {
-	for i := range hll.data {
-		hll.data[i] = 0
+	hll.data.reset()
+}
+
+// Equal returns true if both HyperLogLog have the same precision and registers
+// the hash functions, alpha and bias correction are not compared
+func (hll *HyperLogLog) Equal(other *HyperLogLog) bool {
+	if hll.p != other.p {
+		return false
 	}
+	// the same number of non-zero registers with the same values means the zero registers match too
+	equal := true
+	nonZero := hll.data.each(func(i uint64, v byte) {
+		equal = equal && other.data.get(i) == v
+	})
+	return equal && other.data.each(func(i uint64, v byte) {}) == nonZero
+}
+
+// hyperLogLogMagic and hyperLogLogEncodingVersion identify the MarshalBinary encoding of a HyperLogLog
+const (
+	hyperLogLogMagic           = "SSHL"
+	hyperLogLogEncodingVersion = 1
+)
+
+// SetHash sets the hash function, e.g. after UnmarshalBinary since the hash function is not encoded
+// it must be identical to the hash function used to add the encoded items
+func (hll *HyperLogLog) SetHash(hash hash.Hash64) {
+	hll.hash = hash
+}
+
+// MarshalBinary encodes the HyperLogLog in a language-neutral layout so sketches built by other implementations
+// of the same register format can be merged with Union, the layout of version 1 is
+//
+//	bytes 0-3     the magic "SSHL" in ASCII
+//	byte  4       the version, 1
+//	byte  5       the precision p, 4 <= p <= 18
+//	bytes 6-      the m = 2^p registers as one unsigned byte each, in bucket order
+//
+// an item with 64-bit hash h is in bucket h >> (64-p), the top p bits, and sets the register to the maximum of its value
+// and 1 plus the number of trailing zeros of the low 64-p bits of h, so each register is at most 65-p, or 0 if empty
+// the hash function, alpha, bias correction and register packing are not encoded
+func (hll *HyperLogLog) MarshalBinary() ([]byte, error) {
+	m := hll.data.len()
+	data := make([]byte, 6+m)
+	copy(data, hyperLogLogMagic)
+	data[4] = hyperLogLogEncodingVersion
+	data[5] = hll.p
+	hll.data.each(func(i uint64, v byte) { data[6+i] = v })
+	return data, nil
+}
+
+// UnmarshalBinary decodes a HyperLogLog in the layout of MarshalBinary replacing the precision and registers of the receiver
+// the hash function, bias correction and register packing of the receiver are kept, and alpha if p is unchanged
+// SetHash must be called before Add, Union or Intersect if the hash function is nil
+// it returns an error without modifying the receiver if the magic, version, p, length or any register is invalid
+func (hll *HyperLogLog) UnmarshalBinary(data []byte) error {
+	if len(data) < 6 || string(data[:4]) != hyperLogLogMagic {
+		return fmt.Errorf("HyperLogLog encoding does not start with the magic %q", hyperLogLogMagic)
+	}
+	if data[4] != hyperLogLogEncodingVersion {
+		return fmt.Errorf("HyperLogLog encoding version %d is not supported", data[4])
+	}
+	p := data[5]
+	if p < minimumHyperLogLogP || p > maximumHyperLogLogP {
+		return fmt.Errorf("HyperLogLog precision p = %d is out of range [%d, %d]", p, minimumHyperLogLogP, maximumHyperLogLogP)
+	}
+	m := uint64(1 << p)
+	if uint64(len(data)-6) != m {
+		return fmt.Errorf("HyperLogLog of precision p = %d requires %d registers, got %d", p, m, len(data)-6)
+	}
+	registers := data[6:]
+	for i, r := range registers {
+		if r > 65-p {
+			return fmt.Errorf("HyperLogLog register %d = %d exceeds the maximum %d for p = %d", i, r, 65-p, p)
+		}
+	}
+	store := newRegisterStoreLike(hll.data, m)
+	for i, r := range registers {
+		store.set(uint64(i), r)
+	}
+	if p != hll.p || hll.alpha == 0.0 {
+		hll.alpha = hyperLogLogAlpha(int(m))
+	}
+	hll.p = p
+	hll.data = store
+	return nil
 }
 
 // Compress produces a new HyperLogLog with reduced size by 2^factor with reduced precision
@@ -161,32 +506,52 @@ func (hll *HyperLogLog) Compress(factor byte) *HyperLogLog {
 		p = minimumHyperLogLogP
 	}
 	newHLL := NewHyperLogLog(p, hll.hash)
+	newHLL.data = newRegisterStoreLike(hll.data, newHLL.data.len())
+	newHLL.bias, newHLL.ignoreEmpty = hll.bias, hll.ignoreEmpty
+	if p == hll.p {
+		newHLL.alpha = hll.alpha
+	}
 	// populate new hll by taking max over the stride length
-	newM := (1 << p)
-	strideLength := (1 << (hll.p - p))
-	for i := 0; i < newM; i++ {
-		for j := 0; j < strideLength; j++ {
-			if newHLL.data[i] < hll.data[i*strideLength+j] {
-				newHLL.data[i] = hll.data[i*strideLength+j]
+	newM := uint64(1 << p)
+	strideLength := uint64(1 << (hll.p - p))
+	for i := uint64(0); i < newM; i++ {
+		for j := uint64(0); j < strideLength; j++ {
+			if d := hll.data.get(i*strideLength + j); newHLL.data.get(i) < d {
+				newHLL.data.set(i, d)
 			}
 		}
 	}
 	return newHLL
 }
 
+// CompressInPlace reduces the size of the HyperLogLog by 2^factor the same as Compress but by folding the registers
+// into the receiver instead of allocating a new HyperLogLog, e.g. to archive a high precision HyperLogLog
+// if new p < minimumHyperLogLogP, p=minimumHyperLogLogP, and if the precision is unchanged the HyperLogLog is unchanged
+// the registers are kept in the start of the existing storage, so registers passed to NewHyperLogLogWithRegisters
+// hold the folded registers in their first 2^p bytes and the remaining bytes are no longer used
+func (hll *HyperLogLog) CompressInPlace(factor byte) {
+	var p byte
+	if hll.p > factor {
+		p = hll.p - factor
+	}
+	if p < minimumHyperLogLogP {
+		p = minimumHyperLogLogP
+	}
+	if p == hll.p {
+		return
+	}
+	newM := uint64(1 << p)
+	hll.data = hll.data.fold(uint64(1<<(hll.p-p)), newM)
+	hll.p = p
+	hll.alpha = hyperLogLogAlpha(int(newM))
+}
+
 // Union the estimate of two HyperLogLog reducing the precision to the minimum of the two sets
 // the function will return nil and an error if the hash functions mismatch
 func (hll *HyperLogLog) Union(hllB *HyperLogLog) (*HyperLogLog, error) {
 
-	// check that both hash functions get the same result for "HyperLogLog"
-	hll.hash.Reset()
-	hll.hash.Write([]byte("HyperLogLog"))
-	hash := hll.hash.Sum64()
-	hllB.hash.Reset()
-	hllB.hash.Write([]byte("HyperLogLog"))
-	hashB := hllB.hash.Sum64()
-	if hash != hashB {
-		return nil, fmt.Errorf("Hash functions are not identical, return %0x != %0x for \"HyperLogLog\"", hash, hashB)
+	if err := sameHash(hll.hash, hllB.hash, "HyperLogLog"); err != nil {
+		return nil, err
 	}
 	// determine if either precision needs to be reduced
 	var combinedP byte
@@ -208,30 +573,30 @@ func (hll *HyperLogLog) Union(hllB *HyperLogLog) (*HyperLogLog, error) {
 	}
 	// for each bucket take the max value from the two Hyperloglog
 	combinedHLL = NewHyperLogLog(combinedP, hll.hash)
-	for i := range combinedHLL.data {
-		if hll1.data[i] > hll2.data[i] {
-			combinedHLL.data[i] = hll1.data[i]
-		} else {
-			combinedHLL.data[i] = hll2.data[i]
+	combinedHLL.alpha, combinedHLL.bias = hll1.alpha, hll1.bias // keep the overrides of the receiver
+	combinedHLL.ignoreEmpty = hll.ignoreEmpty
+	combinedHLL.data = newRegisterStoreLike(hll.data, combinedHLL.data.len())
+	hll1.data.each(combinedHLL.data.set)
+	hll2.data.each(func(i uint64, v byte) {
+		if v > combinedHLL.data.get(i) {
+			combinedHLL.data.set(i, v)
 		}
-	}
+	})
 	return combinedHLL, nil
 }
 
+// Combine is an alias of Union
+func (hll *HyperLogLog) Combine(hllB *HyperLogLog) (*HyperLogLog, error) {
+	return hll.Union(hllB)
+}
+
 // Intersect the estimate of two HyperLogLog reducing the precision to the minimum of the two sets
 // the function will return nil and an error if the hash functions mismatch
 // Intersect will always overestimate the size of the intersection
 func (hll *HyperLogLog) Intersect(hllB *HyperLogLog) (*HyperLogLog, error) {
 
-	// check that both hash functions get the same result for "HyperLogLog"
-	hll.hash.Reset()
-	hll.hash.Write([]byte("HyperLogLog"))
-	hash := hll.hash.Sum64()
-	hllB.hash.Reset()
-	hllB.hash.Write([]byte("HyperLogLog"))
-	hashB := hllB.hash.Sum64()
-	if hash != hashB {
-		return nil, fmt.Errorf("Hash functions are not identical, return %0x != %0x for \"HyperLogLog\"", hash, hashB)
+	if err := sameHash(hll.hash, hllB.hash, "HyperLogLog"); err != nil {
+		return nil, err
 	}
 	// determine if either precision needs to be reduced
 	var combinedP byte
@@ -253,13 +618,14 @@ func (hll *HyperLogLog) Intersect(hllB *HyperLogLog) (*HyperLogLog, error) {
 	}
 	// for each bucket take the min value from the two Hyperloglog
 	combinedHLL = NewHyperLogLog(combinedP, hll.hash)
-	for i := range combinedHLL.data {
-		if hll1.data[i] > hll2.data[i] {
-			combinedHLL.data[i] = hll2.data[i]
-		} else {
-			combinedHLL.data[i] = hll1.data[i]
+	combinedHLL.alpha, combinedHLL.bias = hll1.alpha, hll1.bias // keep the overrides of the receiver
+	combinedHLL.ignoreEmpty = hll.ignoreEmpty
+	combinedHLL.data = newRegisterStoreLike(hll.data, combinedHLL.data.len())
+	hll1.data.each(func(i uint64, v byte) {
+		if d2 := hll2.data.get(i); d2 != 0 {
+			combinedHLL.data.set(i, min(v, d2))
 		}
-	}
+	})
 	return combinedHLL, nil
 }
 
@@ -3,19 +3,29 @@ package streamstats
 import (
 	"encoding/binary"
 	"fmt"
+	"hash"
 	"hash/fnv"
 	"math"
-	"math/rand"
+	"math/bits"
 	"testing"
 )
 
+// topBitClearedHash is a poor hash that never sets the top bit so half of the buckets are never used
+type topBitClearedHash struct {
+	hash.Hash64
+}
+
+func (h topBitClearedHash) Sum64() uint64 {
+	return h.Hash64.Sum64() &^ (1 << 63)
+}
+
 func TestNewHyperLogLog(t *testing.T) {
 	for p := byte(minimumHyperLogLogP); p <= maximumHyperLogLogP; p++ {
 
 		hll := NewHyperLogLog(p, fnv.New64())
 		m := uint64(1 << p)
-		if uint64(len(hll.data)) != m {
-			t.Errorf("Expected data to be length %d, got %d\n", m, len(hll.data))
+		if hll.data.len() != m {
+			t.Errorf("Expected data to be length %d, got %d\n", m, hll.data.len())
 		}
 		expectedError := 1.04 / math.Sqrt(float64(m))
 		if expectedError != hll.ExpectedError() {
@@ -32,6 +42,171 @@ func TestNewHyperLogLog(t *testing.T) {
 	}
 }
 
+func TestHyperLogLogMaximumP(t *testing.T) {
+	hll := NewHyperLogLog(18, fnv.New64())
+	if hll.data.len() != 1<<18 {
+		t.Errorf("Expected 2^18 buckets at p=18, got %d", hll.data.len())
+	}
+	if HLLMemoryBytes(18) != 1<<18 {
+		t.Errorf("Expected 2^18 bytes at p=18, got %d", HLLMemoryBytes(18))
+	}
+	testRand.Seed(42)
+	cardinality := uint64(1000000)
+	b := make([]byte, 8)
+	for i := uint64(0); i < cardinality; i++ {
+		binary.LittleEndian.PutUint64(b, testRand.Uint64())
+		hll.Add(b)
+	}
+	// allow three standard deviations of the expected error
+	expectedError := 3 * hll.ExpectedError()
+	actualError := math.Abs(float64(hll.Distinct())-float64(cardinality)) / float64(cardinality)
+	if actualError > expectedError {
+		t.Errorf("Expected cardinality %d, got %d", cardinality, hll.Distinct())
+		t.Errorf("Expected error %f, got %f", expectedError, actualError)
+	}
+}
+
+func TestHyperLogLogSizing(t *testing.T) {
+	var testCases = []struct {
+		targetError float64
+		want        byte
+	}{
+		{1.0, minimumHyperLogLogP},
+		{0.26, minimumHyperLogLogP}, // 1.04/sqrt(16) = 0.26
+		{0.25, 5},
+		{0.05, 9},
+		{0.0325, 10}, // 1.04/sqrt(1024) = 0.0325
+		{0.01, 14},
+		{0.003, 17},
+		{0.0025, 18}, // 1.04/sqrt(2^18) = 0.002
+		{0.0001, maximumHyperLogLogP},
+	}
+	for _, test := range testCases {
+		p := HLLPForError(test.targetError)
+		if p != test.want {
+			t.Errorf("Expected HLLPForError(%f) = %d, got %d", test.targetError, test.want, p)
+		}
+		hll := NewHyperLogLog(p, fnv.New64())
+		if hll.ExpectedError() > test.targetError && p < maximumHyperLogLogP {
+			t.Errorf("Expected error %f to be at most the target %f", hll.ExpectedError(), test.targetError)
+		}
+		if HLLMemoryBytes(p) != hll.data.len() {
+			t.Errorf("Expected HLLMemoryBytes(%d) = %d, got %d", p, hll.data.len(), HLLMemoryBytes(p))
+		}
+	}
+	if HLLMemoryBytes(minimumHyperLogLogP-1) != 1<<minimumHyperLogLogP {
+		t.Errorf("Expected HLLMemoryBytes to be bounded by the minimum p, got %d", HLLMemoryBytes(minimumHyperLogLogP-1))
+	}
+	if HLLMemoryBytes(maximumHyperLogLogP+1) != 1<<maximumHyperLogLogP {
+		t.Errorf("Expected HLLMemoryBytes to be bounded by the maximum p, got %d", HLLMemoryBytes(maximumHyperLogLogP+1))
+	}
+}
+
+func TestHyperLogLogRegisterHistogram(t *testing.T) {
+	p := byte(8)
+	hll := NewHyperLogLog(p, fnv.New64())
+	histogram := hll.RegisterHistogram()
+	if histogram[0] != 1<<p {
+		t.Errorf("Expected all %d buckets to be zero, got %d", 1<<p, histogram[0])
+	}
+	if hll.MaxRegister() != 0 {
+		t.Errorf("Expected MaxRegister of zero, got %d", hll.MaxRegister())
+	}
+	for i := 0; i < N; i++ {
+		hll.Add(randomBytes[i])
+	}
+	histogram = hll.RegisterHistogram()
+	var total uint64
+	var max byte
+	for d, count := range histogram {
+		total += count
+		if count > 0 {
+			max = byte(d)
+		}
+	}
+	if total != 1<<p {
+		t.Errorf("Expected histogram to count all %d buckets, got %d", 1<<p, total)
+	}
+	if hll.MaxRegister() != max {
+		t.Errorf("Expected MaxRegister %d, got %d", max, hll.MaxRegister())
+	}
+	// at N >> m no bucket should be empty and the mode should be near log2(N/m)+1
+	if histogram[0] != 0 {
+		t.Errorf("Expected no zero buckets at high cardinality, got %d", histogram[0])
+	}
+	mode := 0
+	for d := range histogram {
+		if histogram[d] > histogram[mode] {
+			mode = d
+		}
+	}
+	if mode < 6 || mode > 8 {
+		t.Errorf("Expected most buckets to hold ~log2(N/m)+1=7, got %d", mode)
+	}
+}
+
+func TestHyperLogLogChiSquaredUniformity(t *testing.T) {
+	p := byte(10)
+	hll := NewHyperLogLog(p, fnv.New64())
+	if hll.ChiSquaredUniformity() != 0.0 {
+		t.Errorf("Expected an empty HyperLogLog to have a chi-squared of zero, got %f", hll.ChiSquaredUniformity())
+	}
+	poor := NewHyperLogLog(p, topBitClearedHash{fnv.New64()})
+	for i := 0; i < 10000; i++ {
+		hll.Add(randomBytes[i])
+		poor.Add(randomBytes[i])
+	}
+	// the pooled statistic has at most 64-p degrees of freedom
+	if chiSquared := hll.ChiSquaredUniformity(); chiSquared > 2*float64(64-p) {
+		t.Errorf("Expected a good hash to have a small chi-squared, got %f", chiSquared)
+	}
+	if chiSquared := poor.ChiSquaredUniformity(); chiSquared < 10*float64(64-p) {
+		t.Errorf("Expected a poor hash to have a large chi-squared, got %f", chiSquared)
+	}
+}
+
+func TestHyperLogLogSaturated(t *testing.T) {
+	for _, p := range []byte{minimumHyperLogLogP, 10, maximumHyperLogLogP} {
+		hll := NewHyperLogLog(p, fnv.New64())
+		for i := uint64(0); i < hll.data.len(); i++ {
+			hll.data.set(i, 65-p) // the maximum value a bucket can hold
+		}
+		if hll.Distinct() != math.MaxUint64 {
+			t.Errorf("Expected p=%d Distinct to saturate at %d, got %d", p, uint64(math.MaxUint64), hll.Distinct())
+		}
+		if hll.RawEstimate() != math.MaxUint64 {
+			t.Errorf("Expected p=%d RawEstimate to saturate at %d, got %d", p, uint64(math.MaxUint64), hll.RawEstimate())
+		}
+		if hll.BiasCorrected() != math.MaxUint64 {
+			t.Errorf("Expected p=%d BiasCorrected to saturate at %d, got %d", p, uint64(math.MaxUint64), hll.BiasCorrected())
+		}
+		// one less than the maximum is still representable and must not wrap around
+		for i := uint64(0); i < hll.data.len(); i++ {
+			hll.data.set(i, 64-p)
+		}
+		if hll.Distinct() < 1<<62 {
+			t.Errorf("Expected p=%d Distinct near 2^64, got %d", p, hll.Distinct())
+		}
+	}
+	var testCases = []struct {
+		estimate float64
+		want     uint64
+	}{
+		{-1.0, 0},
+		{math.NaN(), 0},
+		{1.4, 1},
+		{1.5, 2},
+		{math.Inf(1), math.MaxUint64},
+		{math.Ldexp(1, 64), math.MaxUint64},
+		{math.Ldexp(1, 63), 1 << 63},
+	}
+	for _, test := range testCases {
+		if got := roundEstimate(test.estimate); got != test.want {
+			t.Errorf("Expected roundEstimate(%v) = %d, got %d", test.estimate, test.want, got)
+		}
+	}
+}
+
 func TestHyperLogLogDistinctInts(t *testing.T) {
 	p := byte(5)
 	hll := NewHyperLogLog(p, fnv.New64())
@@ -48,8 +223,8 @@ func TestHyperLogLogDistinctInts(t *testing.T) {
 		t.Errorf("Expected error %f, got %f\n", expectedError, actualError)
 	}
 	hll.Reset()
-	for _, val := range hll.data {
-		if val != 0 {
+	for i := uint64(0); i < hll.data.len(); i++ {
+		if val := hll.data.get(i); val != 0 {
 			t.Errorf("Expected reset to zero the data, got %0x", val)
 		}
 	}
@@ -59,10 +234,10 @@ func TestHyperLogLogDistinctPRNG(t *testing.T) {
 	p := byte(5)
 	hll := NewHyperLogLog(p, fnv.New64())
 	cardinality := uint64(1000000)
-	rand.Seed(42)
+	testRand.Seed(42)
 	for i := uint64(0); i < cardinality; i++ {
 		b := make([]byte, 8)
-		rand.Read(b)
+		testRand.Read(b)
 		hll.Add(b)
 	}
 	N := hll.Distinct()
@@ -83,10 +258,10 @@ func TestHyperLogLogEstimates(t *testing.T) {
 	p := byte(5)
 	m := uint64(1 << p)
 	hll := NewHyperLogLog(p, fnv.New64())
-	rand.Seed(42)
+	testRand.Seed(42)
 	for i := uint64(0); i < uint64(p); i++ {
 		b := make([]byte, 8)
-		rand.Read(b)
+		testRand.Read(b)
 		hll.Add(b)
 	}
 	// in the low regime should use linear counting
@@ -95,7 +270,7 @@ func TestHyperLogLogEstimates(t *testing.T) {
 	}
 	for i := uint64(0); i < 2*m; i++ {
 		b := make([]byte, 8)
-		rand.Read(b)
+		testRand.Read(b)
 		hll.Add(b)
 	}
 	// in the middle regime should use bias correction
@@ -104,7 +279,7 @@ func TestHyperLogLogEstimates(t *testing.T) {
 	}
 	for i := uint64(0); i < 8*m; i++ {
 		b := make([]byte, 8)
-		rand.Read(b)
+		testRand.Read(b)
 		hll.Add(b)
 	}
 	// in the high regime should use raw estimate
@@ -113,13 +288,129 @@ func TestHyperLogLogEstimates(t *testing.T) {
 	}
 }
 
+func TestHyperLogLogDistinctSmooth(t *testing.T) {
+	hll := NewHyperLogLog(10, fnv.New64())
+	m := float64(uint64(1) << 10)
+	C := hll.alpha * m
+	zeroCount := 100.0
+	// the smoothed estimate is continuous across the thresholds and band edges, and matches Distinct outside the bands
+	for _, tc := range []struct {
+		t        float64
+		expected float64
+	}{
+		{0.25, m * math.Log(m/zeroCount)},
+		{0.5, m * math.Log(m/zeroCount)},
+		{1.5, hll.biasCorrection(2.5*C, C)},
+		{6.0, hll.biasCorrection(7.0*C, C)},
+		{11.5, hll.biasCorrection(12.5*C, C)},
+		{12.5, 13.5 * C},
+		{20.0, 21.0 * C},
+	} {
+		raw := (1.0 + tc.t) * C
+		if smooth := hll.smoothEstimate(raw, m, zeroCount); math.Abs(smooth-tc.expected) > 1e-9*tc.expected {
+			t.Errorf("Expected the smoothed estimate %v at t = %v, got %v", tc.expected, tc.t, smooth)
+		}
+	}
+	for _, threshold := range []float64{1.0 - hyperLogLogSmoothBand, 1.0, 1.0 + hyperLogLogSmoothBand, 12.0 - hyperLogLogSmoothBand, 12.0, 12.0 + hyperLogLogSmoothBand} {
+		below := hll.smoothEstimate((1.0+threshold-1e-9)*C, m, zeroCount)
+		above := hll.smoothEstimate((1.0+threshold+1e-9)*C, m, zeroCount)
+		if math.Abs(above-below) > 1e-6*below {
+			t.Errorf("Expected a continuous estimate at t = %v, got %v and %v", threshold, below, above)
+		}
+	}
+	// the switch in Distinct steps by the difference of the estimators at t = 1, which is smoothed over the band
+	below := hll.smoothEstimate((2.0-1e-9)*C, m, zeroCount)
+	if middle := (m*math.Log(m/zeroCount) + hll.biasCorrection(2.0*C, C)) / 2.0; math.Abs(below-middle) > 1e-6*middle {
+		t.Errorf("Expected the midpoint of the estimators %v at t = 1, got %v", middle, below)
+	}
+	// with no zero registers linear counting is not used
+	if smooth := hll.smoothEstimate(1.75*C, m, 0.0); smooth != hll.biasCorrection(1.75*C, C) {
+		t.Errorf("Expected the bias corrected estimate without zero registers, got %v", smooth)
+	}
+	for i := 0; i < N; i++ {
+		hll.Add(randomBytes[i])
+		sum, zeros := hll.registerSums()
+		tt := (hll.alpha*m*m/sum - C) / C
+		if math.Abs(tt-1.0) > hyperLogLogSmoothBand && math.Abs(tt-12.0) > hyperLogLogSmoothBand && zeros > 0 && hll.DistinctSmooth() != hll.Distinct() {
+			t.Fatalf("Expected DistinctSmooth %d to equal Distinct outside the bands at t = %v, got %d", hll.Distinct(), tt, hll.DistinctSmooth())
+		}
+	}
+	if relativeError(hll.DistinctSmooth(), uint64(N)) > 3.0*hll.ExpectedError() {
+		t.Errorf("Expected DistinctSmooth near %d, got %d", N, hll.DistinctSmooth())
+	}
+}
+
+func TestHyperLogLogOverrides(t *testing.T) {
+	p := byte(5)
+	m := uint64(1 << p)
+	hll := NewHyperLogLog(p, fnv.New64())
+	for i := uint64(0); i < 2*m; i++ {
+		hll.Add(randomBytes[i])
+	}
+	defaultAlpha := hll.alpha
+	raw := hll.RawEstimate()
+	hll.SetAlpha(2 * defaultAlpha)
+	if doubled := hll.RawEstimate(); doubled < 2*raw || doubled > 2*raw+1 {
+		t.Errorf("Expected doubling alpha to double the RawEstimate %d, got %d", 2*raw, doubled)
+	}
+	if hll.Compress(0).alpha != 2*defaultAlpha {
+		t.Errorf("Expected Compress to keep the custom alpha at the same precision")
+	}
+	if hll.Compress(1).alpha != hyperLogLogAlpha(int(m/2)) {
+		t.Errorf("Expected Compress to use the default alpha at a lower precision")
+	}
+	hll.SetAlpha(0.0)
+	if hll.alpha != defaultAlpha {
+		t.Errorf("Expected SetAlpha(0) to restore the default %v, got %v", defaultAlpha, hll.alpha)
+	}
+	// the identity bias correction leaves intermediate estimates raw
+	hll.SetBiasCorrection(func(raw, C float64) float64 { return raw })
+	if hll.BiasCorrected() != raw {
+		t.Errorf("Expected the identity bias correction to return the RawEstimate %d, got %d", raw, hll.BiasCorrected())
+	}
+	if hll.Distinct() != raw {
+		t.Errorf("Expected Distinct to use the custom bias correction %d, got %d", raw, hll.Distinct())
+	}
+	union, err := hll.Union(NewHyperLogLog(p, fnv.New64()))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if union.Distinct() != raw {
+		t.Errorf("Expected Union to keep the custom bias correction %d, got %d", raw, union.Distinct())
+	}
+	hll.SetBiasCorrection(nil)
+	if hll.Distinct() == raw {
+		t.Errorf("Expected SetBiasCorrection(nil) to restore the default correction")
+	}
+}
+
+func TestHyperLogLogEqual(t *testing.T) {
+	a := NewHyperLogLog(10, fnv.New64())
+	b := NewHyperLogLog(10, fnv.New64a())
+	for i := 0; i < 1000; i++ {
+		a.Add(randomBytes[i])
+	}
+	if a.Equal(b) {
+		t.Errorf("Expected HyperLogLog with different registers not to be equal")
+	}
+	for i := uint64(0); i < a.data.len(); i++ {
+		b.data.set(i, a.data.get(i))
+	}
+	if !a.Equal(b) {
+		t.Errorf("Expected HyperLogLog with the same registers to be equal")
+	}
+	if a.Equal(a.Compress(1)) {
+		t.Errorf("Expected HyperLogLog with different precision not to be equal")
+	}
+}
+
 func TestHyperLogLogCompress(t *testing.T) {
 	p := byte(7)
 	hll := NewHyperLogLog(p, fnv.New64())
 	m := byte(1 << p)
 	// populate the hll with consecutive integers in the bins
 	for i := byte(0); i < m; i++ {
-		hll.data[i] = i
+		hll.data.set(uint64(i), i)
 	}
 
 	// reduce the precision
@@ -132,8 +423,8 @@ func TestHyperLogLogCompress(t *testing.T) {
 	newM := byte(p >> factor)
 	stride := factor
 	for i := byte(0); i < newM; i++ {
-		if reducedHll.data[i] != (i+1)*stride-1 {
-			t.Errorf("Expected max over the bin %d got %d", i*stride, reducedHll.data[i])
+		if reducedHll.data.get(uint64(i)) != (i+1)*stride-1 {
+			t.Errorf("Expected max over the bin %d got %d", i*stride, reducedHll.data.get(uint64(i)))
 		}
 	}
 
@@ -144,6 +435,40 @@ func TestHyperLogLogCompress(t *testing.T) {
 	}
 }
 
+func TestHyperLogLogCompressInPlace(t *testing.T) {
+	for _, newHLL := range []struct {
+		name string
+		new  func() *HyperLogLog
+	}{
+		{"dense", func() *HyperLogLog { return NewHyperLogLog(12, fnv.New64()) }},
+		{"packed", func() *HyperLogLog { return NewHyperLogLogPacked(12, fnv.New64()) }},
+		{"sparse", func() *HyperLogLog { return NewHyperLogLogSparse(12, fnv.New64(), 0) }},
+	} {
+		for _, items := range []int{100, N} {
+			for _, factor := range []byte{0, 1, 3, 8, 20} {
+				hll := newHLL.new()
+				for i := 0; i < items; i++ {
+					hll.Add(randomBytes[i])
+				}
+				expected := hll.Compress(factor)
+				hll.CompressInPlace(factor)
+				if hll.p != expected.p || hll.alpha != expected.alpha || hll.data.len() != expected.data.len() || !hll.Equal(expected) {
+					t.Errorf("Expected CompressInPlace(%d) of %s registers after %d items to equal Compress", factor, newHLL.name, items)
+				}
+				if hll.Distinct() != expected.Distinct() {
+					t.Errorf("Expected Distinct %d after CompressInPlace(%d) of %s registers, got %d", expected.Distinct(), factor, newHLL.name, hll.Distinct())
+				}
+				// the folded HyperLogLog keeps counting
+				hll.Add(randomBytes[N-1])
+				expected.Add(randomBytes[N-1])
+				if !hll.Equal(expected) {
+					t.Errorf("Expected Add after CompressInPlace(%d) of %s registers to match Compress", factor, newHLL.name)
+				}
+			}
+		}
+	}
+}
+
 func TestHyperLogLogUnion(t *testing.T) {
 	// Expect to get exactly the same answer after combining
 	p := byte(12)
@@ -154,16 +479,16 @@ func TestHyperLogLogUnion(t *testing.T) {
 	hllIntersect := NewHyperLogLog(p, fnv.New64())
 
 	cardinality := uint64(500)
-	rand.Seed(42)
+	testRand.Seed(42)
 	for i := uint64(0); i < cardinality; i++ {
 		b := make([]byte, 8)
-		rand.Read(b)
+		testRand.Read(b)
 		hllA.Add(b)     // count in A
 		hllUnion.Add(b) // count in Union
 	}
 	for i := uint64(0); i < cardinality; i++ {
 		b := make([]byte, 8)
-		rand.Read(b)
+		testRand.Read(b)
 		hllA.Add(b)         // count in A
 		hllB.Add(b)         // count in B
 		hllb.Add(b)         // count in b
@@ -172,7 +497,7 @@ func TestHyperLogLogUnion(t *testing.T) {
 	}
 	for i := uint64(0); i < cardinality; i++ {
 		b := make([]byte, 8)
-		rand.Read(b)
+		testRand.Read(b)
 		hllB.Add(b)     // count in B
 		hllb.Add(b)     // count in b
 		hllUnion.Add(b) // count in Union
@@ -262,3 +587,160 @@ func BenchmarkHyperLogLogP10Distinct(b *testing.B) {
 	}
 	count = hll.Distinct() // to avoid optimizing out the loop entirely
 }
+
+func TestHyperLogLogCardinality(t *testing.T) {
+	s := NewHyperLogLog(10, fnv.New64())
+	for i := 0; i < 500; i++ {
+		s.Add(randomBytes[i])
+	}
+	if s.Cardinality() != s.Distinct() {
+		t.Errorf("Expected Cardinality %d to equal Distinct %d", s.Cardinality(), s.Distinct())
+	}
+}
+
+func TestHyperLogLogIgnoreEmpty(t *testing.T) {
+	hll := NewHyperLogLog(10, fnv.New64())
+	// by default every empty item has the same hash and counts as one distinct item
+	for i := 0; i < 10; i++ {
+		hll.Add([]byte{})
+		hll.Add(nil)
+	}
+	if hll.Distinct() != 1 {
+		t.Errorf("Expected empty items to count as 1 distinct item, got %d", hll.Distinct())
+	}
+	ignoring := NewHyperLogLog(10, fnv.New64())
+	ignoring.SetIgnoreEmpty(true)
+	ignoring.Add([]byte{})
+	ignoring.Add(nil)
+	if ignoring.Distinct() != 0 {
+		t.Errorf("Expected empty items to be ignored, got %d", ignoring.Distinct())
+	}
+	ignoring.Add(randomBytes[0])
+	if ignoring.Distinct() != 1 {
+		t.Errorf("Expected non-empty items to be added, got %d", ignoring.Distinct())
+	}
+	union, err := ignoring.Union(hll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, derived := range []*HyperLogLog{ignoring.Compress(2), union} {
+		before := derived.Distinct()
+		derived.Add([]byte{})
+		if derived.Distinct() != before {
+			t.Errorf("Expected the ignore empty setting to be kept, got %d after %d", derived.Distinct(), before)
+		}
+	}
+}
+
+func TestHyperLogLogMarshalBinary(t *testing.T) {
+	p := byte(8)
+	native := NewHyperLogLog(p, fnv.New64())
+	// build the encoding from the layout alone as another implementation would
+	m := 1 << p
+	spec := append([]byte("SSHL"), 1, p)
+	spec = append(spec, make([]byte, m)...)
+	for i := 0; i < 2000; i++ {
+		native.Add(randomBytes[i])
+		h := fnv.New64()
+		h.Write(randomBytes[i])
+		sum := h.Sum64()
+		bucket := sum >> (64 - p)
+		register := byte(1 + bits.TrailingZeros64(sum|1<<(64-p)))
+		if register > spec[6+bucket] {
+			spec[6+bucket] = register
+		}
+	}
+	data, err := native.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(spec) {
+		t.Errorf("Expected the encoding to follow the documented layout")
+	}
+	var reloaded HyperLogLog
+	if err = reloaded.UnmarshalBinary(spec); err != nil {
+		t.Fatalf("Expected the documented layout to unmarshal, got %s", err)
+	}
+	reloaded.SetHash(fnv.New64())
+	if !reloaded.Equal(native) || reloaded.Distinct() != native.Distinct() {
+		t.Errorf("Expected reloaded Distinct %d, got %d", native.Distinct(), reloaded.Distinct())
+	}
+	other := NewHyperLogLog(10, fnv.New64())
+	for i := 1000; i < 3000; i++ {
+		other.Add(randomBytes[i])
+	}
+	union, err := other.Union(&reloaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := other.Union(native)
+	if !union.Equal(expected) {
+		t.Errorf("Expected reloaded Union %d, got %d", expected.Distinct(), union.Distinct())
+	}
+	// a packed receiver keeps packing the registers
+	packed := NewHyperLogLogPacked(14, fnv.New64())
+	if err = packed.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := packed.data.(*packedRegisters); !ok || !packed.Equal(native) || packed.alpha != native.alpha {
+		t.Errorf("Expected packed registers equal to the native HyperLogLog")
+	}
+
+	invalidRegister := append([]byte{}, data...)
+	invalidRegister[6] = 66 - p
+	for _, invalid := range [][]byte{
+		nil,
+		[]byte("SSH"),
+		append([]byte("XXXX"), data[4:]...),
+		append(append([]byte("SSHL"), 2), data[5:]...),
+		append(append([]byte("SSHL"), 1, minimumHyperLogLogP-1), make([]byte, 1<<(minimumHyperLogLogP-1))...),
+		append(append([]byte("SSHL"), 1, maximumHyperLogLogP+1), data[6:]...),
+		data[:len(data)-1],
+		append(append([]byte{}, data...), 0),
+		invalidRegister,
+	} {
+		if err := reloaded.UnmarshalBinary(invalid); err == nil {
+			t.Errorf("Expected error unmarshaling %d bytes", len(invalid))
+		}
+	}
+	if !reloaded.Equal(native) {
+		t.Errorf("Expected failed UnmarshalBinary to leave the HyperLogLog unchanged")
+	}
+}
+
+func TestHyperLogLogRegisters(t *testing.T) {
+	hll := NewHyperLogLog(10, fnv.New64())
+	for i := 0; i < 1000; i++ {
+		hll.Add(randomBytes[i])
+	}
+	registers := hll.Registers()
+	loaded, err := LoadRegisters(10, fnv.New64(), registers)
+	if err != nil {
+		t.Fatalf("Expected registers of the right length to load, got %s", err)
+	}
+	if !loaded.Equal(hll) || loaded.Distinct() != hll.Distinct() {
+		t.Errorf("Expected loaded Distinct %d, got %d", hll.Distinct(), loaded.Distinct())
+	}
+	// the registers are live, not a copy
+	loaded.Add(randomBytes[1000])
+	hll.Add(randomBytes[1001])
+	if !loaded.Equal(hll) {
+		t.Errorf("Expected the loaded HyperLogLog to share the registers")
+	}
+	// packed registers are returned as a copy
+	packed := NewHyperLogLogPacked(10, fnv.New64())
+	for i := 0; i < 1000; i++ {
+		packed.Add(randomBytes[i])
+	}
+	copied := packed.Registers()
+	if fromCopy, err := NewHyperLogLogWithRegisters(10, fnv.New64(), copied); err != nil || !fromCopy.Equal(packed) {
+		t.Errorf("Expected a copy of the packed registers, got %v", err)
+	}
+	copied[0] = 42
+	if packed.data.get(0) == 42 {
+		t.Errorf("Expected the packed registers not to be shared")
+	}
+	if _, err = LoadRegisters(10, fnv.New64(), registers[1:]); err == nil {
+		t.Errorf("Expected error for mismatched number of registers")
+	}
+}
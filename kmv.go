@@ -0,0 +1,135 @@
+package streamstats
+
+import (
+	"container/heap"
+	"hash"
+	"math"
+)
+
+// minimumKMVK is the smallest number of values kept by a KMV for a finite expected error
+const minimumKMVK = 3
+
+// KMV is a k minimum values datastructure for computing count distinct by keeping the k smallest hash values
+// based on On Synopses for Distinct-Value Estimation Under Multiset Operations
+// Kevin Beyer, Peter J. Haas, Berthold Reinwald, Yannis Sismanis and Rainer Gemulla, SIGMOD '07
+// with the hash values normalized to (0, 1] the k-th smallest value of n distinct items is about k/n,
+// so the unbiased estimate of the count is (k-1)/max of the kept values, and is exact while fewer than k items are seen
+// it uses O(k) space and merges exactly, the union of two KMV is the KMV of the union of the items
+type KMV struct {
+	hash   hash.Hash64
+	k      int
+	values uint64MaxHeap       // the kept hash values with the largest at the root
+	kept   map[uint64]struct{} // the kept hash values for detecting duplicates
+}
+
+// NewKMV returns a pointer to a new empty KMV keeping the k smallest hash values using the given hash function
+// the expected error is 1/sqrt(k-2), k is bounded below by 3
+func NewKMV(k int, hash hash.Hash64) *KMV {
+	if k < minimumKMVK {
+		k = minimumKMVK
+	}
+	return &KMV{hash: hash, k: k, values: make(uint64MaxHeap, 0, k), kept: make(map[uint64]struct{}, k)}
+}
+
+// Add adds an item to the multiset represented by the KMV
+func (kmv *KMV) Add(item []byte) {
+	kmv.hash.Reset()
+	kmv.hash.Write(item)
+	kmv.addHash(kmv.hash.Sum64())
+}
+
+// AddFloat64 adds a float64 value to the multiset represented by the KMV
+// -0.0 and +0.0 are counted as the same value and all NaNs are counted as a single value
+func (kmv *KMV) AddFloat64(x float64) {
+	kmv.Add(float64Bytes(x))
+}
+
+// addHash keeps the hash value if it is one of the k smallest distinct values seen
+func (kmv *KMV) addHash(h uint64) {
+	if _, ok := kmv.kept[h]; ok {
+		return
+	}
+	if len(kmv.values) < kmv.k {
+		heap.Push(&kmv.values, h)
+		kmv.kept[h] = struct{}{}
+	} else if h < kmv.values[0] {
+		delete(kmv.kept, kmv.values[0])
+		kmv.values[0] = h // replace the largest kept value
+		heap.Fix(&kmv.values, 0)
+		kmv.kept[h] = struct{}{}
+	}
+}
+
+// Distinct returns the estimated number of distinct items in the multiset
+// which is exact while fewer than k distinct items have been seen
+func (kmv *KMV) Distinct() uint64 {
+	if len(kmv.values) < kmv.k {
+		return uint64(len(kmv.values))
+	}
+	u := (float64(kmv.values[0]) + 1.0) / (1 << 64) // the largest kept value normalized to (0, 1]
+	return roundEstimate(float64(kmv.k-1) / u)
+}
+
+// ExpectedError returns the expected relative error of the Distinct estimate, 1/sqrt(k-2)
+// or 0 while fewer than k distinct items have been seen
+func (kmv *KMV) ExpectedError() float64 {
+	if len(kmv.values) < kmv.k {
+		return 0.0
+	}
+	return 1.0 / math.Sqrt(float64(kmv.k-2))
+}
+
+// K returns the number of hash values kept
+func (kmv *KMV) K() int {
+	return kmv.k
+}
+
+// Reset removes all items from the multiset
+func (kmv *KMV) Reset() {
+	kmv.values = kmv.values[:0]
+	kmv.kept = make(map[uint64]struct{}, kmv.k)
+}
+
+// Combine returns a new KMV of the items in either KMV keeping the smaller k of the two
+// by merging the kept values and trimming to the k smallest
+// the function will return nil and an error if the hash functions mismatch
+func (kmv *KMV) Combine(kmvB *KMV) (*KMV, error) {
+	if err := sameHash(kmv.hash, kmvB.hash, "KMV"); err != nil {
+		return nil, err
+	}
+	k := kmv.k
+	if kmvB.k < k {
+		k = kmvB.k
+	}
+	combined := NewKMV(k, kmv.hash)
+	for _, h := range kmv.values {
+		combined.addHash(h)
+	}
+	for _, h := range kmvB.values {
+		combined.addHash(h)
+	}
+	return combined, nil
+}
+
+// Union is an alias of Combine
+func (kmv *KMV) Union(kmvB *KMV) (*KMV, error) {
+	return kmv.Combine(kmvB)
+}
+
+// uint64MaxHeap is a max-heap of uint64 implementing heap.Interface
+type uint64MaxHeap []uint64
+
+func (h uint64MaxHeap) Len() int           { return len(h) }
+func (h uint64MaxHeap) Less(i, j int) bool { return h[i] > h[j] }
+func (h uint64MaxHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *uint64MaxHeap) Push(x interface{}) {
+	*h = append(*h, x.(uint64))
+}
+
+func (h *uint64MaxHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
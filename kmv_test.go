@@ -0,0 +1,81 @@
+package streamstats
+
+import (
+	"hash/fnv"
+	"math"
+	"testing"
+)
+
+func TestNewKMV(t *testing.T) {
+	kmv := NewKMV(1, fnv.New64())
+	if kmv.K() != minimumKMVK {
+		t.Errorf("Expected k bounded by %d, got %d", minimumKMVK, kmv.K())
+	}
+}
+
+func TestKMV(t *testing.T) {
+	k := 1024
+	kmv := NewKMV(k, fnv.New64())
+	// exact while fewer than k distinct items are seen
+	for i := 0; i < k-1; i++ {
+		kmv.Add(randomBytes[i])
+		kmv.Add(randomBytes[i])
+	}
+	if kmv.Distinct() != uint64(k-1) || kmv.ExpectedError() != 0.0 {
+		t.Errorf("Expected exactly %d distinct items, got %d", k-1, kmv.Distinct())
+	}
+	for i := k - 1; i < N; i++ {
+		kmv.Add(randomBytes[i])
+	}
+	if len(kmv.values) != k || len(kmv.kept) != k {
+		t.Errorf("Expected %d kept values, got %d and %d", k, len(kmv.values), len(kmv.kept))
+	}
+	expectedError := 1.0 / math.Sqrt(float64(k-2))
+	if kmv.ExpectedError() != expectedError {
+		t.Errorf("Expected ExpectedError %f, got %f", expectedError, kmv.ExpectedError())
+	}
+	// allow three standard deviations
+	if actualError := math.Abs(float64(kmv.Distinct())-float64(N)) / float64(N); actualError > 3*expectedError {
+		t.Errorf("Expected %d distinct items within %f, got %d", N, 3*expectedError, kmv.Distinct())
+	}
+	kmv.Reset()
+	if kmv.Distinct() != 0 {
+		t.Errorf("Expected Reset to empty the KMV, got %d", kmv.Distinct())
+	}
+}
+
+func TestKMVCombine(t *testing.T) {
+	a := NewKMV(256, fnv.New64())
+	b := NewKMV(512, fnv.New64())
+	total := NewKMV(256, fnv.New64())
+	for i := 0; i < N; i++ {
+		if i < 2*N/3 {
+			a.Add(randomBytes[i])
+		}
+		if i > N/3 {
+			b.Add(randomBytes[i])
+		}
+		total.Add(randomBytes[i])
+	}
+	combined, err := a.Combine(b)
+	if err != nil {
+		t.Fatalf("KMV Combine failed: %s", err)
+	}
+	// the combined KMV keeps the smaller k and is identical to the KMV of all the items
+	if combined.K() != 256 || combined.Distinct() != total.Distinct() {
+		t.Errorf("Expected the Combine to equal the KMV of all items %d, got %d", total.Distinct(), combined.Distinct())
+	}
+	if union, err := a.Union(b); err != nil || union.Distinct() != combined.Distinct() {
+		t.Errorf("Expected Union to be an alias of Combine, got %v", err)
+	}
+	if _, err = a.Combine(NewKMV(256, fnv.New64a())); err == nil {
+		t.Errorf("Expected Combine using two different hash functions to return error")
+	}
+}
+
+func BenchmarkKMVAdd(b *testing.B) {
+	kmv := NewKMV(1024, fnv.New64())
+	for i := 0; i < b.N; i++ {
+		kmv.Add(randomBytes[i&mask])
+	}
+}
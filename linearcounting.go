@@ -1,6 +1,7 @@
 package streamstats
 
 import (
+	"encoding/binary"
 	"fmt"
 	"hash"
 	"math"
@@ -11,11 +12,15 @@ const (
 	maxLinearCountingP = 24
 )
 
+// linearCountingEncodingVersion is the version byte of the MarshalBinary encoding of a LinearCounting
+const linearCountingEncodingVersion = 1
+
 // LinearCounting is a space efficient data structure for count distinct with hard upper bound
 type LinearCounting struct {
-	hash hash.Hash64 // a 64-bit hash function to map inputs to uniform buckets
-	bits BitVector   // bitvector to hold the occupied buckets
-	p    byte        // the number of buckets m = 2^p
+	hash        hash.Hash64 // a 64-bit hash function to map inputs to uniform buckets
+	bits        BitVector   // bitvector to hold the occupied buckets
+	p           byte        // the number of buckets m = 2^p
+	ignoreEmpty bool        // skip zero-length items in Add
 }
 
 // NewLinearCounting initializes a LinearCounting structure with size m=2^p and the given hash function
@@ -31,8 +36,108 @@ func NewLinearCounting(p byte, hash hash.Hash64) *LinearCounting {
 	return &LinearCounting{p: p, hash: hash, bits: bits}
 }
 
+// NewLinearCountingWithBits initializes a LinearCounting structure with size m=2^p and the given hash function
+// that uses the given pre-allocated words as its bits without copying, e.g. memory mapped from a file
+// the number of words must match the size m, ceil(m/64)
+func NewLinearCountingWithBits(p byte, hash hash.Hash64, words []uint64) (*LinearCounting, error) {
+	if p < minLinearCountingP {
+		p = minLinearCountingP
+	} else if p > maxLinearCountingP {
+		p = maxLinearCountingP
+	}
+	m := uint64(1 << p)
+	if uint64(len(words)) != bitVectorWords(m) {
+		return nil, fmt.Errorf("LinearCounting of size m = %d requires %d words, got %d", m, bitVectorWords(m), len(words))
+	}
+	return &LinearCounting{p: p, hash: hash, bits: BitVectorFromWords(words)}, nil
+}
+
+// NewLinearCountingForCardinality initializes a LinearCounting structure with the smallest size m=2^p
+// such that the expected error after adding maxN distinct items is at most targetError
+// an error is returned if the required size exceeds the maximum supported size
+func NewLinearCountingForCardinality(maxN uint64, targetError float64, hash hash.Hash64) (*LinearCounting, error) {
+	p := byte(minLinearCountingP)
+	for ; p <= maxLinearCountingP; p++ {
+		m := float64(uint64(1 << p))
+		if maxN < uint64(1<<p) && linearCountingError(float64(maxN), m) <= targetError {
+			return NewLinearCounting(p, hash), nil
+		}
+	}
+	return nil, fmt.Errorf("LinearCounting for %d items with error %f requires p > maximum %d", maxN, targetError, maxLinearCountingP)
+}
+
+// linearCountingError returns the expected error of the LinearCounting estimate of n items in m buckets
+func linearCountingError(n, m float64) float64 {
+	return linearCountingErrorAt(n/m, m)
+}
+
+// linearCountingErrorAt returns the expected error of the LinearCounting estimate in m buckets at the given load factor
+// 2 * sqrt((e^t - t - 1)/m) / t from Whang et al. or 0 for an empty structure
+// a BloomFilter with k hash functions has the error of m/k buckets
+func linearCountingErrorAt(loadFactor, m float64) float64 {
+	if loadFactor == 0.0 {
+		return 0.0
+	}
+	return 2 * math.Sqrt((math.Exp(loadFactor)-loadFactor-1)/m) / loadFactor
+}
+
+// SetHash sets the hash function, e.g. after UnmarshalBinary since the hash function is not encoded
+// it must be identical to the hash function used to add the encoded items
+func (lc *LinearCounting) SetHash(hash hash.Hash64) {
+	lc.hash = hash
+}
+
+// MarshalBinary encodes the LinearCounting as a version byte, the precision p and the big-endian words of the bits
+// the hash function is not encoded
+func (lc *LinearCounting) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 2, 2+8*len(lc.bits))
+	data[0] = linearCountingEncodingVersion
+	data[1] = lc.p
+	for _, word := range lc.bits {
+		data = binary.BigEndian.AppendUint64(data, word)
+	}
+	return data, nil
+}
+
+// UnmarshalBinary decodes a LinearCounting encoded by MarshalBinary replacing the precision and bits of the receiver
+// the hash function of the receiver is kept, SetHash must be called before Add, Union or Intersect if it is nil
+// it returns an error without modifying the receiver if p is out of range or the number of words does not match p
+func (lc *LinearCounting) UnmarshalBinary(data []byte) error {
+	if len(data) < 2 {
+		return fmt.Errorf("LinearCounting encoding is too short, %d bytes", len(data))
+	}
+	if data[0] != linearCountingEncodingVersion {
+		return fmt.Errorf("LinearCounting encoding version %d is not supported", data[0])
+	}
+	p := data[1]
+	if p < minLinearCountingP || p > maxLinearCountingP {
+		return fmt.Errorf("LinearCounting precision p = %d is out of range [%d, %d]", p, minLinearCountingP, maxLinearCountingP)
+	}
+	words := bitVectorWords(uint64(1 << p))
+	if uint64(len(data)-2) != 8*words {
+		return fmt.Errorf("LinearCounting of size m = %d requires %d words, got %d bytes", uint64(1<<p), words, len(data)-2)
+	}
+	bits := make(BitVector, words, words)
+	for i := range bits {
+		bits[i] = binary.BigEndian.Uint64(data[2+8*i:])
+	}
+	lc.p = p
+	lc.bits = bits
+	return nil
+}
+
+// SetIgnoreEmpty sets whether Add skips zero-length items, by default an empty item is hashed like any other
+// so it counts as one distinct item, the setting is kept by Compress, Union and Intersect
+func (lc *LinearCounting) SetIgnoreEmpty(ignore bool) {
+	lc.ignoreEmpty = ignore
+}
+
 // Add adds an item to the multiset represented by the LinearCounting structure
+// a zero-length item is counted as a single distinct item unless SetIgnoreEmpty is set
 func (lc *LinearCounting) Add(item []byte) {
+	if lc.ignoreEmpty && len(item) == 0 {
+		return
+	}
 	lc.hash.Reset()
 	lc.hash.Write(item)
 	hash := lc.hash.Sum64()
@@ -40,15 +145,33 @@ func (lc *LinearCounting) Add(item []byte) {
 	lc.bits.Set(bucket)
 }
 
+// AddFloat64 adds a float64 value to the multiset represented by the LinearCounting
+// -0.0 and +0.0 are counted as the same value and all NaNs are counted as a single value
+func (lc *LinearCounting) AddFloat64(x float64) {
+	lc.Add(float64Bytes(x))
+}
+
 // Distinct returns the estimate of the number of distinct elements seen
 // if the backing BitVector is full it returns m, the size of the BitVector
 func (lc LinearCounting) Distinct() uint64 {
 	m := uint64(1 << lc.p)
 	zeroCount := m - lc.bits.PopCount()
+	estimate := float64(m) // the estimate is infinite once full, so saturate at m
 	if zeroCount > 0 {
-		return uint64(float64(m) * math.Log(float64(m)/float64(zeroCount)))
+		estimate = float64(m) * math.Log(float64(m)/float64(zeroCount))
 	}
-	return (1 << lc.p)
+	return roundEstimate(estimate)
+}
+
+// Cardinality is an alias of Distinct, the name used by most other cardinality estimation libraries
+func (lc LinearCounting) Cardinality() uint64 {
+	return lc.Distinct()
+}
+
+// Equal returns true if both LinearCounting have the same precision and bits set
+// the hash functions are not compared
+func (lc *LinearCounting) Equal(other *LinearCounting) bool {
+	return lc.p == other.p && lc.bits.Equal(other.bits)
 }
 
 // Compress produces a new LinearCouting with reduced size by 2^factor with reduced precision
@@ -62,6 +185,7 @@ func (lc *LinearCounting) Compress(factor byte) *LinearCounting {
 		p = minLinearCountingP
 	}
 	newLC := NewLinearCounting(p, lc.hash)
+	newLC.ignoreEmpty = lc.ignoreEmpty
 
 	// copy the old BitVector to a new temporary one that can be folded
 	bitsToFold := NewBitVector(uint64(1 << lc.p))
@@ -87,15 +211,8 @@ func (lc *LinearCounting) Compress(factor byte) *LinearCounting {
 // the function will return nil and an error if the hash functions mismatch
 func (lc *LinearCounting) Union(lcB *LinearCounting) (*LinearCounting, error) {
 
-	// check that both hash functions get the same result for "LinearCounting"
-	lc.hash.Reset()
-	lc.hash.Write([]byte("LinearCounting"))
-	hash := lc.hash.Sum64()
-	lcB.hash.Reset()
-	lcB.hash.Write([]byte("LinearCounting"))
-	hashB := lcB.hash.Sum64()
-	if hash != hashB {
-		return nil, fmt.Errorf("Hash functions are not identical, return %0x != %0x for \"LinearCounting\"", hash, hashB)
+	if err := sameHash(lc.hash, lcB.hash, "LinearCounting"); err != nil {
+		return nil, err
 	}
 	// determine if either precision needs to be reduced
 	var combinedP byte
@@ -117,25 +234,24 @@ func (lc *LinearCounting) Union(lcB *LinearCounting) (*LinearCounting, error) {
 	}
 	// for each bucket take the OR of the two LinearCounting
 	combinedLC = NewLinearCounting(combinedP, lc.hash)
+	combinedLC.ignoreEmpty = lc.ignoreEmpty
 	for i := range combinedLC.bits {
 		combinedLC.bits[i] = lc1.bits[i] | lc2.bits[i]
 	}
 	return combinedLC, nil
 }
 
+// Combine is an alias of Union
+func (lc *LinearCounting) Combine(lcB *LinearCounting) (*LinearCounting, error) {
+	return lc.Union(lcB)
+}
+
 // Intersect the estimate of two LinearCounting reducing the precision to the minimum of the two sets
 // the function will return nil and an error if the hash functions mismatch
 func (lc *LinearCounting) Intersect(lcB *LinearCounting) (*LinearCounting, error) {
 
-	// check that both hash functions get the same result for "LinearCounting"
-	lc.hash.Reset()
-	lc.hash.Write([]byte("LinearCounting"))
-	hash := lc.hash.Sum64()
-	lcB.hash.Reset()
-	lcB.hash.Write([]byte("LinearCounting"))
-	hashB := lcB.hash.Sum64()
-	if hash != hashB {
-		return nil, fmt.Errorf("Hash functions are not identical, return %0x != %0x for \"LinearCounting\"", hash, hashB)
+	if err := sameHash(lc.hash, lcB.hash, "LinearCounting"); err != nil {
+		return nil, err
 	}
 	// determine if either precision needs to be reduced
 	var combinedP byte
@@ -157,6 +273,7 @@ func (lc *LinearCounting) Intersect(lcB *LinearCounting) (*LinearCounting, error
 	}
 	// for each bucket take the AND of the two LinearCounting
 	combinedLC = NewLinearCounting(combinedP, lc.hash)
+	combinedLC.ignoreEmpty = lc.ignoreEmpty
 	for i := range combinedLC.bits {
 		combinedLC.bits[i] = lc1.bits[i] & lc2.bits[i]
 	}
@@ -168,11 +285,36 @@ func (lc LinearCounting) Occupancy() float64 {
 	return float64(lc.bits.PopCount()) / float64(uint64(1<<lc.p))
 }
 
+// ChiSquaredUniformity returns Pearson's chi-squared statistic comparing the number of occupied buckets
+// in equal sized groups of buckets to the number expected from a uniform hash at the current occupancy
+// the groups are sized so each has an expected count of at least 5 occupied and 5 empty buckets,
+// so the statistic is approximately chi-squared distributed with degrees of freedom one less than the number of groups
+// a statistic much larger than the number of groups indicates a broken or low-entropy hash function
+func (lc LinearCounting) ChiSquaredUniformity() float64 {
+	occupancy := lc.Occupancy()
+	if occupancy == 0.0 || occupancy == 1.0 {
+		return 0.0
+	}
+	// find the smallest number of 64-bit words in a group to expect 5 occupied and empty buckets
+	groupWords := 1
+	for groupWords < len(lc.bits) && 64*float64(groupWords)*math.Min(occupancy, 1-occupancy) < 5.0 {
+		groupWords *= 2
+	}
+	expected := 64 * float64(groupWords) * occupancy
+	variance := expected * (1 - occupancy) // the sum over occupied and empty buckets in the group
+	var chiSquared float64
+	for i := 0; i < len(lc.bits); i += groupWords {
+		observed := float64(lc.bits[i : i+groupWords].PopCount())
+		chiSquared += (observed - expected) * (observed - expected) / variance
+	}
+	return chiSquared
+}
+
 // ExpectedError returns the expected error at the current filling in the LinearCounting
+// or 0 for an empty LinearCounting
 func (lc LinearCounting) ExpectedError() float64 {
 	m := float64(uint64(1 << lc.p))
-	loadFactor := lc.Occupancy()
-	return 2 * math.Sqrt((math.Exp(loadFactor)-loadFactor-1)/m) / loadFactor
+	return linearCountingErrorAt(lc.Occupancy(), m)
 }
 
 func (lc LinearCounting) String() string {
@@ -13,10 +13,10 @@ func TestLinearCountingPRNG(t *testing.T) {
 	p := byte(13)
 	lc := NewLinearCounting(p, fnv.New64())
 	cardinality := uint64(1000)
-	rand.Seed(42)
+	testRand.Seed(42)
 	for i := uint64(0); i < cardinality; i++ {
 		b := make([]byte, 8)
-		rand.Read(b)
+		testRand.Read(b)
 		lc.Add(b)
 	}
 	N := lc.Distinct()
@@ -37,7 +37,7 @@ func TestLinearCountingPRNG(t *testing.T) {
 	lc = NewLinearCounting(p, fnv.New64())
 	for i := uint64(0); i < cardinality; i++ {
 		b := make([]byte, 8)
-		rand.Read(b)
+		testRand.Read(b)
 		lc.Add(b)
 	}
 	if lc.Occupancy() != 1.0 {
@@ -58,6 +58,220 @@ func TestLinearCountingPRNG(t *testing.T) {
 	}
 }
 
+func TestLinearCountingChiSquaredUniformity(t *testing.T) {
+	p := byte(14)
+	lc := NewLinearCounting(p, fnv.New64())
+	if lc.ChiSquaredUniformity() != 0.0 {
+		t.Errorf("Expected an empty LinearCounting to have a chi-squared of zero, got %f", lc.ChiSquaredUniformity())
+	}
+	poor := NewLinearCounting(p, topBitClearedHash{fnv.New64()})
+	for i := 0; i < 10000; i++ {
+		lc.Add(randomBytes[i])
+		poor.Add(randomBytes[i])
+	}
+	// at this occupancy each 64-bit word is a group
+	groups := float64(uint64(1<<p) / 64)
+	if chiSquared := lc.ChiSquaredUniformity(); chiSquared > 1.5*groups {
+		t.Errorf("Expected a good hash to have a small chi-squared, got %f", chiSquared)
+	}
+	if chiSquared := poor.ChiSquaredUniformity(); chiSquared < 10*groups {
+		t.Errorf("Expected a poor hash to have a large chi-squared, got %f", chiSquared)
+	}
+}
+
+func TestLinearCountingExpectedError(t *testing.T) {
+	lc := NewLinearCounting(10, fnv.New64())
+	if lc.ExpectedError() != 0.0 {
+		t.Errorf("Expected zero error for an empty LinearCounting, got %f", lc.ExpectedError())
+	}
+	bf := NewBloomFilter(1000, 0.01, fnv.New64())
+	if bf.ExpectedError() != 0.0 {
+		t.Errorf("Expected zero error for an empty BloomFilter, got %f", bf.ExpectedError())
+	}
+	for i := 0; i < 500; i++ {
+		lc.Add(randomBytes[i])
+		bf.Add(randomBytes[i])
+	}
+	m := float64(uint64(1 << lc.p))
+	loadFactor := lc.Occupancy()
+	expected := 2 * math.Sqrt((math.Exp(loadFactor)-loadFactor-1)/m) / loadFactor
+	if math.Abs(lc.ExpectedError()-expected) > 1e-15 {
+		t.Errorf("Expected LinearCounting error %f, got %f", expected, lc.ExpectedError())
+	}
+	// a BloomFilter has the error of LinearCounting with m/k buckets
+	expected = linearCountingErrorAt(bf.Occupancy(), float64(bf.m)/float64(bf.k))
+	if bf.ExpectedError() != expected {
+		t.Errorf("Expected BloomFilter error %f, got %f", expected, bf.ExpectedError())
+	}
+	if linearCountingError(500, m) != linearCountingErrorAt(500/m, m) {
+		t.Errorf("Expected the error of n items to be the error at load factor n/m")
+	}
+}
+
+func TestLinearCountingEqual(t *testing.T) {
+	a := NewLinearCounting(12, fnv.New64())
+	b := NewLinearCounting(12, fnv.New64())
+	for i := 0; i < 1000; i++ {
+		a.Add(randomBytes[i])
+	}
+	if a.Equal(b) {
+		t.Errorf("Expected LinearCounting with different bits not to be equal")
+	}
+	for i := 0; i < 1000; i++ {
+		b.Add(randomBytes[i])
+	}
+	if !a.Equal(b) {
+		t.Errorf("Expected LinearCounting with the same bits to be equal")
+	}
+	if a.Equal(a.Compress(1)) {
+		t.Errorf("Expected LinearCounting with different precision not to be equal")
+	}
+}
+
+func TestNewLinearCountingForCardinality(t *testing.T) {
+	var testCases = []struct {
+		maxN        uint64
+		targetError float64
+	}{
+		{0, 0.01},
+		{100, 0.1},
+		{1000, 0.05},
+		{1000, 0.02},
+		{100000, 0.01},
+	}
+	for _, test := range testCases {
+		lc, err := NewLinearCountingForCardinality(test.maxN, test.targetError, fnv.New64())
+		if err != nil {
+			t.Errorf("Expected LinearCounting for %d items with error %f, got %s", test.maxN, test.targetError, err)
+			continue
+		}
+		m := float64(uint64(1 << lc.p))
+		if e := linearCountingError(float64(test.maxN), m); e > test.targetError {
+			t.Errorf("Expected error at p=%d to be at most %f, got %f", lc.p, test.targetError, e)
+		}
+		if lc.p > minLinearCountingP {
+			if e := linearCountingError(float64(test.maxN), m/2); e <= test.targetError && test.maxN < uint64(m/2) {
+				t.Errorf("Expected smallest p for %d items with error %f, got p=%d but p=%d suffices", test.maxN, test.targetError, lc.p, lc.p-1)
+			}
+		}
+		// fill to the expected maximum and check the estimate
+		r := rand.New(rand.NewSource(42))
+		for i := uint64(0); i < test.maxN; i++ {
+			b := make([]byte, 8)
+			r.Read(b)
+			lc.Add(b)
+		}
+		if test.maxN > 0 {
+			actualError := math.Abs(float64(lc.Distinct())-float64(test.maxN)) / float64(test.maxN)
+			if actualError > test.targetError {
+				t.Errorf("Expected cardinality %d within %f, got %d", test.maxN, test.targetError, lc.Distinct())
+			}
+		}
+	}
+	// a cardinality that would require p > maxLinearCountingP is an error
+	if _, err := NewLinearCountingForCardinality(1<<maxLinearCountingP, 0.01, fnv.New64()); err == nil {
+		t.Errorf("Expected error for cardinality exceeding the maximum LinearCounting size")
+	}
+	if _, err := NewLinearCountingForCardinality(1000, 0.00001, fnv.New64()); err == nil {
+		t.Errorf("Expected error for target error requiring p > %d", maxLinearCountingP)
+	}
+}
+
+func TestNewLinearCountingWithBits(t *testing.T) {
+	p := byte(10)
+	words := make([]uint64, 1<<(p-6))
+	lc, err := NewLinearCountingWithBits(p, fnv.New64(), words)
+	if err != nil {
+		t.Fatalf("Expected LinearCounting with %d words, got %s", len(words), err)
+	}
+	expected := NewLinearCounting(p, fnv.New64())
+	for i := 0; i < 500; i++ {
+		lc.Add(randomBytes[i])
+		expected.Add(randomBytes[i])
+	}
+	if lc.Distinct() != expected.Distinct() {
+		t.Errorf("Expected Distinct %d, got %d", expected.Distinct(), lc.Distinct())
+	}
+	for i := range words {
+		if words[i] != expected.bits[i] {
+			t.Errorf("Expected word %d to be %0x, got %0x", i, expected.bits[i], words[i])
+		}
+	}
+	// reloading the same words recovers the same state
+	reloaded, err := NewLinearCountingWithBits(p, fnv.New64(), words)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.Distinct() != expected.Distinct() {
+		t.Errorf("Expected reloaded Distinct %d, got %d", expected.Distinct(), reloaded.Distinct())
+	}
+	if _, err = NewLinearCountingWithBits(p, fnv.New64(), words[1:]); err == nil {
+		t.Errorf("Expected error for mismatched number of words")
+	}
+}
+
+func TestLinearCountingMarshalBinary(t *testing.T) {
+	a := NewLinearCounting(10, fnv.New64())
+	b := NewLinearCounting(10, fnv.New64())
+	for i := 0; i < 800; i++ {
+		a.Add(randomBytes[i])
+		b.Add(randomBytes[i+400])
+	}
+	data, err := a.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reloaded LinearCounting
+	if err = reloaded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("Expected valid encoding to unmarshal, got %s", err)
+	}
+	reloaded.SetHash(fnv.New64())
+	if !reloaded.Equal(a) || reloaded.Distinct() != a.Distinct() {
+		t.Errorf("Expected reloaded Distinct %d, got %d", a.Distinct(), reloaded.Distinct())
+	}
+	// a reloaded LinearCounting merges with a native one as the original would
+	union, err := reloaded.Union(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedUnion, _ := a.Union(b)
+	if !union.Equal(expectedUnion) {
+		t.Errorf("Expected reloaded Union %d, got %d", expectedUnion.Distinct(), union.Distinct())
+	}
+	intersect, err := b.Intersect(&reloaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedIntersect, _ := b.Intersect(a)
+	if !intersect.Equal(expectedIntersect) {
+		t.Errorf("Expected reloaded Intersect %d, got %d", expectedIntersect.Distinct(), intersect.Distinct())
+	}
+	// items added after reloading are hashed the same way
+	reloaded.Add(randomBytes[1000])
+	a.Add(randomBytes[1000])
+	if !reloaded.Equal(a) {
+		t.Errorf("Expected reloaded LinearCounting to hash new items the same way")
+	}
+
+	tooSmall := []byte{linearCountingEncodingVersion, minLinearCountingP - 1}
+	tooSmall = append(tooSmall, make([]byte, 8)...)
+	for _, invalid := range [][]byte{
+		nil,
+		{linearCountingEncodingVersion},
+		append([]byte{linearCountingEncodingVersion + 1}, data[1:]...),
+		tooSmall,
+		data[:len(data)-8],
+		append(append([]byte{}, data...), make([]byte, 8)...),
+	} {
+		if err := reloaded.UnmarshalBinary(invalid); err == nil {
+			t.Errorf("Expected error unmarshaling %d bytes", len(invalid))
+		}
+	}
+	if !reloaded.Equal(a) {
+		t.Errorf("Expected failed UnmarshalBinary to leave the LinearCounting unchanged")
+	}
+}
+
 func TestLinearCountingVsHyperLogLog(t *testing.T) {
 	// Expect to get exactly the same answer for the same algorithm
 	p := byte(13)
@@ -122,16 +336,16 @@ func TestLinearCountingCombine(t *testing.T) {
 	lcIntersect := NewLinearCounting(p, fnv.New64())
 
 	cardinality := uint64(300)
-	rand.Seed(42)
+	testRand.Seed(42)
 	for i := uint64(0); i < cardinality; i++ {
 		b := make([]byte, 8)
-		rand.Read(b)
+		testRand.Read(b)
 		lcA.Add(b)     // count in A
 		lcUnion.Add(b) // count in Union
 	}
 	for i := uint64(0); i < cardinality; i++ {
 		b := make([]byte, 8)
-		rand.Read(b)
+		testRand.Read(b)
 		lcA.Add(b)         // count in A
 		lcB.Add(b)         // count in B
 		lcUnion.Add(b)     // count in Union
@@ -139,7 +353,7 @@ func TestLinearCountingCombine(t *testing.T) {
 	}
 	for i := uint64(0); i < cardinality; i++ {
 		b := make([]byte, 8)
-		rand.Read(b)
+		testRand.Read(b)
 		lcB.Add(b)     // count in B
 		lcUnion.Add(b) // count in Union
 	}
@@ -183,16 +397,16 @@ func TestLinearCountingCombine(t *testing.T) {
 	lcB = NewLinearCounting(p-3, fnv.New64())
 	lcUnion = NewLinearCounting(p-3, fnv.New64())
 
-	rand.Seed(42)
+	testRand.Seed(42)
 	for i := uint64(0); i < cardinality/2; i++ {
 		b := make([]byte, 8)
-		rand.Read(b)
+		testRand.Read(b)
 		lcA.Add(b)     // count in A
 		lcUnion.Add(b) // count in Union
 	}
 	for i := uint64(0); i < cardinality/2; i++ {
 		b := make([]byte, 8)
-		rand.Read(b)
+		testRand.Read(b)
 		lcB.Add(b)     // count in B
 		lcUnion.Add(b) // count in Union
 	}
@@ -254,3 +468,70 @@ func BenchmarkLinearCountingP10Distinct(b *testing.B) {
 	}
 	count = lc.Distinct() // to avoid optimizing out the loop entirely
 }
+
+func TestLinearCountingCardinality(t *testing.T) {
+	s := NewLinearCounting(12, fnv.New64())
+	for i := 0; i < 500; i++ {
+		s.Add(randomBytes[i])
+	}
+	if s.Cardinality() != s.Distinct() {
+		t.Errorf("Expected Cardinality %d to equal Distinct %d", s.Cardinality(), s.Distinct())
+	}
+}
+
+func TestLinearCountingIgnoreEmpty(t *testing.T) {
+	lc := NewLinearCounting(10, fnv.New64())
+	// by default every empty item has the same hash and counts as one distinct item
+	for i := 0; i < 10; i++ {
+		lc.Add([]byte{})
+		lc.Add(nil)
+	}
+	if lc.Distinct() != 1 {
+		t.Errorf("Expected empty items to count as 1 distinct item, got %d", lc.Distinct())
+	}
+	ignoring := NewLinearCounting(10, fnv.New64())
+	ignoring.SetIgnoreEmpty(true)
+	ignoring.Add([]byte{})
+	ignoring.Add(nil)
+	if ignoring.Distinct() != 0 {
+		t.Errorf("Expected empty items to be ignored, got %d", ignoring.Distinct())
+	}
+	ignoring.Add(randomBytes[0])
+	if ignoring.Distinct() != 1 {
+		t.Errorf("Expected non-empty items to be added, got %d", ignoring.Distinct())
+	}
+	union, err := ignoring.Union(lc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, derived := range []*LinearCounting{ignoring.Compress(2), union} {
+		before := derived.Distinct()
+		derived.Add([]byte{})
+		if derived.Distinct() != before {
+			t.Errorf("Expected the ignore empty setting to be kept, got %d after %d", derived.Distinct(), before)
+		}
+	}
+}
+
+func TestLinearCountingRounding(t *testing.T) {
+	// over many known cardinalities truncating the floating point estimate lowers it by about 1/2 on average
+	// while rounding to the nearest integer leaves it unbiased
+	lc := NewLinearCounting(14, fnv.New64())
+	m := float64(uint64(1 << lc.p))
+	var roundedBias, truncatedBias float64
+	cardinalities := 2000
+	for n := 1; n <= cardinalities; n++ {
+		lc.Add(randomBytes[n])
+		estimate := m * math.Log(m/float64(uint64(m)-lc.bits.PopCount()))
+		if lc.Distinct() != uint64(math.Round(estimate)) {
+			t.Errorf("Expected Distinct rounded to the nearest integer %v, got %d", estimate, lc.Distinct())
+		}
+		roundedBias += float64(lc.Distinct()) - float64(n)
+		truncatedBias += float64(uint64(estimate)) - float64(n)
+	}
+	roundedBias /= float64(cardinalities)
+	truncatedBias /= float64(cardinalities)
+	if math.Abs(roundedBias-truncatedBias-0.5) > 0.05 {
+		t.Errorf("Expected rounding to remove the 1/2 underestimate of truncation, got bias %v vs truncated %v", roundedBias, truncatedBias)
+	}
+}
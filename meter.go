@@ -0,0 +1,74 @@
+package streamstats
+
+import "time"
+
+// Meter is a data structure for the rate of events in the style of the load average of a metrics library meter
+// it holds exponentially weighted rates with 1, 5 and 15 minute time constants, the total count of events
+// and the mean rate since creation
+type Meter struct {
+	now    func() time.Time // the clock used to timestamp events
+	start  time.Time        // the time the Meter was created
+	count  uint64           // the total number of events
+	rate1  EWRate
+	rate5  EWRate
+	rate15 EWRate
+}
+
+// NewMeter returns a new Meter using the system clock
+func NewMeter() *Meter {
+	return NewMeterWithClock(time.Now)
+}
+
+// NewMeterWithClock returns a new Meter that reads the current time from now, e.g. a fake clock in tests
+// a nil clock uses the system clock
+func NewMeterWithClock(now func() time.Time) *Meter {
+	if now == nil {
+		now = time.Now
+	}
+	return &Meter{
+		now:    now,
+		start:  now(),
+		rate1:  NewEWRate(time.Minute),
+		rate5:  NewEWRate(5 * time.Minute),
+		rate15: NewEWRate(15 * time.Minute),
+	}
+}
+
+// Mark records n events at the current time
+func (m *Meter) Mark(n uint64) {
+	t := m.now()
+	m.count += n
+	m.rate1.MarkAt(n, t)
+	m.rate5.MarkAt(n, t)
+	m.rate15.MarkAt(n, t)
+}
+
+// Count returns the total number of events marked
+func (m *Meter) Count() uint64 {
+	return m.count
+}
+
+// Rate1 returns the exponentially weighted rate of events per second with a 1 minute time constant
+func (m *Meter) Rate1() float64 {
+	return m.rate1.RateAt(m.now())
+}
+
+// Rate5 returns the exponentially weighted rate of events per second with a 5 minute time constant
+func (m *Meter) Rate5() float64 {
+	return m.rate5.RateAt(m.now())
+}
+
+// Rate15 returns the exponentially weighted rate of events per second with a 15 minute time constant
+func (m *Meter) Rate15() float64 {
+	return m.rate15.RateAt(m.now())
+}
+
+// MeanRate returns the mean rate of events per second since the Meter was created
+// or 0 if no time has elapsed
+func (m *Meter) MeanRate() float64 {
+	elapsed := m.now().Sub(m.start).Seconds()
+	if elapsed <= 0.0 {
+		return 0.0
+	}
+	return float64(m.count) / elapsed
+}
@@ -0,0 +1,55 @@
+package streamstats
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// fakeClock is a manually advanced clock for deterministic tests
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+func TestMeter(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)}
+	m := NewMeterWithClock(clock.now)
+	if m.MeanRate() != 0.0 || m.Rate1() != 0.0 {
+		t.Errorf("Expected no rate before any events, got %v and %v", m.MeanRate(), m.Rate1())
+	}
+	// 5 events every second for an hour
+	for i := 0; i < 3600; i++ {
+		clock.advance(time.Second)
+		m.Mark(5)
+	}
+	if m.Count() != 5*3600 {
+		t.Errorf("Expected Count %d, got %d", 5*3600, m.Count())
+	}
+	if m.MeanRate() != 5.0 {
+		t.Errorf("Expected MeanRate 5, got %v", m.MeanRate())
+	}
+	for _, rate := range []float64{m.Rate1(), m.Rate5(), m.Rate15()} {
+		if math.Abs(rate-5.0) > 0.1 {
+			t.Errorf("Expected a steady rate near 5, got %v", rate)
+		}
+	}
+	// after the events stop the shorter time constants decay faster
+	clock.advance(5 * time.Minute)
+	if !(m.Rate1() < m.Rate5() && m.Rate5() < m.Rate15()) {
+		t.Errorf("Expected Rate1 %v < Rate5 %v < Rate15 %v after events stop", m.Rate1(), m.Rate5(), m.Rate15())
+	}
+	if math.Abs(m.Rate5()-5.0/math.E) > 0.1 {
+		t.Errorf("Expected Rate5 to decay to %v after 5 minutes, got %v", 5.0/math.E, m.Rate5())
+	}
+	if math.Abs(m.MeanRate()-5.0*3600/3900) > 1e-9 {
+		t.Errorf("Expected MeanRate %v, got %v", 5.0*3600/3900, m.MeanRate())
+	}
+}
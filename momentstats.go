@@ -12,6 +12,17 @@ type MomentStats struct {
 	m2 float64
 	m3 float64
 	m4 float64
+	nonFinite
+}
+
+// MomentSnapshot is the derived values of a MomentStats at a point in time
+type MomentSnapshot struct {
+	N        uint64
+	Mean     float64
+	Variance float64
+	StdDev   float64
+	Skewness float64
+	Kurtosis float64
 }
 
 // NewMomentStats returns an empty MomentStats structure with no values
@@ -20,7 +31,11 @@ func NewMomentStats() *MomentStats {
 }
 
 // Add updates the moment stats
+// a NaN or infinite x is skipped and counted instead if SetSkipNonFinite is set
 func (m *MomentStats) Add(x float64) {
+	if m.skip(x) {
+		return
+	}
 	m.n++
 	fN := float64(m.n) // explicitly cast the number of observations to float64 for arithmetic operations
 	delta := x - m.m1
@@ -33,6 +48,21 @@ func (m *MomentStats) Add(x float64) {
 	m.m2 += term1
 }
 
+// AddN updates the moment stats with count observations of the value x in constant time,
+// e.g. for run-length encoded or binned data, by combining with the moments of the constant batch
+// which has mean x and zero central moments
+// a NaN or infinite x is skipped and counted count times instead if SetSkipNonFinite is set
+func (m *MomentStats) AddN(x float64, count uint64) {
+	if count == 0 {
+		return
+	}
+	if m.skip(x) {
+		m.skipped += count - 1
+		return
+	}
+	*m = m.Combine(&MomentStats{n: count, m1: x})
+}
+
 // N returns the observations stored so far
 func (m *MomentStats) N() uint64 {
 	return m.n
@@ -44,8 +74,9 @@ func (m *MomentStats) Mean() float64 {
 }
 
 // Variance returns the variance of the observations seen so far
+// a second moment made slightly negative by rounding error is treated as 0
 func (m *MomentStats) Variance() float64 {
-	if m.n < 2 {
+	if m.n < 2 || m.m2 <= 0.0 {
 		return 0.0
 	}
 	return m.m2 / (float64(m.n) - 1.0)
@@ -56,6 +87,21 @@ func (m *MomentStats) StdDev() float64 {
 	return math.Sqrt(m.Variance())
 }
 
+// CoefficientOfVariation returns the ratio of the standard deviation to the mean of the samples seen so far
+// for comparing the variability of series of different scales, it is negative for a negative mean
+// and 0 for a zero mean where it is undefined
+func (m *MomentStats) CoefficientOfVariation() float64 {
+	if m.Mean() == 0.0 {
+		return 0.0
+	}
+	return m.StdDev() / m.Mean()
+}
+
+// RelativeStdDev returns the coefficient of variation as a percentage, 100 * StdDev / Mean
+func (m *MomentStats) RelativeStdDev() float64 {
+	return 100.0 * m.CoefficientOfVariation()
+}
+
 // Skewness returns the skewness of the samples seen so far
 func (m *MomentStats) Skewness() float64 {
 	if m.m2 <= 0.0 {
@@ -72,11 +118,98 @@ func (m *MomentStats) Kurtosis() float64 {
 	return float64(m.n)*m.m4/(m.m2*m.m2) - 3.0
 }
 
+// Snapshot returns all of the derived values of the samples seen so far computed once
+func (m *MomentStats) Snapshot() MomentSnapshot {
+	variance := m.Variance()
+	return MomentSnapshot{
+		N:        m.n,
+		Mean:     m.m1,
+		Variance: variance,
+		StdDev:   math.Sqrt(variance),
+		Skewness: m.Skewness(),
+		Kurtosis: m.Kurtosis(),
+	}
+}
+
+// ApproxQuantile returns the p-quantile estimated from the moments by the Cornish-Fisher expansion
+// of the standard normal quantile z with the skewness S and excess kurtosis K of the samples seen so far
+// mean + stddev*(z + (z^2-1)S/6 + (z^3-3z)K/24 - (2z^3-5z)S^2/36)
+// it is only valid for near-normal data, for strongly skewed or heavy tailed data the expansion
+// can be far from the true quantile and is not even guaranteed to be monotonic in p
+// p = 0 and p = 1 return -Inf and +Inf and p outside [0, 1] returns NaN unless the standard deviation is 0
+func (m *MomentStats) ApproxQuantile(p float64) float64 {
+	sd := m.StdDev()
+	if sd == 0.0 {
+		return m.m1
+	}
+	z := math.Sqrt2 * math.Erfinv(2.0*p-1.0)
+	if math.IsInf(z, 0) {
+		return z
+	}
+	S, K := m.Skewness(), m.Kurtosis()
+	z2, z3 := z*z, z*z*z
+	w := z + (z2-1.0)*S/6.0 + (z3-3.0*z)*K/24.0 - (2.0*z3-5.0*z)*S*S/36.0
+	return m.m1 + sd*w
+}
+
+// Scale updates the moment stats as if every observation x seen so far had been a*x
+// e.g. to change the units of the observations without re-streaming
+func (m *MomentStats) Scale(a float64) {
+	a2 := a * a
+	m.m1 *= a
+	m.m2 *= a2
+	m.m3 *= a2 * a
+	m.m4 *= a2 * a2
+}
+
+// Shift updates the moment stats as if every observation x seen so far had been x+b
+// only the mean changes since the central moments are invariant under a shift
+func (m *MomentStats) Shift(b float64) {
+	m.m1 += b
+}
+
+// SkewnessStdError returns the standard error of the skewness of normally distributed samples of size n
+// sqrt(6n(n-1)/((n-2)(n+1)(n+3))), approximately sqrt(6/n) for large n, or 0 for fewer than 3 samples
+// a skewness more than about twice the standard error is unlikely for normally distributed samples
+func (m *MomentStats) SkewnessStdError() float64 {
+	if m.n < 3 {
+		return 0.0
+	}
+	n := float64(m.n)
+	return math.Sqrt(6.0 * n * (n - 1.0) / ((n - 2.0) * (n + 1.0) * (n + 3.0)))
+}
+
+// KurtosisStdError returns the standard error of the excess kurtosis of normally distributed samples of size n
+// 2*SkewnessStdError*sqrt((n^2-1)/((n-3)(n+5))), approximately sqrt(24/n) for large n, or 0 for fewer than 4 samples
+func (m *MomentStats) KurtosisStdError() float64 {
+	if m.n < 4 {
+		return 0.0
+	}
+	n := float64(m.n)
+	return 2.0 * m.SkewnessStdError() * math.Sqrt((n*n-1.0)/((n-3.0)*(n+5.0)))
+}
+
+// JarqueBera returns the Jarque-Bera test statistic for normality of the samples seen so far
+// (n/6)*(skewness^2 + kurtosis^2/4), which is asymptotically chi-squared distributed with two
+// degrees of freedom for normally distributed samples
+func (m *MomentStats) JarqueBera() float64 {
+	skew := m.Skewness()
+	kurt := m.Kurtosis()
+	return float64(m.n) / 6.0 * (skew*skew + kurt*kurt/4.0)
+}
+
+// IsApproximatelyNormal returns false if the Jarque-Bera test rejects normality of the samples seen so far
+// at the significance level alpha, i.e. the statistic exceeds the chi-squared(2) critical value -2*ln(alpha)
+func (m *MomentStats) IsApproximatelyNormal(alpha float64) bool {
+	return m.JarqueBera() <= -2.0*math.Log(alpha)
+}
+
 // Combine combines the stats from two MomentStats structures
 func (m *MomentStats) Combine(b *MomentStats) MomentStats {
 	var combined MomentStats
 
 	combined.n = m.n + b.n
+	combined.nonFinite = m.nonFinite.combine(b.nonFinite)
 
 	mN := float64(m.n) // convert to floats for arithmetic operations
 	bN := float64(b.n)
@@ -100,6 +233,54 @@ func (m *MomentStats) Combine(b *MomentStats) MomentStats {
 	return combined
 }
 
+// Remove inverts Combine, returning the stats of the complement of b assuming b is a subset of the observations
+// b must have fewer observations than the receiver, otherwise an empty MomentStats is returned
+// the higher moments are recovered by subtraction so precision is lost through cancellation
+// when b contains nearly all of the observations or has a very different mean than the complement
+func (m *MomentStats) Remove(b *MomentStats) MomentStats {
+	removed := MomentStats{nonFinite: m.nonFinite}
+	if b.n >= m.n {
+		return removed
+	}
+
+	removed.n = m.n - b.n
+
+	mN := float64(m.n) // convert to floats for arithmetic operations
+	bN := float64(b.n)
+	rN := float64(removed.n)
+
+	removed.m1 = (mN*m.m1 - bN*b.m1) / rN
+
+	delta := b.m1 - removed.m1
+	delta2 := delta * delta
+	delta3 := delta * delta2
+	delta4 := delta2 * delta2
+
+	removed.m2 = m.m2 - b.m2 - delta2*rN*bN/mN
+
+	removed.m3 = m.m3 - b.m3 - delta3*rN*bN*(rN-bN)/(mN*mN)
+	removed.m3 -= 3.0 * delta * (rN*b.m2 - bN*removed.m2) / mN
+
+	removed.m4 = m.m4 - b.m4 - delta4*rN*bN*(rN*rN-rN*bN+bN*bN)/(mN*mN*mN)
+	removed.m4 -= 6.0*delta2*(rN*rN*b.m2+bN*bN*removed.m2)/(mN*mN) + 4.0*delta*(rN*b.m3-bN*removed.m3)/mN
+
+	// cancellation can leave a tiny negative second moment for observations that are all nearly equal
+	removed.m2 = math.Max(0.0, removed.m2)
+
+	return removed
+}
+
+// RemoveValue updates the moment stats to remove a single observation x previously added, the inverse of Add
+// e.g. to maintain the stats of a sliding window, removing the only observation leaves empty stats
+// the moments are recovered by subtraction, so precision degrades when x is far from the mean relative to
+// the standard deviation or nearly all of the observations are removed, the result is meaningless if x was not added
+func (m *MomentStats) RemoveValue(x float64) {
+	if m.unskip(x) {
+		return
+	}
+	*m = m.Remove(&MomentStats{n: 1, m1: x})
+}
+
 // String returns the standard string representation of the samples seen so far
 func (m *MomentStats) String() string {
 	return fmt.Sprintf("Mean: %0.3f Variance: %0.3f Skewness: %0.3f Kurtosis: %0.3f N: %d", m.Mean(), m.Variance(), m.Skewness(), m.Kurtosis(), m.N())
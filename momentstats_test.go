@@ -3,7 +3,7 @@ package streamstats
 import (
 	"fmt"
 	"math"
-	"math/rand"
+	"sort"
 	"testing"
 )
 
@@ -20,7 +20,7 @@ func TestGaussianMomentStats(t *testing.T) {
 		t.Errorf("Expected zero Kurtosis with only one point added got %f", m.Kurtosis())
 	}
 
-	rand.Seed(42) // for deterministic testing
+	testRand.Seed(42) // for deterministic testing
 	N := 100000
 	// mean/stdev pairs for testing
 	testCases := [][2]float64{
@@ -93,6 +93,258 @@ func TestGaussianMomentStats(t *testing.T) {
 	}
 }
 
+func TestMomentStatsRemove(t *testing.T) {
+	mA := NewMomentStats()
+	mB := NewMomentStats()
+	for i := 0; i < N/4; i++ {
+		mA.Add(exponentialTestData[i])
+	}
+	for i := N / 4; i < N; i++ {
+		mB.Add(2.0*gaussianTestData[i] + 1.0)
+	}
+	mC := mA.Combine(mB)
+	// removing either partition from the total should recover the other
+	for _, tc := range []struct {
+		remove   *MomentStats
+		expected *MomentStats
+	}{
+		{mB, mA},
+		{mA, mB},
+	} {
+		r := mC.Remove(tc.remove)
+		eps := 1e-9
+		if r.N() != tc.expected.N() {
+			t.Errorf("Expected N %v, got %v", tc.expected.N(), r.N())
+		}
+		if math.Abs(r.Mean()-tc.expected.Mean()) > eps {
+			t.Errorf("Expected Mean %v, got %v", tc.expected.Mean(), r.Mean())
+		}
+		if math.Abs(r.Variance()-tc.expected.Variance()) > eps {
+			t.Errorf("Expected Variance %v, got %v", tc.expected.Variance(), r.Variance())
+		}
+		if math.Abs(r.Skewness()-tc.expected.Skewness()) > eps {
+			t.Errorf("Expected Skewness %v, got %v", tc.expected.Skewness(), r.Skewness())
+		}
+		if math.Abs(r.Kurtosis()-tc.expected.Kurtosis()) > eps {
+			t.Errorf("Expected Kurtosis %v, got %v", tc.expected.Kurtosis(), r.Kurtosis())
+		}
+	}
+	// removing everything or more leaves nothing
+	r := mA.Remove(mA)
+	if r.N() != 0 || r.Mean() != 0.0 || r.Variance() != 0.0 {
+		t.Errorf("Expected removing all observations to return empty stats, got %s", &r)
+	}
+	r = mA.Remove(mB)
+	if r.N() != 0 {
+		t.Errorf("Expected removing more observations than seen to return empty stats, got %s", &r)
+	}
+}
+
+func TestMomentStatsRemoveValue(t *testing.T) {
+	var m MomentStats
+	for i := 0; i < 1000; i++ {
+		m.Add(exponentialTestData[i])
+	}
+	before := m
+	for _, x := range []float64{0.5, 3.0, -2.0, 10.0} {
+		m.Add(x)
+		m.RemoveValue(x)
+		eps := 1e-9
+		if m.N() != before.N() {
+			t.Errorf("Expected N %v after removing %v, got %v", before.N(), x, m.N())
+		}
+		for _, tc := range []struct {
+			name             string
+			expected, actual float64
+		}{
+			{"Mean", before.Mean(), m.Mean()},
+			{"Variance", before.Variance(), m.Variance()},
+			{"Skewness", before.Skewness(), m.Skewness()},
+			{"Kurtosis", before.Kurtosis(), m.Kurtosis()},
+		} {
+			if math.Abs(tc.expected-tc.actual) > eps {
+				t.Errorf("Expected %s %v after removing %v, got %v", tc.name, tc.expected, x, tc.actual)
+			}
+		}
+	}
+	// removing the only observation leaves empty stats
+	var single MomentStats
+	single.Add(2.0)
+	single.RemoveValue(2.0)
+	if single.N() != 0 || single.Mean() != 0.0 || single.Variance() != 0.0 {
+		t.Errorf("Expected empty stats, got %s", &single)
+	}
+	// a skipped non-finite observation is removed from the skipped count
+	single.SetSkipNonFinite(true)
+	single.Add(1.0)
+	single.Add(math.NaN())
+	single.RemoveValue(math.NaN())
+	if single.N() != 1 || single.SkippedCount() != 0 || single.Mean() != 1.0 {
+		t.Errorf("Expected removing a skipped observation to only uncount it, got %s skipped %d", &single, single.SkippedCount())
+	}
+}
+
+func TestMomentStatsNegativeM2(t *testing.T) {
+	// removing the distinct observations of a large offset stream leaves equal observations
+	// whose second moment is recovered by cancellation and can round below 0
+	base := 1e6
+	var m MomentStats
+	for _, x := range []float64{base + 0.1, base + 0.7, base, base} {
+		m.Add(x)
+	}
+	m.RemoveValue(base + 0.1)
+	m.RemoveValue(base + 0.7)
+	if m.m2 < 0.0 {
+		t.Errorf("Expected the second moment to be clamped at 0, got %v", m.m2)
+	}
+	// a negative second moment is never reported as a negative variance or NaN
+	m = MomentStats{n: 2, m1: base, m2: -1e-10}
+	if v := m.Variance(); v != 0.0 {
+		t.Errorf("Expected Variance 0, got %v", v)
+	}
+	for _, v := range []float64{m.StdDev(), m.Skewness(), m.Kurtosis(), m.JarqueBera()} {
+		if math.IsNaN(v) {
+			t.Errorf("Expected no NaN from a negative second moment, got %s", &m)
+		}
+	}
+	m = MomentStats{n: 1, m1: base}
+	if m.Variance() != 0.0 || m.StdDev() != 0.0 {
+		t.Errorf("Expected Variance 0 for a single observation, got %v", m.Variance())
+	}
+}
+
+func TestMomentStatsScaleShift(t *testing.T) {
+	// y = a*x + b for a few affine transformations
+	testCases := [][2]float64{
+		{1000.0, 0.0}, // change of units
+		{0.001, -2.5},
+		{-3.0, 7.0}, // negative scale flips the skewness
+		{1.0, 42.0},
+	}
+	for _, testCase := range testCases {
+		a := testCase[0]
+		b := testCase[1]
+		m := NewMomentStats()
+		expected := NewMomentStats()
+		for i := 0; i < N; i++ {
+			m.Add(exponentialTestData[i])
+			expected.Add(a*exponentialTestData[i] + b)
+		}
+		m.Scale(a)
+		m.Shift(b)
+		eps := 1e-9
+		if m.N() != expected.N() {
+			t.Errorf("Expected N %v, got %v", expected.N(), m.N())
+		}
+		if math.Abs(m.Mean()-expected.Mean()) > eps*math.Abs(expected.Mean()) {
+			t.Errorf("a: %v b: %v Expected Mean %v, got %v", a, b, expected.Mean(), m.Mean())
+		}
+		if math.Abs(m.Variance()-expected.Variance()) > eps*expected.Variance() {
+			t.Errorf("a: %v b: %v Expected Variance %v, got %v", a, b, expected.Variance(), m.Variance())
+		}
+		if math.Abs(m.Skewness()-expected.Skewness()) > eps*math.Abs(expected.Skewness()) {
+			t.Errorf("a: %v b: %v Expected Skewness %v, got %v", a, b, expected.Skewness(), m.Skewness())
+		}
+		if math.Abs(m.Kurtosis()-expected.Kurtosis()) > eps*math.Abs(expected.Kurtosis()) {
+			t.Errorf("a: %v b: %v Expected Kurtosis %v, got %v", a, b, expected.Kurtosis(), m.Kurtosis())
+		}
+	}
+}
+
+func TestMomentStatsAddN(t *testing.T) {
+	var batched, looped MomentStats
+	testRand.Seed(42)
+	for i := 0; i < 1000; i++ {
+		x := gaussianTestData[i]
+		count := uint64(testRand.Intn(10)) // including empty runs
+		batched.AddN(x, count)
+		for c := uint64(0); c < count; c++ {
+			looped.Add(x)
+		}
+	}
+	if batched.N() != looped.N() {
+		t.Fatalf("Expected N %d, got %d", looped.N(), batched.N())
+	}
+	for _, tc := range []struct {
+		name             string
+		expected, actual float64
+	}{
+		{"mean", looped.Mean(), batched.Mean()},
+		{"variance", looped.Variance(), batched.Variance()},
+		{"skewness", looped.Skewness(), batched.Skewness()},
+		{"kurtosis", looped.Kurtosis(), batched.Kurtosis()},
+	} {
+		if math.Abs(tc.expected-tc.actual) > 1e-9*math.Max(1.0, math.Abs(tc.expected)) {
+			t.Errorf("Expected %s %v, got %v", tc.name, tc.expected, tc.actual)
+		}
+	}
+	var constant MomentStats
+	constant.AddN(3.0, 1<<40)
+	if constant.N() != 1<<40 || constant.Mean() != 3.0 || constant.Variance() != 0.0 {
+		t.Errorf("Expected %d observations of 3 with no variance, got %s", uint64(1<<40), constant.String())
+	}
+	constant.SetSkipNonFinite(true)
+	constant.AddN(math.Inf(1), 7)
+	if constant.N() != 1<<40 || constant.SkippedCount() != 7 {
+		t.Errorf("Expected 7 skipped observations, got N %d skipped %d", constant.N(), constant.SkippedCount())
+	}
+}
+
+func TestMomentStatsCoefficientOfVariation(t *testing.T) {
+	var m MomentStats
+	if m.CoefficientOfVariation() != 0.0 {
+		t.Errorf("Expected 0 for no samples, got %v", m.CoefficientOfVariation())
+	}
+	for _, x := range []float64{2.0, 4.0, 4.0, 4.0, 5.0, 5.0, 7.0, 9.0} {
+		m.Add(x)
+	}
+	// mean 5 and sample standard deviation sqrt(32/7)
+	expected := math.Sqrt(32.0/7.0) / 5.0
+	if math.Abs(m.CoefficientOfVariation()-expected) > 1e-12 {
+		t.Errorf("Expected CV %v, got %v", expected, m.CoefficientOfVariation())
+	}
+	if math.Abs(m.RelativeStdDev()-100.0*expected) > 1e-10 {
+		t.Errorf("Expected RSD %v%%, got %v%%", 100.0*expected, m.RelativeStdDev())
+	}
+	// the CV is invariant to scale and takes the sign of the mean
+	m.Scale(-3.0)
+	if math.Abs(m.CoefficientOfVariation()+expected) > 1e-12 {
+		t.Errorf("Expected CV %v after scaling by -3, got %v", -expected, m.CoefficientOfVariation())
+	}
+	m.Shift(15.0)
+	if m.Mean() != 0.0 || m.CoefficientOfVariation() != 0.0 || m.RelativeStdDev() != 0.0 {
+		t.Errorf("Expected 0 for a zero mean, got CV %v", m.CoefficientOfVariation())
+	}
+}
+
+func TestMomentStatsJarqueBera(t *testing.T) {
+	alpha := 0.01
+	m := NewMomentStats()
+	for i := 0; i < N; i++ {
+		m.Add(gaussianTestData[i])
+	}
+	expected := float64(m.N()) / 6.0 * (m.Skewness()*m.Skewness() + m.Kurtosis()*m.Kurtosis()/4.0)
+	if m.JarqueBera() != expected {
+		t.Errorf("Expected JarqueBera %v, got %v", expected, m.JarqueBera())
+	}
+	if !m.IsApproximatelyNormal(alpha) {
+		t.Errorf("Expected gaussian data to be approximately normal, got JarqueBera %v", m.JarqueBera())
+	}
+
+	m = NewMomentStats()
+	for i := 0; i < N; i++ {
+		m.Add(exponentialTestData[i])
+	}
+	if m.IsApproximatelyNormal(alpha) {
+		t.Errorf("Expected exponential data to not be approximately normal, got JarqueBera %v", m.JarqueBera())
+	}
+
+	m = NewMomentStats()
+	if m.JarqueBera() != 0.0 {
+		t.Errorf("Expected JarqueBera of no data to be 0, got %v", m.JarqueBera())
+	}
+}
+
 func BenchmarkMomentStatsAdd(b *testing.B) {
 	m := NewMomentStats()
 	for i := 0; i < b.N; i++ {
@@ -100,3 +352,104 @@ func BenchmarkMomentStatsAdd(b *testing.B) {
 	}
 	result = m.Mean() // to avoid optimizing out the loop entirely
 }
+
+func TestMomentStatsSnapshot(t *testing.T) {
+	var m MomentStats
+	if s := m.Snapshot(); s != (MomentSnapshot{}) {
+		t.Errorf("Expected an empty snapshot, got %+v", s)
+	}
+	for i := 0; i < N; i++ {
+		m.Add(exponentialTestData[i])
+	}
+	expected := MomentSnapshot{
+		N:        m.N(),
+		Mean:     m.Mean(),
+		Variance: m.Variance(),
+		StdDev:   m.StdDev(),
+		Skewness: m.Skewness(),
+		Kurtosis: m.Kurtosis(),
+	}
+	if s := m.Snapshot(); s != expected {
+		t.Errorf("Expected snapshot %+v, got %+v", expected, s)
+	}
+}
+
+func TestMomentStatsApproxQuantile(t *testing.T) {
+	var gaussian MomentStats
+	for i := 0; i < N; i++ {
+		gaussian.Add(10.0 + 2.0*gaussianTestData[i])
+	}
+	for _, tc := range []struct{ p, z float64 }{
+		{0.05, -1.6449},
+		{0.25, -0.6745},
+		{0.5, 0.0},
+		{0.75, 0.6745},
+		{0.95, 1.6449},
+	} {
+		if expected := 10.0 + 2.0*tc.z; math.Abs(gaussian.ApproxQuantile(tc.p)-expected) > 0.1 {
+			t.Errorf("Expected %v-quantile %v, got %v", tc.p, expected, gaussian.ApproxQuantile(tc.p))
+		}
+	}
+	// the sum of 10 exponentials is moderately skewed, the expansion improves on the normal quantile
+	var skewed MomentStats
+	sample := make([]float64, N/10)
+	for i := range sample {
+		for j := 0; j < 10; j++ {
+			sample[i] += exponentialTestData[10*i+j]
+		}
+		skewed.Add(sample[i])
+	}
+	sort.Float64s(sample)
+	for _, tc := range []struct{ p, z float64 }{
+		{0.05, -1.6449},
+		{0.95, 1.6449},
+		{0.99, 2.3263},
+	} {
+		expected := sortedQuantile(sample, tc.p)
+		normal := skewed.Mean() + skewed.StdDev()*tc.z
+		if cf := skewed.ApproxQuantile(tc.p); math.Abs(cf-expected) >= math.Abs(normal-expected) {
+			t.Errorf("Expected the %v-quantile %v closer to %v than the normal %v", tc.p, cf, expected, normal)
+		}
+	}
+	if !math.IsInf(gaussian.ApproxQuantile(0.0), -1) || !math.IsInf(gaussian.ApproxQuantile(1.0), 1) || !math.IsNaN(gaussian.ApproxQuantile(2.0)) {
+		t.Errorf("Expected -Inf, +Inf and NaN for p of 0, 1 and 2")
+	}
+	constant := MomentStats{n: 3, m1: 4.0}
+	if constant.ApproxQuantile(0.9) != 4.0 {
+		t.Errorf("Expected the mean with zero variance, got %v", constant.ApproxQuantile(0.9))
+	}
+}
+
+func TestMomentStatsStdErrors(t *testing.T) {
+	var m MomentStats
+	for i := 0; i < 3; i++ {
+		if m.KurtosisStdError() != 0.0 {
+			t.Errorf("Expected KurtosisStdError 0 for %d samples, got %v", m.N(), m.KurtosisStdError())
+		}
+		if m.N() < 3 && m.SkewnessStdError() != 0.0 {
+			t.Errorf("Expected SkewnessStdError 0 for %d samples, got %v", m.N(), m.SkewnessStdError())
+		}
+		m.Add(gaussianTestData[i])
+	}
+	for i := 3; i < N; i++ {
+		m.Add(gaussianTestData[i])
+	}
+	n := float64(N)
+	if ses := m.SkewnessStdError(); math.Abs(ses-math.Sqrt(6.0/n))/ses > 0.01 {
+		t.Errorf("Expected SkewnessStdError near sqrt(6/n) = %v, got %v", math.Sqrt(6.0/n), ses)
+	}
+	if sek := m.KurtosisStdError(); math.Abs(sek-math.Sqrt(24.0/n))/sek > 0.01 {
+		t.Errorf("Expected KurtosisStdError near sqrt(24/n) = %v, got %v", math.Sqrt(24.0/n), sek)
+	}
+	// normally distributed samples are within a few standard errors, exponential samples are not
+	if math.Abs(m.Skewness()) > 3*m.SkewnessStdError() || math.Abs(m.Kurtosis()) > 3*m.KurtosisStdError() {
+		t.Errorf("Expected normal skewness %v and kurtosis %v within 3 standard errors", m.Skewness(), m.Kurtosis())
+	}
+	var e MomentStats
+	for i := 0; i < N; i++ {
+		e.Add(exponentialTestData[i])
+	}
+	if e.Skewness() < 3*e.SkewnessStdError() || e.Kurtosis() < 3*e.KurtosisStdError() {
+		t.Errorf("Expected exponential skewness %v and kurtosis %v beyond 3 standard errors", e.Skewness(), e.Kurtosis())
+	}
+}
@@ -0,0 +1,52 @@
+package streamstats
+
+import "math"
+
+// nonFinite optionally skips NaN and infinite observations, which would otherwise propagate through
+// the recurrences of the streaming estimates and poison every subsequent estimate, and counts the skipped observations
+// by default non-finite observations are not skipped
+type nonFinite struct {
+	skipNonFinite bool
+	skipped       uint64
+}
+
+// SetSkipNonFinite sets whether NaN and infinite observations are skipped and counted rather than added
+func (f *nonFinite) SetSkipNonFinite(skip bool) {
+	f.skipNonFinite = skip
+}
+
+// SkippedCount returns the number of non-finite observations skipped
+func (f *nonFinite) SkippedCount() uint64 {
+	return f.skipped
+}
+
+// skip returns true and counts the observation if any of xs is non-finite and non-finite observations are skipped
+func (f *nonFinite) skip(xs ...float64) bool {
+	if !f.skipNonFinite {
+		return false
+	}
+	for _, x := range xs {
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			f.skipped++
+			return true
+		}
+	}
+	return false
+}
+
+// unskip returns true and uncounts the observation if x is non-finite and non-finite observations are skipped
+// the inverse of skip for removing an observation
+func (f *nonFinite) unskip(x float64) bool {
+	if !f.skipNonFinite || !(math.IsNaN(x) || math.IsInf(x, 0)) {
+		return false
+	}
+	if f.skipped > 0 {
+		f.skipped--
+	}
+	return true
+}
+
+// combine returns the setting of the receiver with the skipped observations of both
+func (f nonFinite) combine(b nonFinite) nonFinite {
+	return nonFinite{skipNonFinite: f.skipNonFinite, skipped: f.skipped + b.skipped}
+}
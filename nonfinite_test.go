@@ -0,0 +1,83 @@
+package streamstats
+
+import (
+	"math"
+	"testing"
+)
+
+// nonFiniteAdder is the part of the API shared by the types that can skip non-finite observations
+type nonFiniteAdder interface {
+	Add(x float64)
+	SetSkipNonFinite(skip bool)
+	SkippedCount() uint64
+}
+
+// covarAdder adds x as both variables of the CovarStats
+type covarAdder struct {
+	*CovarStats
+}
+
+func (c covarAdder) Add(x float64) {
+	c.CovarStats.Add(x, x)
+}
+
+func TestSkipNonFinite(t *testing.T) {
+	nonFiniteValues := []float64{math.NaN(), math.Inf(1), math.Inf(-1)}
+	for _, tc := range []struct {
+		name     string
+		new      func() nonFiniteAdder
+		estimate func(a nonFiniteAdder) float64
+	}{
+		{"MomentStats", func() nonFiniteAdder { return NewMomentStats() }, func(a nonFiniteAdder) float64 { return a.(*MomentStats).Kurtosis() }},
+		{"EWMA", func() nonFiniteAdder { e := NewEWMA(0.0, 0.1); return &e }, func(a nonFiniteAdder) float64 { return a.(*EWMA).Mean() }},
+		{"P2Quantile", func() nonFiniteAdder { q := NewP2Quantile(0.5); return &q }, func(a nonFiniteAdder) float64 { return a.(*P2Quantile).Quantile() }},
+		{"P2Histogram", func() nonFiniteAdder { h := NewP2Histogram(8); return &h }, func(a nonFiniteAdder) float64 { return a.(*P2Histogram).Quantile(0.5) }},
+		{"CovarStats", func() nonFiniteAdder { return covarAdder{NewCovarStats()} }, func(a nonFiniteAdder) float64 { return a.(covarAdder).Slope() }},
+	} {
+		expected := tc.new()
+		skipping := tc.new()
+		skipping.SetSkipNonFinite(true)
+		for i := 0; i < 1000; i++ {
+			expected.Add(gaussianTestData[i])
+			skipping.Add(gaussianTestData[i])
+			if i%100 == 0 {
+				skipping.Add(nonFiniteValues[(i/100)%len(nonFiniteValues)])
+			}
+		}
+		if skipping.SkippedCount() != 10 {
+			t.Errorf("%s: Expected 10 skipped observations, got %d", tc.name, skipping.SkippedCount())
+		}
+		if e, s := tc.estimate(expected), tc.estimate(skipping); e != s {
+			t.Errorf("%s: Expected skipping non-finite observations to give %v, got %v", tc.name, e, s)
+		}
+		// by default the non-finite observations are added
+		poisoned := tc.new()
+		poisoned.Add(0.0)
+		poisoned.Add(math.NaN())
+		for i := 0; i < 1000; i++ {
+			poisoned.Add(gaussianTestData[i])
+		}
+		if poisoned.SkippedCount() != 0 {
+			t.Errorf("%s: Expected no skipped observations by default, got %d", tc.name, poisoned.SkippedCount())
+		}
+	}
+}
+
+func TestSkipNonFiniteCovarStats(t *testing.T) {
+	cv := NewCovarStats()
+	cv.SetSkipNonFinite(true)
+	cv.Add(1.0, math.NaN())
+	cv.Add(math.Inf(1), 1.0)
+	cv.Add(1.0, 2.0)
+	if cv.N() != 1 || cv.SkippedCount() != 2 {
+		t.Errorf("Expected a sample with either variable non-finite to be skipped, got N %d skipped %d", cv.N(), cv.SkippedCount())
+	}
+	other := NewCovarStats()
+	other.SetSkipNonFinite(true)
+	other.Add(math.NaN(), math.NaN())
+	other.Add(2.0, 3.0)
+	combined := cv.Combine(other)
+	if combined.N() != 2 || combined.SkippedCount() != 3 {
+		t.Errorf("Expected Combine to sum the skipped samples, got N %d skipped %d", combined.N(), combined.SkippedCount())
+	}
+}
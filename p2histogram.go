@@ -1,5 +1,22 @@
 package streamstats
 
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// p2HistogramEncodingVersion is the version byte of the MarshalBinary encoding of a P2Histogram
+const p2HistogramEncodingVersion = 1
+
+// klSmoothing is the probability added to every bin when computing the KLDivergence
+// to avoid infinite divergence for bins that are empty in the baseline
+const klSmoothing = 1e-3
+
 // P2Histogram is an O(1) time and space data structure
 // for estimating the evenly spaced histogram bins of a series of N data points based on the
 // "The P2 Algorithm for Dynamic Computing Calculation of Quantiles and
@@ -9,10 +26,17 @@ type P2Histogram struct {
 	b uint64    // the number of bins to be tracked
 	n []uint64  // the actual counts for each marker
 	q []float64 // the value of each marker, i.e. the estimated quantile
+
+	adjustments uint64 // the number of times an internal marker height has been adjusted
+	nonFinite
 }
 
-// NewP2Histogram intializes the data structure to track b bins
+// NewP2Histogram intializes the data structure to track b bins, b is bounded below by 1
+// with b = 1 only the minimum and maximum are tracked, and with b = 2 the median as well
 func NewP2Histogram(b uint64) P2Histogram {
+	if b < 1 {
+		b = 1
+	}
 	n := make([]uint64, b+1, b+1)
 	q := make([]float64, b+1, b+1)
 	for i := uint64(0); i < b; i++ {
@@ -25,72 +49,254 @@ func NewP2Histogram(b uint64) P2Histogram {
 	}
 }
 
-// Add updates the data structure with a given x value
-func (h *P2Histogram) Add(x float64) {
+// NewP2HistogramFromSample intializes the data structure to track b bins with the markers placed
+// at the exact empirical quantiles of the sample, sorting the sample once instead of adding each value
+// this is a warm start for subsequent streaming updates, not an exact histogram of the sample
+// since only the b+1 markers are retained
+func NewP2HistogramFromSample(b uint64, sample []float64) P2Histogram {
+	h := NewP2Histogram(b)
+	b = h.b
+	N := uint64(len(sample))
+	if N < b+1 {
+		for _, x := range sample {
+			h.Add(x)
+		}
+		return h
+	}
+	sorted := make([]float64, N, N)
+	copy(sorted, sample)
+	sort.Float64s(sorted)
+	for i := uint64(0); i <= b; i++ {
+		h.n[i] = 1 + uint64(float64(i)*float64(N-1)/float64(b)+0.5) // round to the nearest position
+		h.q[i] = sorted[h.n[i]-1]
+	}
+	return h
+}
 
-	if h.n[h.b] < uint64(h.b)+1 {
-		// Initialization:
-		i := h.n[h.b] // the current count
-		h.q[i] = x    // add the new element on the end
-		// insertion sort the elements
-		for i > 0 && h.q[i-1] > h.q[i] {
-			t := h.q[i-1]
-			h.q[i-1] = h.q[i]
-			h.q[i] = t
-			i--
-		}
-		h.n[h.b]++
+// Downsample returns a new P2Histogram with newB bins whose markers are placed at evenly spaced positions
+// on the current histogram, interpolating the marker values, so the accumulated distribution is preserved
+// newB is bounded by 1 and the current number of bins b, while the markers are still the observations
+// the observations are added to the new histogram exactly
+func (h *P2Histogram) Downsample(newB uint64) *P2Histogram {
+	if newB > h.b {
+		newB = h.b
+	}
+	if newB < 1 {
+		newB = 1
+	}
+	d := NewP2Histogram(newB)
+	d.nonFinite = h.nonFinite
+	N := h.N()
+	if N < newB+1 {
+		for _, x := range h.q[:N] {
+			d.Add(x)
+		}
+		return &d
+	}
+	for i := uint64(0); i <= newB; i++ {
+		d.n[i] = 1 + uint64(float64(i)*float64(N-1)/float64(newB)+0.5) // round to the nearest position
+		d.q[i] = h.Quantile(float64(d.n[i]) / float64(N))
+	}
+	d.q[0], d.q[newB] = h.Min(), h.Max()
+	return &d
+}
+
+// MarshalBinary encodes the P2Histogram as a version byte followed by the big-endian uint64 number of bins b,
+// the adjustment count, the b+1 marker counts and the b+1 marker values as float64 bits
+func (h *P2Histogram) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 1, 17+16*(h.b+1))
+	data[0] = p2HistogramEncodingVersion
+	data = binary.BigEndian.AppendUint64(data, h.b)
+	data = binary.BigEndian.AppendUint64(data, h.adjustments)
+	for _, n := range h.n {
+		data = binary.BigEndian.AppendUint64(data, n)
+	}
+	for _, q := range h.q {
+		data = binary.BigEndian.AppendUint64(data, math.Float64bits(q))
+	}
+	return data, nil
+}
+
+// UnmarshalBinary decodes a P2Histogram encoded by MarshalBinary replacing the receiver
+// it returns an error without modifying the receiver if the data does not hold exactly b+1 counts and markers
+// or the decoded histogram fails Validate
+func (h *P2Histogram) UnmarshalBinary(data []byte) error {
+	if len(data) < 17 {
+		return fmt.Errorf("P2Histogram encoding is too short, %d bytes", len(data))
+	}
+	if data[0] != p2HistogramEncodingVersion {
+		return fmt.Errorf("P2Histogram encoding version %d is not supported", data[0])
+	}
+	b := binary.BigEndian.Uint64(data[1:])
+	if b < 1 || b > uint64(len(data)-17)/16 || uint64(len(data)) != 17+16*(b+1) {
+		return fmt.Errorf("P2Histogram encoding of %d bytes does not hold %d+1 counts and markers", len(data), b)
+	}
+	decoded := P2Histogram{
+		b:           b,
+		n:           make([]uint64, b+1, b+1),
+		q:           make([]float64, b+1, b+1),
+		adjustments: binary.BigEndian.Uint64(data[9:]),
+		nonFinite:   h.nonFinite, // the setting is not encoded
+	}
+	data = data[17:]
+	for i := range decoded.n {
+		decoded.n[i] = binary.BigEndian.Uint64(data[8*i:])
+	}
+	data = data[8*(b+1):]
+	for i := range decoded.q {
+		decoded.q[i] = math.Float64frombits(binary.BigEndian.Uint64(data[8*i:]))
+	}
+	if err := decoded.Validate(); err != nil {
+		return err
+	}
+	*h = decoded
+	return nil
+}
+
+// Validate returns an error if the markers or their counts are inconsistent, e.g. decoded from corrupt data,
+// which would otherwise produce garbage quantiles since Quantile and Add search the markers in order
+// the markers of the observations seen must be non-decreasing, and the counts must be the initial positions
+// 1, 2, ..., b while at most b observations are seen and strictly increasing from 1 to N after that
+func (h *P2Histogram) Validate() error {
+	if h.b < 1 || uint64(len(h.n)) != h.b+1 || uint64(len(h.q)) != h.b+1 {
+		return fmt.Errorf("P2Histogram of %d bins has %d counts and %d markers", h.b, len(h.n), len(h.q))
+	}
+	N := h.N()
+	if N <= h.b {
+		for i := uint64(0); i < h.b; i++ {
+			if h.n[i] != i+1 {
+				return fmt.Errorf("P2Histogram count %d is %d, expected %d while initializing", i, h.n[i], i+1)
+			}
+		}
 	} else {
-		// find which bin the new element lies in
-		var k uint64
-		if x < h.q[0] {
-			h.q[0] = x // new minimum
-			k = 0
-		} else if h.q[h.b] < x {
-			h.q[h.b] = x // new maximum
-			k = uint64(h.b) - 1
-		} else { // check which bin the measurement falls into
-			for i := uint64(1); i <= h.b; i++ {
-				if x < h.q[i] {
-					k = uint64(i - 1)
-					break
-				}
+		if h.n[0] != 1 {
+			return fmt.Errorf("P2Histogram count of the minimum is %d, expected 1", h.n[0])
+		}
+		for i := uint64(1); i <= h.b; i++ {
+			if h.n[i-1] >= h.n[i] {
+				return fmt.Errorf("P2Histogram counts are not increasing, %d >= %d", h.n[i-1], h.n[i])
 			}
 		}
-		// update the actual counts for the markers
-		for i := k + 1; i < uint64(h.b)+1; i++ {
-			h.n[i]++
+	}
+	L := N // only the markers of the observations seen are set
+	if L > h.b+1 {
+		L = h.b + 1
+	}
+	for i := uint64(1); i < L; i++ {
+		if !(h.q[i-1] <= h.q[i]) {
+			return fmt.Errorf("P2Histogram markers are not non-decreasing, %v > %v", h.q[i-1], h.q[i])
 		}
-		// adjust heights of internal markers if necessary
-		for i := uint64(1); i < h.b; i++ {
-			np := 1.0 + float64(i)*(float64(h.n[h.b])-1.0)/float64(h.b)
-			d := np - float64(h.n[i]) // the difference from the target
-			if (d >= 1.0 && h.n[i]+1 < h.n[i+1]) || (d <= -1.0 && h.n[i-1]+1 < h.n[i]) {
-				// delta is always snapped to +/- 1
-				if d >= 1.0 {
-					d = 1.0
-				} else {
-					d = -1.0
-				}
-				// try using the piecewise polynomial degree 2 formula
-				fNm := float64(h.n[i-1])
-				fN := float64(h.n[i])
-				fNp := float64(h.n[i+1])
-				qp := h.q[i] + d*((fN-fNm+d)*(h.q[i+1]-h.q[i])/(fNp-fN)+(fNp-fN-d)*(h.q[i]-h.q[i-1])/(fN-fNm))/(fNp-fNm)
-				if h.q[i-1] < qp && qp < h.q[i+1] {
-					h.q[i] = qp
-				} else { // use linear formula if degree 2 formula would result in out of order markers
-					ip := int(i) + int(d)
-					h.q[i] += d * (h.q[ip] - h.q[i]) / (float64(h.n[ip]) - fN)
-				}
-				if d > 0 { // increment the counter for the bin after adjustments were made
-					h.n[i]++
-				} else {
-					h.n[i]--
-				}
+	}
+	return nil
+}
+
+// Push is an alias of Add matching P2Quantile.Push and TimeWindow.Push
+// Add is the canonical name for P2Histogram and should be used in new code
+func (h *P2Histogram) Push(x float64) {
+	h.Add(x)
+}
+
+// Add updates the data structure with a given x value
+// a NaN or infinite x is skipped and counted instead if SetSkipNonFinite is set
+func (h *P2Histogram) Add(x float64) {
+	if h.skip(x) {
+		return
+	}
+	if h.n[h.b] < uint64(h.b)+1 {
+		h.insert(x)
+	} else {
+		h.update(x, 1)
+	}
+}
+
+// AddN updates the data structure with count observations of the value x, e.g. from pre-aggregated (value, count) bins
+// once the markers are estimates the counts are incremented together and each internal marker is adjusted once
+// by up to count positions toward its target instead of once per observation, so the cost does not depend on count
+// and AddN(x, 1) is identical to Add(x), a marker moving past x by several positions is placed at x and
+// otherwise the heights are interpolated with the same piecewise polynomial formula over the larger moves,
+// so the markers differ slightly from adding x count times
+// a NaN or infinite x is skipped and counted count times instead if SetSkipNonFinite is set
+func (h *P2Histogram) AddN(x float64, count uint64) {
+	if count == 0 {
+		return
+	}
+	if h.skip(x) {
+		h.skipped += count - 1
+		return
+	}
+	for ; count > 0 && h.n[h.b] < uint64(h.b)+1; count-- {
+		h.insert(x)
+	}
+	if count > 0 {
+		h.update(x, count)
+	}
+}
+
+// insert adds one of the first b+1 observations, which are the markers, keeping them sorted
+func (h *P2Histogram) insert(x float64) {
+	i := h.n[h.b] // the current count
+	h.q[i] = x    // add the new element on the end
+	// insertion sort the elements
+	for i > 0 && h.q[i-1] > h.q[i] {
+		t := h.q[i-1]
+		h.q[i-1] = h.q[i]
+		h.q[i] = t
+		i--
+	}
+	h.n[h.b]++
+}
+
+// update adds count observations of x once the markers are estimates, moving each internal marker
+// at most one position per observation toward its target position
+func (h *P2Histogram) update(x float64, count uint64) {
+	// find which bin the new element lies in
+	var k uint64
+	if x < h.q[0] {
+		h.q[0] = x // new minimum
+		k = 0
+	} else if h.q[h.b] < x {
+		h.q[h.b] = x // new maximum
+		k = uint64(h.b) - 1
+	} else { // check which bin the measurement falls into
+		k = h.b - 1 // a value equal to the maximum is in the last bin
+		for i := uint64(1); i <= h.b; i++ {
+			if x < h.q[i] {
+				k = uint64(i - 1)
+				break
 			}
 		}
 	}
+	// update the actual counts for the markers
+	for i := k + 1; i < uint64(h.b)+1; i++ {
+		h.n[i] += count
+	}
+	// adjust heights of internal markers if necessary
+	for i := uint64(1); i < h.b; i++ {
+		np := 1.0 + float64(i)*(float64(h.n[h.b])-1.0)/float64(h.b)
+		d := np - float64(h.n[i]) // the difference from the target
+		if d >= 1.0 && h.n[i]+1 < h.n[i+1] {
+			step := min(uint64(d), count, h.n[i+1]-h.n[i]-1) // stay before the next marker
+			h.q[i] = h.batchHeight(x, i, float64(step))
+			h.n[i] += step // increment the counter for the bin after adjustments were made
+			h.adjustments++
+		} else if d <= -1.0 && h.n[i-1]+1 < h.n[i] {
+			step := min(uint64(-d), count, h.n[i]-h.n[i-1]-1) // stay after the previous marker
+			h.q[i] = h.batchHeight(x, i, -float64(step))
+			h.n[i] -= step
+			h.adjustments++
+		}
+	}
+}
+
+// batchHeight returns the new height of internal marker i moved by d positions after adding observations of x
+// a marker that would move more than one position past x is instead placed at x, since the observations of x
+// fill a run of positions that the marker most likely lands in, a move of one position is the usual P2 update
+func (h *P2Histogram) batchHeight(x float64, i uint64, d float64) float64 {
+	q := adjustedHeight(h.q, h.n, int(i), d)
+	if math.Abs(d) > 1.0 && ((h.q[i] < x && x < q) || (q < x && x < h.q[i])) {
+		return x
+	}
+	return q
 }
 
 // N returns the number of observations seen so far
@@ -99,6 +305,55 @@ func (h *P2Histogram) N() uint64 {
 	return h.n[h.b]
 }
 
+// IsExact returns true while the markers are the literal observations, the first b+1 observations,
+// and false once the markers are estimates
+func (h *P2Histogram) IsExact() bool {
+	return h.n[h.b] <= h.b+1
+}
+
+// AdjustmentCount returns the number of times an internal marker height has been adjusted
+// markers are adjusted often while the histogram converges, a high rate of adjustments late
+// in a long stream indicates a non-stationary distribution
+func (h *P2Histogram) AdjustmentCount() uint64 {
+	return h.adjustments
+}
+
+// EstimatedError returns a rough heuristic for the error in the probabilities of the histogram,
+// and equivalently in the percentages of the estimated quantiles, as the sum of
+// the 95% Dvoretzky–Kiefer–Wolfowitz bound on the sampling error of an empirical CDF, 1.36/sqrt(N),
+// half of the probability in each bin, 1/(2b), since values are linearly interpolated between markers,
+// and the largest deviation of an internal marker from its target position as a fraction of N
+// it is not a rigorous bound, but indicates when too few observations have been seen to trust the histogram
+func (h *P2Histogram) EstimatedError() float64 {
+	N := h.N()
+	if N == 0 {
+		return 1.0
+	}
+	fN := float64(N)
+	estimate := 1.36 / math.Sqrt(fN)
+	bins := h.b
+	if N < h.b+1 {
+		bins = N - 1 // the markers are the observations themselves
+	}
+	if bins > 0 {
+		estimate += 1.0 / (2.0 * float64(bins))
+	}
+	if N >= h.b+1 {
+		var imbalance float64
+		for i := uint64(1); i < h.b; i++ {
+			np := 1.0 + float64(i)*(fN-1.0)/float64(h.b)
+			if d := math.Abs(np - float64(h.n[i])); d > imbalance {
+				imbalance = d
+			}
+		}
+		estimate += imbalance / fN
+	}
+	if estimate > 1.0 {
+		return 1.0
+	}
+	return estimate
+}
+
 // CumulativeDensity represents the probability P of observing a value less than or equal to X
 type CumulativeDensity struct {
 	X float64
@@ -120,6 +375,123 @@ func (h *P2Histogram) Histogram() []CumulativeDensity {
 	return cdf
 }
 
+// String returns the standard string representation of the histogram as the value and cumulative
+// probability of each marker with a fixed precision so the same observations always produce the same string
+func (h *P2Histogram) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "P2Histogram N: %d Bins: %d", h.N(), h.b)
+	for _, cd := range h.Histogram() {
+		fmt.Fprintf(&b, " %0.3f:%0.3f", cd.X, cd.P)
+	}
+	return b.String()
+}
+
+// Density returns the histogram as the bin edges, the marker values, and the probability density
+// in each bin, the probability in the bin divided by its width, e.g. for plotting as a bar chart
+// density[i] is the density between edges[i] and edges[i+1] so there is one less density than edges
+// a bin between duplicate markers has zero width and is given zero density
+func (h *P2Histogram) Density() (edges []float64, density []float64) {
+	CDF := h.Histogram()
+	edges = make([]float64, len(CDF), len(CDF))
+	for i, cd := range CDF {
+		edges[i] = cd.X
+	}
+	if len(CDF) < 2 {
+		return edges, []float64{}
+	}
+	density = make([]float64, len(CDF)-1, len(CDF)-1)
+	for i := range density {
+		if width := CDF[i+1].X - CDF[i].X; width > 0 {
+			density[i] = (CDF[i+1].P - CDF[i].P) / width
+		}
+	}
+	return edges, density
+}
+
+// sparkBlocks are the block characters used by Sparkline from lowest to highest
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// renderBarWidth is the number of characters in the longest bar of RenderHistogram
+const renderBarWidth = 50
+
+// Sparkline returns the density of the histogram as a single line of block characters
+// with the range from Min to Max divided into width equal columns, each scaled by the highest column
+// columns with no probability are rendered as a space
+func (h *P2Histogram) Sparkline(width int) string {
+	if width < 1 || h.N() == 0 {
+		return ""
+	}
+	columns := h.columnProbabilities(width)
+	var max float64
+	for _, p := range columns {
+		max = math.Max(max, p)
+	}
+	line := make([]rune, width, width)
+	for i, p := range columns {
+		if p <= 0.0 {
+			line[i] = ' '
+			continue
+		}
+		level := int(p / max * float64(len(sparkBlocks)))
+		if level >= len(sparkBlocks) {
+			level = len(sparkBlocks) - 1
+		}
+		line[i] = sparkBlocks[level]
+	}
+	return string(line)
+}
+
+// RenderHistogram writes the histogram as a multi-line horizontal bar chart with one row for each of b equal
+// width intervals from Min to Max, labeled with the lower edge of the interval and the percentage of
+// observations, followed by a final row labeled with the Max
+func (h *P2Histogram) RenderHistogram(w io.Writer) error {
+	if h.N() == 0 {
+		_, err := fmt.Fprintln(w, "empty histogram")
+		return err
+	}
+	rows := int(h.b)
+	columns := h.columnProbabilities(rows)
+	var max float64
+	for _, p := range columns {
+		max = math.Max(max, p)
+	}
+	step := (h.Max() - h.Min()) / float64(rows)
+	for i, p := range columns {
+		bar := 0
+		if max > 0.0 {
+			bar = int(p/max*renderBarWidth + 0.5)
+		}
+		label := h.Min() + float64(i)*step
+		if _, err := fmt.Fprintf(w, "%12.4g | %-*s %5.1f%%\n", label, renderBarWidth, strings.Repeat("█", bar), 100*p); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "%12.4g |\n", h.Max())
+	return err
+}
+
+// columnProbabilities returns the probability of the histogram in each of k equal width intervals from Min to Max
+// if Min equals Max all of the probability is in the last interval
+func (h *P2Histogram) columnProbabilities(k int) []float64 {
+	columns := make([]float64, k, k)
+	min, max := h.Min(), h.Max()
+	if min == max {
+		columns[k-1] = 1.0
+		return columns
+	}
+	step := (max - min) / float64(k)
+	prev := 0.0
+	for i := range columns {
+		cdf := 1.0
+		if i < k-1 {
+			cdf = h.CDF(min + float64(i+1)*step)
+		}
+		columns[i] = cdf - prev
+		prev = cdf
+	}
+	return columns
+}
+
 // Min returns the minimum of observations seen so far
 func (h *P2Histogram) Min() float64 {
 
@@ -145,8 +517,11 @@ func (h *P2Histogram) Quantile(p float64) float64 {
 		return h.Max()
 	}
 	CDF := h.Histogram()
-	var i uint64 // find which bin the given percentage is in
-	for i = 0; i < h.b; i++ {
+	if len(CDF) == 0 || p < CDF[0].P {
+		return h.Min() // below the first marker only the minimum is known
+	}
+	var i int // find which bin the given percentage is in
+	for i = 0; i < len(CDF)-1; i++ {
 		if CDF[i].P <= p && p < CDF[i+1].P {
 			break
 		}
@@ -155,6 +530,14 @@ func (h *P2Histogram) Quantile(p float64) float64 {
 	return CDF[i].X + (CDF[i+1].X-CDF[i].X)*(p-CDF[i].P)/(CDF[i+1].P-CDF[i].P)
 }
 
+// Sample draws a random value from the distribution estimated by the histogram
+// by inverting the linear approximation to the CDF at a uniform random percentage
+// the tails of the sampled distribution are only as accurate as the resolution of the markers
+// if r is nil the package level source of math/rand is used
+func (h *P2Histogram) Sample(r *rand.Rand) float64 {
+	return h.Quantile(randFloat64(r))
+}
+
 // CDF returns the linear approximation to the CDF at x based on the histogram data
 func (h *P2Histogram) CDF(x float64) float64 {
 
@@ -174,3 +557,81 @@ func (h *P2Histogram) CDF(x float64) float64 {
 	// linear interpolation
 	return CDF[i].P + (CDF[i+1].P-CDF[i].P)*(x-CDF[i].X)/(CDF[i+1].X-CDF[i].X)
 }
+
+// IsAnomaly returns true if x is below the lowP quantile or above the highP quantile of the histogram
+// e.g. IsAnomaly(x, 0.01, 0.99) for a simple streaming outlier detector
+func (h *P2Histogram) IsAnomaly(x float64, lowP, highP float64) bool {
+	return x < h.Quantile(lowP) || x > h.Quantile(highP)
+}
+
+// AnomalyScore returns how far x is into either tail of the histogram as |2*CDF(x) - 1|
+// from 0 at the median to 1 at or beyond the minimum or maximum
+func (h *P2Histogram) AnomalyScore(x float64) float64 {
+	return math.Abs(2.0*h.CDF(x) - 1.0)
+}
+
+// KLDivergence returns the Kullback-Leibler divergence of the histogram from the baseline histogram
+// both histograms are discretized onto the union of their markers as common bin edges and the
+// divergence sum(p * log(p/q)) is computed over the bins, where p is the probability of each bin in the
+// histogram and q is the probability in the baseline.  A small probability is added to every bin
+// before normalizing to avoid infinite divergence from bins that are empty in the baseline
+func (h *P2Histogram) KLDivergence(baseline *P2Histogram) float64 {
+	edges := unionMarkers(h, baseline)
+	if len(edges) == 0 {
+		return 0.0
+	}
+	p := binProbabilities(h, edges)
+	q := binProbabilities(baseline, edges)
+	norm := 1.0 + float64(len(p))*klSmoothing
+	var kl float64
+	for i := range p {
+		pi := (p[i] + klSmoothing) / norm
+		qi := (q[i] + klSmoothing) / norm
+		kl += pi * math.Log(pi/qi)
+	}
+	return kl
+}
+
+// KSStatistic returns the two-sample Kolmogorov-Smirnov statistic, the maximum absolute difference
+// between the estimated CDFs of the two histograms evaluated at the union of their markers
+func (h *P2Histogram) KSStatistic(other *P2Histogram) float64 {
+	var ks float64
+	for _, x := range unionMarkers(h, other) {
+		if d := math.Abs(h.CDF(x) - other.CDF(x)); d > ks {
+			ks = d
+		}
+	}
+	return ks
+}
+
+// unionMarkers returns the sorted unique marker values of the two histograms
+func unionMarkers(a, b *P2Histogram) []float64 {
+	var edges []float64
+	for _, cd := range a.Histogram() {
+		edges = append(edges, cd.X)
+	}
+	for _, cd := range b.Histogram() {
+		edges = append(edges, cd.X)
+	}
+	sort.Float64s(edges)
+	unique := edges[:0]
+	for i, x := range edges {
+		if i == 0 || x != unique[len(unique)-1] {
+			unique = append(unique, x)
+		}
+	}
+	return unique
+}
+
+// binProbabilities returns the probability of the histogram in each bin defined by the sorted edges
+// the first bin holds the probability at or below the first edge
+func binProbabilities(h *P2Histogram, edges []float64) []float64 {
+	p := make([]float64, len(edges), len(edges))
+	prev := 0.0
+	for i, x := range edges {
+		cdf := h.CDF(x)
+		p[i] = cdf - prev
+		prev = cdf
+	}
+	return p
+}
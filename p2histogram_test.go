@@ -1,9 +1,14 @@
 package streamstats
 
 import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
 	"math"
 	"math/rand"
 	"reflect"
+	"sort"
+	"strings"
 	"testing"
 )
 
@@ -106,6 +111,47 @@ func TestP2HistorgramSmallN(t *testing.T) {
 	}
 }
 
+func TestP2HistogramTinyBins(t *testing.T) {
+	if h := NewP2Histogram(0); h.b != 1 {
+		t.Errorf("Expected b bounded below by 1, got %d", h.b)
+	}
+	if h := NewP2HistogramFromSample(0, exponentialTestData[:100]); h.b != 1 || h.N() != 100 {
+		t.Errorf("Expected a sample histogram with b bounded below by 1, got %s", &h)
+	}
+	for _, b := range []uint64{0, 1, 2} {
+		h := NewP2Histogram(b)
+		min, max := math.Inf(1), math.Inf(-1)
+		for i := 0; i < 1000; i++ {
+			x := exponentialTestData[i]
+			h.Add(x)
+			min, max = math.Min(min, x), math.Max(max, x)
+			if h.Min() != min || h.Max() != max {
+				t.Fatalf("b=%d: Expected Min %v Max %v after %d, got %v %v", b, min, max, i+1, h.Min(), h.Max())
+			}
+			if q := h.Quantile(0.5); q < min || q > max {
+				t.Fatalf("b=%d: Expected median within [%v, %v] after %d, got %v", b, min, max, i+1, q)
+			}
+			if c := h.CDF(exponentialTestData[0]); c < 0.0 || c > 1.0 {
+				t.Fatalf("b=%d: Expected CDF within [0, 1] after %d, got %v", b, i+1, c)
+			}
+		}
+		if h.Quantile(0.0) != min || h.Quantile(1.0) != max || h.CDF(max) != 1.0 || h.CDF(min-1.0) != 0.0 {
+			t.Errorf("b=%d: Expected the quantiles and CDF to be bounded by the min and max, got %s", b, &h)
+		}
+		if len(h.Histogram()) != int(h.b)+1 {
+			t.Errorf("b=%d: Expected %d markers, got %d", b, h.b+1, len(h.Histogram()))
+		}
+	}
+	// with two bins the internal marker tracks the median
+	h := NewP2Histogram(2)
+	for i := 0; i < N; i++ {
+		h.Add(exponentialTestData[i])
+	}
+	if median := math.Ln2; math.Abs(h.Quantile(0.5)-median) > 0.05 {
+		t.Errorf("Expected median %v, got %v", median, h.Quantile(0.5))
+	}
+}
+
 func TestP2DataPointsHistogram(t *testing.T) {
 	q := NewP2Quantile(0.5)
 	hist := NewP2Histogram(4)
@@ -126,16 +172,16 @@ func TestP2DataPointsHistogram(t *testing.T) {
 			t.Errorf("Expected the number of points to be %d got %d", i+1, hist.N())
 		}
 		if hist.Min() != q.Min() {
-			t.Errorf("Expected Min to be %d got %d", q.Min(), hist.Min())
+			t.Errorf("Expected Min to be %v got %v", q.Min(), hist.Min())
 		}
 		if hist.Max() != q.Max() {
-			t.Errorf("Expected Max to be %d got %d", q.Max(), hist.Max())
+			t.Errorf("Expected Max to be %v got %v", q.Max(), hist.Max())
 		}
 	}
 }
 
 func TestP2HistogramExponentialDist(t *testing.T) {
-	rand.Seed(42) // for deterministic testing
+	testRand.Seed(42) // for deterministic testing
 	N := 100000
 	Nbins := uint64(20)
 	eps := 0.03 // expect errors less than 3% for all quantiles
@@ -186,6 +232,605 @@ func TestP2HistogramExponentialDist(t *testing.T) {
 	}
 }
 
+func TestNewP2HistogramFromSample(t *testing.T) {
+	Nbins := uint64(10)
+	sample := exponentialTestData[:1000]
+	h := NewP2HistogramFromSample(Nbins, sample)
+	sorted := make([]float64, len(sample))
+	copy(sorted, sample)
+	sort.Float64s(sorted)
+	if h.N() != uint64(len(sample)) {
+		t.Errorf("Expected N %d, got %d", len(sample), h.N())
+	}
+	if h.Min() != sorted[0] {
+		t.Errorf("Expected Min %v, got %v", sorted[0], h.Min())
+	}
+	if h.Max() != sorted[len(sorted)-1] {
+		t.Errorf("Expected Max %v, got %v", sorted[len(sorted)-1], h.Max())
+	}
+	for i := uint64(1); i <= Nbins; i++ {
+		if h.n[i] <= h.n[i-1] {
+			t.Errorf("Expected increasing marker positions, got %v", h.n)
+		}
+		// the markers are the empirical quantiles
+		if h.q[i] != sorted[h.n[i]-1] {
+			t.Errorf("Expected q[%d]=%v, got %v", i, sorted[h.n[i]-1], h.q[i])
+		}
+		np := 1.0 + float64(i)*(float64(h.N())-1.0)/float64(Nbins)
+		if math.Abs(np-float64(h.n[i])) > 0.5 {
+			t.Errorf("Expected n[%d] within 0.5 of the target %v, got %v", i, np, h.n[i])
+		}
+	}
+	// subsequent updates continue from the warm start
+	for i := len(sample); i < N; i++ {
+		h.Add(exponentialTestData[i])
+	}
+	eps := 0.03
+	for _, p := range []float64{0.1, 0.25, 0.5, 0.75, 0.9} {
+		if math.Abs((exponentialQuantile(p, 1.0)-h.Quantile(p))/exponentialQuantile(p, 1.0)) > eps {
+			t.Errorf("For p: %v Expected Quantile %v, got %v", p, exponentialQuantile(p, 1.0), h.Quantile(p))
+		}
+	}
+
+	// a sample smaller than the number of markers is stored exactly
+	h = NewP2HistogramFromSample(Nbins, histogramSmallNTestData)
+	expected := NewP2Histogram(Nbins)
+	for _, x := range histogramSmallNTestData {
+		expected.Add(x)
+	}
+	if !reflect.DeepEqual(h, expected) {
+		t.Errorf("Expected small sample %v, got %v", expected, h)
+	}
+}
+
+func TestP2HistogramDownsample(t *testing.T) {
+	h := NewP2Histogram(128)
+	for i := 0; i < N; i++ {
+		h.Add(exponentialTestData[i])
+	}
+	d := h.Downsample(8)
+	if d.b != 8 || d.N() != h.N() {
+		t.Errorf("Expected 8 bins with N %d, got %d bins with N %d", h.N(), d.b, d.N())
+	}
+	if d.Min() != h.Min() || d.Max() != h.Max() {
+		t.Errorf("Expected Min %v and Max %v, got %v and %v", h.Min(), h.Max(), d.Min(), d.Max())
+	}
+	// the quantiles at the new markers are preserved and interpolated between them
+	for i, cd := range d.Histogram() {
+		if math.Abs(cd.X-h.Quantile(cd.P)) > 1e-9 {
+			t.Errorf("Expected marker %d at %v, got %v", i, h.Quantile(cd.P), cd.X)
+		}
+	}
+	// away from the tail bin, which is linear up to the maximum, the coarse bins are close to the original
+	for _, p := range []float64{0.1, 0.3, 0.5, 0.7} {
+		expected := h.Quantile(p)
+		if math.Abs(d.Quantile(p)-expected) > 0.05*expected {
+			t.Errorf("Expected downsampled Quantile(%v) near %v, got %v", p, expected, d.Quantile(p))
+		}
+	}
+	if h.Downsample(256).b != h.b || h.Downsample(0).b != 1 {
+		t.Errorf("Expected the new number of bins to be bounded by 1 and %d", h.b)
+	}
+	// while the markers are the observations they are kept exactly
+	small := NewP2Histogram(8)
+	for i := 0; i < 4; i++ {
+		small.Add(gaussianTestData[i])
+	}
+	ds := small.Downsample(4)
+	if !ds.IsExact() || ds.N() != 4 {
+		t.Errorf("Expected an exact downsampled histogram of 4 observations, got N %d", ds.N())
+	}
+	for i := uint64(0); i < 4; i++ {
+		if ds.q[i] != small.q[i] {
+			t.Errorf("Expected observation %v, got %v", small.q[i], ds.q[i])
+		}
+	}
+}
+
+func TestP2HistogramString(t *testing.T) {
+	h := NewP2Histogram(4)
+	for _, x := range []float64{3.0, 1.0, 5.0, 2.0, 4.0} {
+		h.Add(x)
+	}
+	expected := "P2Histogram N: 5 Bins: 4 1.000:0.200 2.000:0.400 3.000:0.600 4.000:0.800 5.000:1.000"
+	if h.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, h.String())
+	}
+	// the same observations always produce identical output
+	a, b := NewP2Histogram(16), NewP2Histogram(16)
+	for i := 0; i < N; i++ {
+		a.Add(exponentialTestData[i])
+		b.Add(exponentialTestData[i])
+	}
+	if a.String() != b.String() {
+		t.Errorf("Expected identical strings for the same observations, got %q and %q", a.String(), b.String())
+	}
+	var bufA, bufB strings.Builder
+	a.RenderHistogram(&bufA)
+	b.RenderHistogram(&bufB)
+	if bufA.String() != bufB.String() {
+		t.Errorf("Expected identical rendered histograms for the same observations")
+	}
+}
+
+func TestP2HistogramAnomaly(t *testing.T) {
+	h := NewP2Histogram(32)
+	for i := 0; i < N; i++ {
+		h.Add(gaussianTestData[i])
+	}
+	for _, tc := range []struct {
+		x       float64
+		anomaly bool
+	}{
+		{0.0, false},
+		{1.5, false},
+		{-1.5, false},
+		{2.0, true},
+		{-2.0, true},
+		{100.0, true},
+	} {
+		// the 5% and 95% quantiles of a gaussian are +/- 1.645
+		if h.IsAnomaly(tc.x, 0.05, 0.95) != tc.anomaly {
+			t.Errorf("Expected IsAnomaly(%v) %v, got %v", tc.x, tc.anomaly, !tc.anomaly)
+		}
+	}
+	if score := h.AnomalyScore(h.Quantile(0.5)); math.Abs(score) > 1e-9 {
+		t.Errorf("Expected an AnomalyScore of 0 at the median, got %v", score)
+	}
+	if h.AnomalyScore(-100.0) != 1.0 || h.AnomalyScore(100.0) != 1.0 {
+		t.Errorf("Expected an AnomalyScore of 1 beyond the extremes, got %v and %v", h.AnomalyScore(-100.0), h.AnomalyScore(100.0))
+	}
+	// about 95% of a gaussian is within 2 standard deviations
+	if score := h.AnomalyScore(2.0); math.Abs(score-0.954) > 0.02 {
+		t.Errorf("Expected an AnomalyScore near 0.954 at 2 standard deviations, got %v", score)
+	}
+	if h.AnomalyScore(1.0) >= h.AnomalyScore(2.0) {
+		t.Errorf("Expected the AnomalyScore to increase into the tail")
+	}
+}
+
+func TestP2HistogramMarshalBinary(t *testing.T) {
+	for _, n := range []int{0, 3, N} {
+		h := NewP2Histogram(16)
+		for i := 0; i < n; i++ {
+			h.Add(exponentialTestData[i])
+		}
+		data, err := h.MarshalBinary()
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		var decoded P2Histogram
+		if err = decoded.UnmarshalBinary(data); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if !reflect.DeepEqual(decoded, h) {
+			t.Errorf("Expected the round trip of %d observations to reproduce the histogram", n)
+		}
+		if n == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(decoded.Histogram(), h.Histogram()) {
+			t.Errorf("Expected identical Histogram after the round trip")
+		}
+		for _, p := range []float64{0.1, 0.5, 0.9} {
+			if decoded.Quantile(p) != h.Quantile(p) {
+				t.Errorf("Expected Quantile(%v) %v after the round trip, got %v", p, h.Quantile(p), decoded.Quantile(p))
+			}
+			if x := h.Quantile(p); decoded.CDF(x) != h.CDF(x) {
+				t.Errorf("Expected CDF(%v) %v after the round trip, got %v", x, h.CDF(x), decoded.CDF(x))
+			}
+		}
+	}
+}
+
+func TestP2HistogramUnmarshalBinaryInvalid(t *testing.T) {
+	h := NewP2Histogram(4)
+	for i := 0; i < 100; i++ {
+		h.Add(gaussianTestData[i])
+	}
+	valid, _ := h.MarshalBinary()
+	corrupt := func(f func(data []byte) []byte) []byte {
+		data := make([]byte, len(valid))
+		copy(data, valid)
+		return f(data)
+	}
+	var testCases = []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"version", corrupt(func(data []byte) []byte { data[0] = 2; return data })},
+		{"truncated", valid[:len(valid)-1]},
+		{"extra", append(corrupt(func(data []byte) []byte { return data }), 0)},
+		{"bins", corrupt(func(data []byte) []byte { data[8] = 5; return data })},
+		{"zero bins", corrupt(func(data []byte) []byte { data[8] = 0; return data })},
+		{"decreasing", corrupt(func(data []byte) []byte {
+			binary.BigEndian.PutUint64(data[17+5*8:], math.Float64bits(100.0)) // the minimum above the other markers
+			return data
+		})},
+		{"NaN", corrupt(func(data []byte) []byte {
+			binary.BigEndian.PutUint64(data[17+5*8+8:], math.Float64bits(math.NaN()))
+			return data
+		})},
+		{"minimum count", corrupt(func(data []byte) []byte {
+			binary.BigEndian.PutUint64(data[17:], 2)
+			return data
+		})},
+		{"decreasing counts", corrupt(func(data []byte) []byte {
+			binary.BigEndian.PutUint64(data[17+2*8:], 1000) // the median count above the total
+			return data
+		})},
+	}
+	for _, test := range testCases {
+		decoded := NewP2Histogram(8)
+		if err := decoded.UnmarshalBinary(test.data); err == nil {
+			t.Errorf("Expected an error decoding %s data", test.name)
+		}
+		if decoded.b != 8 {
+			t.Errorf("Expected a failed decoding of %s data not to modify the histogram", test.name)
+		}
+	}
+}
+
+func TestP2HistogramValidate(t *testing.T) {
+	for _, b := range []uint64{1, 2, 8} {
+		h := NewP2Histogram(b)
+		for i := 0; i < 100; i++ {
+			if err := h.Validate(); err != nil {
+				t.Fatalf("Unexpected error %v for %d bins after %d observations", err, b, i)
+			}
+			h.Add(gaussianTestData[i])
+		}
+		sampled := NewP2HistogramFromSample(b, gaussianTestData[:100])
+		if err := sampled.Validate(); err != nil {
+			t.Errorf("Unexpected error %v for %d bins from a sample", err, b)
+		}
+	}
+	initializing := NewP2Histogram(4)
+	initializing.Add(1.0)
+	initializing.n[1] = 3 // an initial position moved before the markers are estimates
+	if err := initializing.Validate(); err == nil {
+		t.Errorf("Expected an error for an inconsistent initial count")
+	}
+	h := NewP2Histogram(4)
+	for i := 0; i < 100; i++ {
+		h.Add(gaussianTestData[i])
+	}
+	h.q[2], h.q[3] = h.q[3], h.q[2]
+	if err := h.Validate(); err == nil {
+		t.Errorf("Expected an error for swapped markers")
+	}
+}
+
+func TestP2HistogramAdjustmentCount(t *testing.T) {
+	stationary := NewP2Histogram(8)
+	shifted := NewP2Histogram(8)
+	for i := 0; i < 9; i++ {
+		stationary.Add(gaussianTestData[i])
+	}
+	if stationary.AdjustmentCount() != 0 {
+		t.Errorf("Expected no adjustments during initialization, got %d", stationary.AdjustmentCount())
+	}
+	stationary = NewP2Histogram(8)
+	half := N / 2
+	for i := 0; i < half; i++ {
+		stationary.Add(gaussianTestData[i])
+		shifted.Add(gaussianTestData[i])
+	}
+	first := stationary.AdjustmentCount()
+	if first == 0 || first != shifted.AdjustmentCount() {
+		t.Errorf("Expected equal non-zero adjustments for the same data, got %d and %d", first, shifted.AdjustmentCount())
+	}
+	for i := half; i < N; i++ {
+		stationary.Add(gaussianTestData[i])
+		shifted.Add(gaussianTestData[i] + 10.0)
+	}
+	// the shifted distribution requires the markers to move continuously
+	stationaryRate := stationary.AdjustmentCount() - first
+	shiftedRate := shifted.AdjustmentCount() - first
+	if shiftedRate < 2*stationaryRate {
+		t.Errorf("Expected a non-stationary stream to have at least twice the adjustments %d, got %d", stationaryRate, shiftedRate)
+	}
+}
+
+func TestP2HistogramTies(t *testing.T) {
+	b := uint64(8)
+	constant := NewP2Histogram(b)
+	for i := 0; i < N; i++ {
+		constant.Add(3.0)
+	}
+	for _, cd := range constant.Histogram() {
+		if cd.X != 3.0 {
+			t.Errorf("Expected a constant stream to have all markers at 3.0, got %v", cd.X)
+		}
+	}
+	// values 0, 1, 2 with probabilities 0.25, 0.5, 0.25
+	ties := NewP2Histogram(b)
+	testRand.Seed(42)
+	for i := 0; i < N; i++ {
+		ties.Add([]float64{0.0, 1.0, 1.0, 2.0}[testRand.Intn(4)])
+	}
+	for _, h := range []P2Histogram{constant, ties} {
+		for i := uint64(1); i <= b; i++ {
+			if math.IsNaN(h.q[i]) || h.q[i] < h.q[i-1] {
+				t.Errorf("Expected ordered markers, got %v", h.q)
+			}
+			// values equal to the maximum are counted in the last bin so the markers stay near their targets
+			target := 1.0 + float64(i)*float64(h.N()-1)/float64(b)
+			if math.Abs(float64(h.n[i])-target) > 1.0 {
+				t.Errorf("Expected marker %d near position %v, got %v", i, target, h.n[i])
+			}
+		}
+	}
+	if q := ties.Quantile(0.5); q < 0.5 || q > 1.5 {
+		t.Errorf("Expected the median of heavy ties near 1.0, got %v", q)
+	}
+}
+
+func TestP2HistogramIsExact(t *testing.T) {
+	b := uint64(8)
+	h := NewP2Histogram(b)
+	for i := uint64(0); i < b+1; i++ {
+		h.Add(gaussianTestData[i])
+		if !h.IsExact() {
+			t.Errorf("Expected IsExact while the markers hold the observations at N=%d", h.N())
+		}
+	}
+	h.Add(gaussianTestData[b+1])
+	if h.IsExact() {
+		t.Errorf("Expected the histogram not to be exact at N=%d", h.N())
+	}
+}
+
+func TestP2HistogramDensity(t *testing.T) {
+	h := NewP2Histogram(8)
+	edges, density := h.Density()
+	if len(edges) != 0 || len(density) != 0 {
+		t.Errorf("Expected no edges or density for an empty histogram, got %v %v", edges, density)
+	}
+	// duplicate values give zero width bins
+	for i := 0; i < 5; i++ {
+		h.Add(1.0)
+	}
+	h.Add(2.0)
+	edges, density = h.Density()
+	if len(edges) != 6 || len(density) != 5 {
+		t.Fatalf("Expected 6 edges and 5 densities, got %d and %d", len(edges), len(density))
+	}
+	for i := 0; i < 4; i++ {
+		if density[i] != 0.0 {
+			t.Errorf("Expected zero density for a zero width bin, got %f", density[i])
+		}
+	}
+	if math.Abs(density[4]-1.0/6.0) > 1e-12 {
+		t.Errorf("Expected density 1/6 in the last bin, got %f", density[4])
+	}
+	// the density of a uniform distribution is flat
+	h = NewP2Histogram(8)
+	for i := 0; i < N; i++ {
+		h.Add(uniformTestData[i])
+	}
+	edges, density = h.Density()
+	var total float64
+	for i, d := range density {
+		total += d * (edges[i+1] - edges[i])
+		if math.Abs(d-1.0) > 0.1 {
+			t.Errorf("Expected uniform density 1.0 in bin %d, got %f", i, d)
+		}
+	}
+	if math.Abs(total-1.0) > 1.0/float64(N) {
+		t.Errorf("Expected the density to integrate to 1.0, got %f", total)
+	}
+}
+
+func TestP2HistogramSparkline(t *testing.T) {
+	h := NewP2Histogram(8)
+	if h.Sparkline(10) != "" {
+		t.Errorf("Expected an empty sparkline for an empty histogram, got %q", h.Sparkline(10))
+	}
+	h.Add(1.0)
+	if h.Sparkline(3) != "  █" {
+		t.Errorf("Expected a single value in the last column, got %q", h.Sparkline(3))
+	}
+	for i := 0; i < N; i++ {
+		h.Add(uniformTestData[i])
+	}
+	if h.Sparkline(0) != "" {
+		t.Errorf("Expected an empty sparkline for zero width, got %q", h.Sparkline(0))
+	}
+	// the uniform distribution is nearly flat at the highest blocks
+	line := []rune(h.Sparkline(20))
+	if len(line) != 20 {
+		t.Errorf("Expected 20 columns, got %d", len(line))
+	}
+	for i, r := range line {
+		if r != '▇' && r != '█' {
+			t.Errorf("Expected a full block for the uniform distribution in column %d, got %q", i, r)
+		}
+	}
+}
+
+func TestP2HistogramRenderHistogram(t *testing.T) {
+	h := NewP2Histogram(4)
+	var buf bytes.Buffer
+	if err := h.RenderHistogram(&buf); err != nil {
+		t.Errorf("RenderHistogram failed: %s", err)
+	}
+	if buf.String() != "empty histogram\n" {
+		t.Errorf("Expected an empty histogram, got %q", buf.String())
+	}
+	for i := 0; i < N; i++ {
+		h.Add(uniformTestData[i])
+	}
+	buf.Reset()
+	if err := h.RenderHistogram(&buf); err != nil {
+		t.Errorf("RenderHistogram failed: %s", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("Expected a row for each of 4 bins and the Max, got %d\n%s", len(lines), buf.String())
+	}
+	if !strings.HasPrefix(strings.TrimSpace(lines[0]), fmt.Sprintf("%.4g |", h.Min())) {
+		t.Errorf("Expected the first row to be labeled with the Min %.4g, got %q", h.Min(), lines[0])
+	}
+	if strings.TrimSpace(lines[4]) != fmt.Sprintf("%.4g |", h.Max()) {
+		t.Errorf("Expected the last row to be labeled with the Max %.4g, got %q", h.Max(), lines[4])
+	}
+	for _, line := range lines[:4] {
+		fields := strings.Fields(line)
+		var percent float64
+		fmt.Sscanf(fields[len(fields)-1], "%f%%", &percent)
+		if math.Abs(percent-25.0) > 1.0 {
+			t.Errorf("Expected a quarter of the uniform distribution in each row, got %q", line)
+		}
+	}
+}
+
+func TestP2HistogramEstimatedError(t *testing.T) {
+	h := NewP2Histogram(20)
+	if h.EstimatedError() != 1.0 {
+		t.Errorf("Expected EstimatedError of an empty histogram to be 1, got %v", h.EstimatedError())
+	}
+	h.Add(gaussianTestData[0])
+	if h.EstimatedError() != 1.0 {
+		t.Errorf("Expected EstimatedError of a single point to be 1, got %v", h.EstimatedError())
+	}
+	coarse := NewP2Histogram(4)
+	coarse.Add(gaussianTestData[0])
+	last := h.EstimatedError()
+	for i := 1; i < N; i++ {
+		h.Add(gaussianTestData[i])
+		coarse.Add(gaussianTestData[i])
+		if i&(i+1) == 0 { // check at powers of two
+			e := h.EstimatedError()
+			if e > last {
+				t.Errorf("Expected EstimatedError to decrease with N, got %v > %v at N=%d", e, last, h.N())
+			}
+			last = e
+		}
+	}
+	// the error should be larger for fewer bins
+	if coarse.EstimatedError() <= h.EstimatedError() {
+		t.Errorf("Expected EstimatedError of 4 bins %v to exceed 20 bins %v", coarse.EstimatedError(), h.EstimatedError())
+	}
+	// the heuristic should bound the actual error of the CDF for a known distribution
+	e := h.EstimatedError()
+	for _, cd := range h.Histogram() {
+		actual := math.Abs(cd.P - 0.5*math.Erfc(-cd.X/math.Sqrt2))
+		if actual > e {
+			t.Errorf("Expected CDF error at %v to be less than %v, got %v", cd.X, e, actual)
+		}
+	}
+}
+
+func TestP2HistogramSample(t *testing.T) {
+	Nbins := uint64(20)
+	h := NewP2Histogram(Nbins)
+	for i := 0; i < N; i++ {
+		h.Add(uniformTestData[i])
+	}
+	r := rand.New(rand.NewSource(42))
+	m := NewMomentStats()
+	samples := 10000
+	for i := 0; i < samples; i++ {
+		x := h.Sample(r)
+		if x < h.Min() || x > h.Max() {
+			t.Errorf("Expected sample between Min %v and Max %v, got %v", h.Min(), h.Max(), x)
+		}
+		m.Add(x)
+	}
+	// the samples should follow the uniform distribution on [0, 1)
+	eps := 3.0 * math.Sqrt(1.0/12.0) / math.Sqrt(float64(samples))
+	if math.Abs(m.Mean()-0.5) > eps {
+		t.Errorf("Expected sample Mean == %v, got %v", 0.5, m.Mean())
+	}
+	if math.Abs(m.Variance()-1.0/12.0) > 0.01 {
+		t.Errorf("Expected sample Variance == %v, got %v", 1.0/12.0, m.Variance())
+	}
+
+	// percentages below the first marker return the minimum
+	if h.Quantile(0.1/float64(h.N())) != h.Min() {
+		t.Errorf("Expected Quantile below the first marker to return Min %v, got %v", h.Min(), h.Quantile(0.1/float64(h.N())))
+	}
+	// the same seed gives the same samples and a nil source uses the package level source
+	r1 := rand.New(rand.NewSource(7))
+	r2 := rand.New(rand.NewSource(7))
+	for i := 0; i < 10; i++ {
+		if x1, x2 := h.Sample(r1), h.Sample(r2); x1 != x2 {
+			t.Errorf("Expected identical samples from identical sources, got %v and %v", x1, x2)
+		}
+		if x := h.Sample(nil); x < h.Min() || x > h.Max() {
+			t.Errorf("Expected sample between Min %v and Max %v, got %v", h.Min(), h.Max(), x)
+		}
+	}
+	// sampling a histogram with fewer points than bins returns the observed values
+	h = NewP2Histogram(Nbins)
+	h.Add(1.0)
+	for i := 0; i < 10; i++ {
+		if x := h.Sample(r); x != 1.0 {
+			t.Errorf("Expected sample of a single point to be %v, got %v", 1.0, x)
+		}
+	}
+}
+
+func TestP2HistogramKLDivergence(t *testing.T) {
+	Nbins := uint64(20)
+	baseline := NewP2Histogram(Nbins)
+	same := NewP2Histogram(Nbins)
+	shifted := NewP2Histogram(Nbins)
+	for i := 0; i < N/2; i++ {
+		baseline.Add(gaussianTestData[i])
+		same.Add(gaussianTestData[i+N/2])
+		shifted.Add(gaussianTestData[i+N/2] + 1.0)
+	}
+	if kl := baseline.KLDivergence(&baseline); kl != 0.0 {
+		t.Errorf("Expected KLDivergence of a histogram from itself to be 0, got %v", kl)
+	}
+	klSame := same.KLDivergence(&baseline)
+	if klSame < 0.0 || klSame > 0.05 {
+		t.Errorf("Expected KLDivergence of the same distribution to be ~0, got %v", klSame)
+	}
+	// the KL divergence of two unit normal distributions shifted by 1 is 0.5
+	klShifted := shifted.KLDivergence(&baseline)
+	if klShifted < 0.25 {
+		t.Errorf("Expected KLDivergence of a shifted distribution to be ~0.5, got %v", klShifted)
+	}
+	if math.IsInf(klShifted, 0) || math.IsNaN(klShifted) {
+		t.Errorf("Expected finite KLDivergence, got %v", klShifted)
+	}
+	empty := NewP2Histogram(Nbins)
+	if kl := empty.KLDivergence(&empty); kl != 0.0 {
+		t.Errorf("Expected KLDivergence of empty histograms to be 0, got %v", kl)
+	}
+}
+
+func TestP2HistogramKSStatistic(t *testing.T) {
+	Nbins := uint64(20)
+	baseline := NewP2Histogram(Nbins)
+	same := NewP2Histogram(Nbins)
+	shifted := NewP2Histogram(Nbins)
+	for i := 0; i < N/2; i++ {
+		baseline.Add(gaussianTestData[i])
+		same.Add(gaussianTestData[i+N/2])
+		shifted.Add(gaussianTestData[i+N/2] + 1.0)
+	}
+	if ks := baseline.KSStatistic(&baseline); ks != 0.0 {
+		t.Errorf("Expected KSStatistic of a histogram with itself to be 0, got %v", ks)
+	}
+	ksSame := same.KSStatistic(&baseline)
+	if ksSame > 0.05 {
+		t.Errorf("Expected KSStatistic of the same distribution to be ~0, got %v", ksSame)
+	}
+	if ksSame != baseline.KSStatistic(&same) {
+		t.Errorf("Expected KSStatistic to be symmetric, got %v and %v", ksSame, baseline.KSStatistic(&same))
+	}
+	// the maximum difference of two unit normal CDFs shifted by 1 is 2*Phi(0.5)-1 = 0.383
+	ksShifted := shifted.KSStatistic(&baseline)
+	if math.Abs(ksShifted-0.383) > 0.05 {
+		t.Errorf("Expected KSStatistic of a shifted distribution to be ~0.383, got %v", ksShifted)
+	}
+}
+
 func BenchmarkP2Histogram8Add(b *testing.B) {
 	q := NewP2Histogram(8)
 	for i := 0; i < b.N; i++ {
@@ -225,3 +870,79 @@ func BenchmarkP2Histogram128Add(b *testing.B) {
 	}
 	result = q.Max() // to avoid optimizing out the loop entirely
 }
+
+func TestP2HistogramAddN(t *testing.T) {
+	// AddN of a single observation is Add
+	single, looped := NewP2Histogram(10), NewP2Histogram(10)
+	for i := 0; i < 1000; i++ {
+		single.AddN(gaussianTestData[i], 1)
+		looped.Add(gaussianTestData[i])
+	}
+	if !reflect.DeepEqual(single, looped) {
+		t.Errorf("Expected AddN(x, 1) to equal Add(x)")
+	}
+	single.AddN(1.0, 0)
+	if single.N() != 1000 {
+		t.Errorf("Expected AddN(x, 0) not to add an observation, got N %d", single.N())
+	}
+	// the first b+1 observations are still the exact markers
+	h := NewP2Histogram(4)
+	h.AddN(2.0, 3)
+	h.AddN(1.0, 1)
+	h.AddN(3.0, 2)
+	if h.N() != 6 || h.Min() != 1.0 || h.Max() != 3.0 || h.Quantile(0.5) != 2.0 || h.Validate() != nil {
+		t.Errorf("Expected the markers from the exact observations, got %v with counts %v", h.q, h.n)
+	}
+	// pre-aggregated bins of exponential data fed in a random order, which is adversarial for P2
+	counts := make(map[float64]uint64)
+	for _, x := range exponentialTestData {
+		counts[math.Round(x*100.0)/100.0]++
+	}
+	values := make([]float64, 0, len(counts))
+	for x := range counts {
+		values = append(values, x)
+	}
+	sort.Float64s(values)
+	testRand.Seed(42)
+	binned := NewP2Histogram(20)
+	for _, j := range testRand.Perm(len(values)) {
+		binned.AddN(values[j], counts[values[j]])
+	}
+	if binned.N() != uint64(len(exponentialTestData)) || binned.Validate() != nil {
+		t.Fatalf("Expected %d observations in a valid histogram, got %d", len(exponentialTestData), binned.N())
+	}
+	if binned.Min() != values[0] || binned.Max() != values[len(values)-1] {
+		t.Errorf("Expected the minimum %v and maximum %v, got %v and %v", values[0], values[len(values)-1], binned.Min(), binned.Max())
+	}
+	for _, p := range []float64{0.25, 0.5, 0.75, 0.9} {
+		if expected := exponentialQuantile(p, 1.0); math.Abs(binned.Quantile(p)-expected) > 0.1*expected {
+			t.Errorf("Expected the %v quantile near %v, got %v", p, expected, binned.Quantile(p))
+		}
+	}
+	// non-finite observations are counted count times
+	skipped := NewP2Histogram(4)
+	skipped.SetSkipNonFinite(true)
+	skipped.AddN(math.NaN(), 5)
+	if skipped.N() != 0 || skipped.SkippedCount() != 5 {
+		t.Errorf("Expected 5 skipped observations, got N %d skipped %d", skipped.N(), skipped.SkippedCount())
+	}
+}
+
+func BenchmarkP2HistogramAddN(b *testing.B) {
+	h := NewP2Histogram(20)
+	for i := 0; i < b.N; i++ {
+		h.AddN(exponentialTestData[i&mask], 1000)
+	}
+}
+
+func TestP2HistogramPush(t *testing.T) {
+	added := NewP2Histogram(16)
+	pushed := NewP2Histogram(16)
+	for i := 0; i < 1000; i++ {
+		added.Add(exponentialTestData[i])
+		pushed.Push(exponentialTestData[i])
+	}
+	if added.String() != pushed.String() {
+		t.Errorf("Expected Push to be an alias of Add, got %s and %s", pushed.String(), added.String())
+	}
+}
@@ -1,5 +1,11 @@
 package streamstats
 
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
 // P2Quantile is an O(1) time and space data structure
 // for estimating the p-quantile of a series of N data points based on the
 // "The P2 Algorithm for Dynamic Computing Calculation of Quantiles and
@@ -11,10 +17,22 @@ type P2Quantile struct {
 	np  [5]float64 // the target counts for each marker
 	dnp [5]float64 // the updates to the target counts for each additional measurement
 	q   [5]float64 // the value of each marker, i.e. the estimated quantile
+	abs bool       // track the quantile of |x| rather than x
+	// exact holds the sorted observations until exactUntil is exceeded and the markers are seeded
+	exact       []float64
+	exactUntil  int
+	adjustments uint64 // the number of times an internal marker height has been adjusted
+	nonFinite
 }
 
 // NewP2Quantile intializes the data structure to track the p-quantile
+// p must be in the closed interval [0, 1], e.g. 0.5 for the median rather than 50,
+// otherwise the marker targets are meaningless so NewP2Quantile panics rather than silently giving wrong results
+// p = 0 and p = 1 track the exact minimum and maximum
 func NewP2Quantile(p float64) P2Quantile {
+	if !(0 <= p && p <= 1) { // also rejects NaN
+		panic(fmt.Sprintf("streamstats: P2Quantile p = %v must be in [0, 1]", p))
+	}
 	return P2Quantile{
 		p:   p,
 		n:   [5]uint64{1, 2, 3, 4, 0},
@@ -23,8 +41,67 @@ func NewP2Quantile(p float64) P2Quantile {
 	}
 }
 
-// Add updates the data structure with a given x value
+// NewP2QuantileAbs intializes the data structure to track the p-quantile of the absolute value |x|
+// of the observations, e.g. for monitoring the magnitude of a signal
+func NewP2QuantileAbs(p float64) P2Quantile {
+	q := NewP2Quantile(p)
+	q.abs = true
+	return q
+}
+
+// NewP2QuantileExactUntil intializes the data structure to track the p-quantile exactly
+// by storing the first k observations, once more than k observations are seen the P2 markers
+// are seeded from the stored observations and the estimate becomes approximate
+// this improves the accuracy for short streams at the cost of O(k) space, use Clone rather than assignment to copy it
+func NewP2QuantileExactUntil(p float64, k int) P2Quantile {
+	q := NewP2Quantile(p)
+	if k > 5 { // the P2 algorithm is already exact for the first 5 observations
+		q.exact = make([]float64, 0, k)
+		q.exactUntil = k
+	}
+	return q
+}
+
+// Clone returns an independent copy of the P2Quantile
+// a P2Quantile from NewP2QuantileExactUntil shares its stored observations with a copy made by assignment
+// until the markers are seeded, so Clone must be used to copy one that is still exact
+func (p *P2Quantile) Clone() P2Quantile {
+	c := *p
+	if p.exact != nil {
+		c.exact = make([]float64, len(p.exact), p.exactUntil)
+		copy(c.exact, p.exact)
+	}
+	return c
+}
+
+// Add is an alias of Push matching the Add of the sketches and MomentStats
+// Push is the canonical name for P2Quantile and BoxPlot and should be used in new code
 func (p *P2Quantile) Add(x float64) {
+	p.Push(x)
+}
+
+// Push updates the data structure with a given x value
+// a NaN or infinite x is skipped and counted instead if SetSkipNonFinite is set
+func (p *P2Quantile) Push(x float64) {
+
+	if p.skip(x) {
+		return
+	}
+	if p.abs {
+		x = math.Abs(x)
+	}
+	if p.exact != nil {
+		if len(p.exact) < p.exactUntil {
+			// insert the new element in sorted order
+			i := sort.SearchFloat64s(p.exact, x)
+			p.exact = append(p.exact, 0)
+			copy(p.exact[i+1:], p.exact[i:])
+			p.exact[i] = x
+			p.n[4]++
+			return
+		}
+		p.seedMarkers()
+	}
 
 	if p.n[4] < 5 {
 		// Initialization:
@@ -75,27 +152,190 @@ func (p *P2Quantile) Add(x float64) {
 				} else {
 					d = -1.0
 				}
-				// try using the piecewise polynomial degree 2 formula
-				fNm := float64(p.n[i-1])
-				fN := float64(p.n[i])
-				fNp := float64(p.n[i+1])
-				qp := p.q[i] + d*((fN-fNm+d)*(p.q[i+1]-p.q[i])/(fNp-fN)+(fNp-fN-d)*(p.q[i]-p.q[i-1])/(fN-fNm))/(fNp-fNm)
-				if p.q[i-1] < qp && qp < p.q[i+1] {
-					p.q[i] = qp
-				} else { // use linear formula if degree 2 formula would result in out of order markers
-					ip := i + int(d)
-					p.q[i] += d * (p.q[ip] - p.q[i]) / (float64(p.n[ip]) - fN)
-				}
+				p.q[i] = adjustedHeight(p.q[:], p.n[:], i, d)
 				if d > 0 { // increment the counter for the bin after adjustments were made
 					p.n[i]++
 				} else {
 					p.n[i]--
 				}
+				p.adjustments++
 			}
 		}
 	}
 }
 
+// adjustedHeight returns the new height of internal marker i moved by d positions, +/-1 for a single observation
+// using the piecewise polynomial degree 2 formula, or the linear formula if that would result in out of order markers
+// a marker moving within a run of tied heights keeps its height, and a height that is undefined,
+// e.g. between infinite values, is left unchanged so that the markers never become NaN
+// d must not move the marker to or past the position of its neighbour
+func adjustedHeight(q []float64, n []uint64, i int, d float64) float64 {
+	ip := i + 1 // the neighbour in the direction of the move
+	if d < 0 {
+		ip = i - 1
+	}
+	if q[ip] == q[i] {
+		return q[i]
+	}
+	fNm := float64(n[i-1])
+	fN := float64(n[i])
+	fNp := float64(n[i+1])
+	qp := q[i] + d*((fN-fNm+d)*(q[i+1]-q[i])/(fNp-fN)+(fNp-fN-d)*(q[i]-q[i-1])/(fN-fNm))/(fNp-fNm)
+	if q[i-1] < qp && qp < q[i+1] {
+		return qp
+	}
+	ql := q[i] + d*(q[ip]-q[i])/(float64(n[ip])-fN)
+	if math.IsNaN(ql) {
+		return q[i]
+	}
+	return ql
+}
+
+// seedMarkers initializes the markers at the target positions in the exactly stored observations
+func (p *P2Quantile) seedMarkers() {
+	N := len(p.exact)
+	for i := 0; i < 5; i++ {
+		p.np[i] = 1 + float64(N-1)*p.dnp[i]
+	}
+	p.n[0] = 1
+	p.n[4] = uint64(N)
+	for i := 1; i < 4; i++ {
+		n := uint64(p.np[i] + 0.5) // round to the nearest position
+		if n <= p.n[i-1] {
+			n = p.n[i-1] + 1 // positions must be strictly increasing
+		} else if n > uint64(N-4+i) {
+			n = uint64(N - 4 + i) // leave room for the markers above
+		}
+		p.n[i] = n
+	}
+	for i := 0; i < 5; i++ {
+		p.q[i] = p.exact[p.n[i]-1]
+	}
+	p.exact = nil
+}
+
+// Combine merges two P2Quantile tracking the same p-quantile, e.g. from different shards of a stream
+// if either has not been initialized with 5 observations, or stores its observations exactly,
+// its observations are added to a copy of the other
+// otherwise the markers are placed at the target positions of the combined count using the rank function of
+// the merged markers, linearly interpolating the rank of each between its markers, so the result is
+// an approximation whose error compounds the errors of both estimators
+// the merge is most accurate for shards from similar distributions, for very different distributions
+// the linear interpolation between the sparse markers can be off by tens of percent
+func (p *P2Quantile) Combine(b *P2Quantile) (P2Quantile, error) {
+	if p.p != b.p {
+		return P2Quantile{}, fmt.Errorf("P2Quantile do not track the same quantile p1 = %f != %f = p2", p.p, b.p)
+	}
+	if p.abs != b.abs {
+		return P2Quantile{}, fmt.Errorf("P2Quantile do not both track the absolute value")
+	}
+	// prefer to add the observations to an estimator that stores its observations exactly
+	pStored := p.exact != nil || p.n[4] < 5
+	bStored := b.exact != nil || b.n[4] < 5
+	switch {
+	case bStored && (!pStored || p.exact != nil || b.exact == nil):
+		return p.combineObservations(b), nil
+	case pStored:
+		return b.combineObservations(p), nil
+	}
+	combined := *p
+	N := p.n[4] + b.n[4]
+	// the combined marker values are located between the union of the markers
+	values := make([]float64, 0, 10)
+	values = append(values, p.q[:]...)
+	values = append(values, b.q[:]...)
+	sort.Float64s(values)
+	for i := 0; i < 5; i++ {
+		combined.np[i] = 1 + float64(N-1)*p.dnp[i]
+	}
+	combined.q[0] = values[0]
+	combined.q[4] = values[9]
+	for i := 1; i < 4; i++ {
+		target := combined.np[i]
+		j := sort.Search(len(values), func(j int) bool { return p.rank(values[j])+b.rank(values[j]) >= target })
+		switch {
+		case j == 0:
+			combined.q[i] = values[0]
+		case j == len(values):
+			combined.q[i] = values[9]
+		default:
+			lo := p.rank(values[j-1]) + b.rank(values[j-1])
+			hi := p.rank(values[j]) + b.rank(values[j])
+			combined.q[i] = values[j-1] + (target-lo)*(values[j]-values[j-1])/(hi-lo)
+		}
+	}
+	combined.n[0] = 1
+	combined.n[4] = N
+	for i := 1; i < 4; i++ {
+		n := uint64(combined.np[i] + 0.5) // round to the nearest position
+		if n <= combined.n[i-1] {
+			n = combined.n[i-1] + 1 // positions must be strictly increasing
+		} else if n > N-4+uint64(i) {
+			n = N - 4 + uint64(i) // leave room for the markers above
+		}
+		combined.n[i] = n
+	}
+	combined.adjustments = p.adjustments + b.adjustments
+	combined.nonFinite = p.nonFinite.combine(b.nonFinite)
+	return combined, nil
+}
+
+// combineObservations returns a copy of p with the observations stored in b added
+// b must either store its observations exactly or have fewer than 5 observations
+func (p *P2Quantile) combineObservations(b *P2Quantile) P2Quantile {
+	combined := *p
+	if p.exact != nil {
+		combined.exact = make([]float64, len(p.exact), p.exactUntil)
+		copy(combined.exact, p.exact)
+	}
+	observations := b.exact
+	if observations == nil {
+		observations = b.q[:b.n[4]]
+	}
+	for _, x := range observations {
+		combined.Push(x)
+	}
+	combined.nonFinite = combined.nonFinite.combine(b.nonFinite)
+	return combined
+}
+
+// rank returns the estimated number of observations less than or equal to x
+// linearly interpolating the positions between the markers
+func (p *P2Quantile) rank(x float64) float64 {
+	switch {
+	case x < p.q[0]:
+		return 0.0
+	case x >= p.q[4]:
+		return float64(p.n[4])
+	}
+	i := 0
+	for x >= p.q[i+1] {
+		i++
+	}
+	return float64(p.n[i]) + (x-p.q[i])*float64(p.n[i+1]-p.n[i])/(p.q[i+1]-p.q[i])
+}
+
+// sortedQuantile returns the p-quantile of the sorted values using linear interpolation between
+// the closest ranks, (N-1)*p, the R-7 definition, or 0 if there are no values
+// p is bounded by 0 and 1 for the minimum and maximum like GKQuantile.Quantile, a NaN p returns the minimum
+func sortedQuantile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0.0
+	}
+	if !(p > 0.0) { // also NaN
+		return sorted[0]
+	}
+	if p >= 1.0 {
+		return sorted[len(sorted)-1]
+	}
+	h := float64(len(sorted)-1) * p
+	i := int(h)
+	if i >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[i] + (h-float64(i))*(sorted[i+1]-sorted[i])
+}
+
 // P returns the quantile being tracked
 func (p *P2Quantile) P() float64 {
 	return p.p
@@ -106,35 +346,81 @@ func (p *P2Quantile) N() uint64 {
 	return p.n[4]
 }
 
+// IsExact returns true while the quantiles are computed from the literal observations,
+// either the first 5 observations held by the markers or the buffer of NewP2QuantileExactUntil,
+// and false once the markers are estimates
+func (p *P2Quantile) IsExact() bool {
+	return p.exact != nil || p.n[4] <= 5
+}
+
+// AdjustmentCount returns the number of times an internal marker height has been adjusted
+// markers are adjusted often while the estimate converges, a high rate of adjustments late
+// in a long stream indicates a non-stationary distribution
+func (p *P2Quantile) AdjustmentCount() uint64 {
+	return p.adjustments
+}
+
+// stored returns the sorted observations while the markers still hold every value seen, N <= 5
+// so that small streams are interpolated the same way as the exact buffer, or nil otherwise
+func (p *P2Quantile) stored() []float64 {
+	if p.n[4] == 0 || p.n[4] > 5 {
+		return nil
+	}
+	return p.q[:p.n[4]]
+}
+
 // Quantile returns the estimated value for the p-quantile
+// or the exact minimum or maximum for p = 0 or p = 1
+// for N <= 5 the estimate linearly interpolates the sorted observations (R-7)
 func (p *P2Quantile) Quantile() float64 {
-	if p.n[4] < 5 && 0 < p.n[4] {
-		if p.n[4]%2 == 0 {
-			return (p.q[p.n[4]/2-1] + p.q[p.n[4]/2]) / 2 // average of values around median for even N
-		}
-		return p.q[p.n[4]/2] // the median value seen in the first 5 for odd N
+	switch p.p {
+	case 0.0:
+		return p.Min()
+	case 1.0:
+		return p.Max()
+	}
+	if p.exact != nil {
+		return sortedQuantile(p.exact, p.p)
 	}
-	return p.q[2] // the estimate of the median
+	if stored := p.stored(); stored != nil {
+		return sortedQuantile(stored, p.p)
+	}
+	return p.q[2] // the estimate of the p-quantile
 }
 
 // UpperQuantile returns the estimate for the upper quantile, (1+p/2)
 func (p *P2Quantile) UpperQuantile() float64 {
-	if p.n[4] < 5 && 0 < p.n[4] {
-		return (p.Quantile() + p.Max()) / 2 // average the data if we don't have enough points yet
+	if p.p == 1.0 {
+		return p.Max()
+	}
+	if p.exact != nil {
+		return sortedQuantile(p.exact, (1+p.p)/2)
+	}
+	if stored := p.stored(); stored != nil {
+		return sortedQuantile(stored, (1+p.p)/2)
 	}
 	return p.q[3]
 }
 
 // LowerQuantile returns the estimate for the lower quantile, p/2
 func (p *P2Quantile) LowerQuantile() float64 {
-	if p.n[4] < 5 && 0 < p.n[4] {
-		return (p.Min() + p.Quantile()) / 2 // average the data if we don't have enough points yet
+	if p.p == 0.0 {
+		return p.Min()
+	}
+	if p.exact != nil {
+		return sortedQuantile(p.exact, p.p/2)
+	}
+	if stored := p.stored(); stored != nil {
+		return sortedQuantile(stored, p.p/2)
 	}
 	return p.q[1]
 }
 
 // Max returns the exact maximum value seen so far
 func (p *P2Quantile) Max() float64 {
+	if p.exact != nil {
+		return sortedQuantile(p.exact, 1.0)
+	}
 	if p.n[4] < 5 && 0 < p.n[4] {
 		return p.q[p.n[4]-1] // the highest for small counts
 	}
@@ -143,5 +429,14 @@ func (p *P2Quantile) Max() float64 {
 
 // Min returns the exact minimum value seen so far
 func (p *P2Quantile) Min() float64 {
+	if p.exact != nil {
+		return sortedQuantile(p.exact, 0.0)
+	}
 	return p.q[0]
 }
+
+// String returns the standard string representation of the quantiles estimated so far
+// with a fixed field order and precision so the same observations always produce the same string
+func (p *P2Quantile) String() string {
+	return fmt.Sprintf("P: %0.3f Quantile: %0.3f LowerQuantile: %0.3f UpperQuantile: %0.3f Min: %0.3f Max: %0.3f N: %d", p.P(), p.Quantile(), p.LowerQuantile(), p.UpperQuantile(), p.Min(), p.Max(), p.N())
+}
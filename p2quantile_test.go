@@ -2,7 +2,7 @@ package streamstats
 
 import (
 	"math"
-	"math/rand"
+	"sort"
 	"testing"
 )
 
@@ -152,6 +152,48 @@ var expectedP2Stats = []expectedP2Stat{
 	},
 }
 
+func TestNewP2QuantileInvalidP(t *testing.T) {
+	for _, p := range []float64{-0.5, 1.5, 50, math.NaN(), math.Inf(1)} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected NewP2Quantile(%v) to panic", p)
+				}
+			}()
+			NewP2Quantile(p)
+		}()
+	}
+}
+
+func TestP2QuantileExtremes(t *testing.T) {
+	min := NewP2Quantile(0.0)
+	max := NewP2Quantile(1.0)
+	for i := 0; i < N; i++ {
+		min.Add(gaussianTestData[i])
+		max.Add(gaussianTestData[i])
+		if min.Quantile() != min.Min() {
+			t.Fatalf("Expected p=0 Quantile to be the exact Min %f, got %f", min.Min(), min.Quantile())
+		}
+		if max.Quantile() != max.Max() {
+			t.Fatalf("Expected p=1 Quantile to be the exact Max %f, got %f", max.Max(), max.Quantile())
+		}
+	}
+	if min.LowerQuantile() != min.Min() {
+		t.Errorf("Expected p=0 LowerQuantile to be the exact Min %f, got %f", min.Min(), min.LowerQuantile())
+	}
+	if max.UpperQuantile() != max.Max() {
+		t.Errorf("Expected p=1 UpperQuantile to be the exact Max %f, got %f", max.Max(), max.UpperQuantile())
+	}
+	// the other markers track the median
+	eps := 0.05
+	if math.Abs(min.UpperQuantile()) > eps {
+		t.Errorf("Expected p=0 UpperQuantile to be the median 0.0, got %f", min.UpperQuantile())
+	}
+	if math.Abs(max.LowerQuantile()) > eps {
+		t.Errorf("Expected p=1 LowerQuantile to be the median 0.0, got %f", max.LowerQuantile())
+	}
+}
+
 func TestP2SmallN(t *testing.T) {
 	q := NewP2Quantile(0.5)
 	for _, e := range expectedP2Stats {
@@ -177,6 +219,33 @@ func TestP2SmallN(t *testing.T) {
 	}
 }
 
+func TestP2SmallNInterpolation(t *testing.T) {
+	// for N <= 5 all three quantiles interpolate the sorted observations (R-7)
+	var testCases = []struct {
+		x, q, uq, lq float64
+	}{
+		{10.0, 10.0, 10.0, 10.0},
+		{9.0, 9.9, 9.95, 9.45},
+		{8.0, 9.8, 9.9, 8.9},
+		{11.0, 10.7, 10.85, 9.35},
+		{6.0, 10.6, 10.8, 8.8},
+	}
+	eps := 1e-12
+	q := NewP2Quantile(0.9)
+	for i, test := range testCases {
+		q.Add(test.x)
+		if math.Abs(q.Quantile()-test.q) > eps {
+			t.Errorf("N=%d Quantile Expected %v, got %v", i+1, test.q, q.Quantile())
+		}
+		if math.Abs(q.UpperQuantile()-test.uq) > eps {
+			t.Errorf("N=%d UpperQuantile Expected %v, got %v", i+1, test.uq, q.UpperQuantile())
+		}
+		if math.Abs(q.LowerQuantile()-test.lq) > eps {
+			t.Errorf("N=%d LowerQuantile Expected %v, got %v", i+1, test.lq, q.LowerQuantile())
+		}
+	}
+}
+
 // dataPoints is the test data from Table 1 in the paper
 var dataPoints = []float64{
 	0.02,
@@ -252,7 +321,7 @@ func TestP2DataPoints(t *testing.T) {
 }
 
 func TestP2GaussianDist(t *testing.T) {
-	rand.Seed(42) // for deterministic testing
+	testRand.Seed(42) // for deterministic testing
 	N := 100000
 	// mean/stdev pairs for testing
 	testCases := [][2]float64{
@@ -298,7 +367,7 @@ func TestP2GaussianDist(t *testing.T) {
 }
 
 func TestP2ExponentialDist(t *testing.T) {
-	rand.Seed(42) // for deterministic testing
+	testRand.Seed(42) // for deterministic testing
 	N := 100000
 	eps := 0.03 // expect errors less than 3% for all quantiles
 	lambdas := []float64{1.0, 2.0, 0.5}
@@ -317,7 +386,7 @@ func TestP2ExponentialDist(t *testing.T) {
 }
 
 func TestP2UniformDist(t *testing.T) {
-	rand.Seed(42) // for deterministic testing
+	testRand.Seed(42) // for deterministic testing
 	N := 100000
 	eps := 0.03 // expect errors less than 3% for all quantiles
 	minMaxs := [][2]float64{
@@ -343,7 +412,7 @@ func TestP2UniformDist(t *testing.T) {
 }
 
 func TestP2CauchyDist(t *testing.T) {
-	rand.Seed(42) // for deterministic testing
+	testRand.Seed(42) // for deterministic testing
 	N := 100000
 	eps := 0.05 // expect errors less than 5% for all quantiles
 	x0Gammas := [][2]float64{
@@ -368,6 +437,329 @@ func TestP2CauchyDist(t *testing.T) {
 	}
 }
 
+func TestP2QuantileAdjustmentCount(t *testing.T) {
+	stationary := NewP2Quantile(0.5)
+	shifted := NewP2Quantile(0.5)
+	for i := 0; i < 5; i++ {
+		stationary.Add(gaussianTestData[i])
+	}
+	if stationary.AdjustmentCount() != 0 {
+		t.Errorf("Expected no adjustments during initialization, got %d", stationary.AdjustmentCount())
+	}
+	stationary = NewP2Quantile(0.5)
+	half := N / 2
+	for i := 0; i < half; i++ {
+		stationary.Add(gaussianTestData[i])
+		shifted.Add(gaussianTestData[i])
+	}
+	first := stationary.AdjustmentCount()
+	if first == 0 || first != shifted.AdjustmentCount() {
+		t.Errorf("Expected equal non-zero adjustments for the same data, got %d and %d", first, shifted.AdjustmentCount())
+	}
+	for i := half; i < N; i++ {
+		stationary.Add(gaussianTestData[i])
+		shifted.Add(gaussianTestData[i] + 10.0)
+	}
+	// the shifted distribution requires the markers to move continuously
+	stationaryRate := stationary.AdjustmentCount() - first
+	shiftedRate := shifted.AdjustmentCount() - first
+	if shiftedRate < 2*stationaryRate {
+		t.Errorf("Expected a non-stationary stream to have at least twice the adjustments %d, got %d", stationaryRate, shiftedRate)
+	}
+}
+
+func TestP2QuantileCombine(t *testing.T) {
+	p := 0.9
+	var testCases = []struct {
+		name      string
+		a, b      func(i int) float64
+		tolerance float64
+	}{
+		// shards of the same distribution have nearly identical markers to merge
+		{"same", func(i int) float64 { return gaussianTestData[2*i] }, func(i int) float64 { return gaussianTestData[2*i+1] }, 0.02},
+		// shards of different distributions are only coarsely approximated between the markers
+		{"different", func(i int) float64 { return gaussianTestData[i] }, func(i int) float64 { return exponentialTestData[i] + 1.0 }, 0.25},
+	}
+	for _, test := range testCases {
+		a := NewP2Quantile(p)
+		b := NewP2Quantile(p)
+		sorted := make([]float64, 0, N)
+		for i := 0; i < N/2; i++ {
+			a.Add(test.a(i))
+			b.Add(test.b(i))
+			sorted = append(sorted, test.a(i), test.b(i))
+		}
+		sort.Float64s(sorted)
+		combined, err := a.Combine(&b)
+		if err != nil {
+			t.Fatalf("P2Quantile Combine failed: %s", err)
+		}
+		if combined.N() != uint64(N) {
+			t.Errorf("Expected N %d, got %d", N, combined.N())
+		}
+		if combined.Min() != sorted[0] || combined.Max() != sorted[N-1] {
+			t.Errorf("Expected exact Min %f and Max %f, got %f and %f", sorted[0], sorted[N-1], combined.Min(), combined.Max())
+		}
+		for _, quantile := range []struct {
+			name string
+			got  float64
+			p    float64
+		}{
+			{"Quantile", combined.Quantile(), p},
+			{"UpperQuantile", combined.UpperQuantile(), (1 + p) / 2},
+			{"LowerQuantile", combined.LowerQuantile(), p / 2},
+		} {
+			expected := sortedQuantile(sorted, quantile.p)
+			if math.Abs(quantile.got-expected) > test.tolerance*math.Max(1.0, math.Abs(expected)) {
+				t.Errorf("Expected %s combined %s %f, got %f", test.name, quantile.name, expected, quantile.got)
+			}
+		}
+		// continue streaming into the combined estimator
+		for i := 0; i < N/2; i++ {
+			combined.Add(test.a(i))
+		}
+		if combined.N() != uint64(N+N/2) {
+			t.Errorf("Expected N %d after streaming, got %d", N+N/2, combined.N())
+		}
+	}
+	a := NewP2Quantile(p)
+	if _, err := a.Combine(&initial50P2); err == nil {
+		t.Errorf("Expected Combine of different p to return error")
+	}
+}
+
+func TestP2QuantileCombineSmallN(t *testing.T) {
+	p := 0.5
+	a := NewP2Quantile(p)
+	b := NewP2QuantileExactUntil(p, 20)
+	all := NewP2QuantileExactUntil(p, 20)
+	for i := 0; i < 3; i++ {
+		a.Add(uniformTestData[i])
+		all.Add(uniformTestData[i])
+	}
+	for i := 3; i < 10; i++ {
+		b.Add(uniformTestData[i])
+		all.Add(uniformTestData[i])
+	}
+	// the observations of the uninitialized estimator are added to the other
+	for _, combine := range []func() (P2Quantile, error){
+		func() (P2Quantile, error) { return a.Combine(&b) },
+		func() (P2Quantile, error) { return b.Combine(&a) },
+	} {
+		combined, err := combine()
+		if err != nil {
+			t.Fatalf("P2Quantile Combine failed: %s", err)
+		}
+		if combined.Quantile() != all.Quantile() {
+			t.Errorf("Expected exact Quantile %f, got %f", all.Quantile(), combined.Quantile())
+		}
+		if combined.N() != all.N() {
+			t.Errorf("Expected N %d, got %d", all.N(), combined.N())
+		}
+	}
+	if b.N() != 7 {
+		t.Errorf("Expected Combine not to modify the exact observations, got N %d", b.N())
+	}
+	empty := NewP2Quantile(p)
+	combined, _ := empty.Combine(&a)
+	if combined.N() != a.N() || combined.Quantile() != a.Quantile() {
+		t.Errorf("Expected combining with an empty estimator to be a copy, got N %d Quantile %f", combined.N(), combined.Quantile())
+	}
+}
+
+func TestP2QuantileAbs(t *testing.T) {
+	p := 0.9
+	qAbs := NewP2QuantileAbs(p)
+	q := NewP2Quantile(p)
+	// add the signed data to one and the absolute value to the other and compare
+	for i := 0; i < N; i++ {
+		qAbs.Add(gaussianTestData[i])
+		q.Add(math.Abs(gaussianTestData[i]))
+	}
+	if qAbs.Quantile() != q.Quantile() {
+		t.Errorf("Expected Quantile %v, got %v", q.Quantile(), qAbs.Quantile())
+	}
+	if qAbs.Min() < 0.0 {
+		t.Errorf("Expected Min >= 0, got %v", qAbs.Min())
+	}
+	if qAbs.Max() != q.Max() {
+		t.Errorf("Expected Max %v, got %v", q.Max(), qAbs.Max())
+	}
+	z90 := 1.6449 // the 90th percentile of |x| for a standard normal is the 95th percentile of x
+	if math.Abs(qAbs.Quantile()-z90) > 0.05 {
+		t.Errorf("Expected Quantile of |x| == %v, got %v", z90, qAbs.Quantile())
+	}
+}
+
+func TestP2QuantileTies(t *testing.T) {
+	constant := NewP2Quantile(0.9)
+	for i := 0; i < N; i++ {
+		constant.Add(3.0)
+	}
+	for _, x := range []float64{constant.Quantile(), constant.UpperQuantile(), constant.LowerQuantile()} {
+		if x != 3.0 {
+			t.Errorf("Expected a constant stream to have all quantiles 3.0, got %v", x)
+		}
+	}
+	infinite := NewP2Quantile(0.5)
+	for i := 0; i < N; i++ {
+		infinite.Add(math.Inf(2*(i%2) - 1))
+	}
+	for i := 0; i < 5; i++ {
+		if math.IsNaN(infinite.q[i]) {
+			t.Errorf("Expected no NaN markers for a stream of infinities, got %v", infinite.q)
+		}
+	}
+	// values 0, 1, 2 with probabilities 0.25, 0.5, 0.25
+	ties := NewP2Quantile(0.5)
+	testRand.Seed(42)
+	for i := 0; i < N; i++ {
+		ties.Add([]float64{0.0, 1.0, 1.0, 2.0}[testRand.Intn(4)])
+	}
+	for i := 1; i < 5; i++ {
+		if ties.q[i] < ties.q[i-1] || ties.n[i] <= ties.n[i-1] {
+			t.Errorf("Expected ordered markers, got heights %v at %v", ties.q, ties.n)
+		}
+	}
+	if math.Abs(ties.Quantile()-1.0) > 0.01 {
+		t.Errorf("Expected the median of heavy ties near 1.0, got %v", ties.Quantile())
+	}
+}
+
+func TestP2QuantileString(t *testing.T) {
+	q := NewP2Quantile(0.5)
+	for _, x := range []float64{3.0, 1.0, 5.0, 2.0, 4.0} {
+		q.Add(x)
+	}
+	expected := "P: 0.500 Quantile: 3.000 LowerQuantile: 2.000 UpperQuantile: 4.000 Min: 1.000 Max: 5.000 N: 5"
+	if q.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, q.String())
+	}
+}
+
+func TestP2QuantileIsExact(t *testing.T) {
+	q := NewP2Quantile(0.9)
+	for i := 0; i < 5; i++ {
+		q.Add(gaussianTestData[i])
+		if !q.IsExact() {
+			t.Errorf("Expected IsExact while the markers hold the observations at N=%d", q.N())
+		}
+	}
+	q.Add(gaussianTestData[5])
+	if q.IsExact() {
+		t.Errorf("Expected the estimate not to be exact at N=%d", q.N())
+	}
+	k := 100
+	e := NewP2QuantileExactUntil(0.9, k)
+	for i := 0; i < k; i++ {
+		e.Add(gaussianTestData[i])
+	}
+	if !e.IsExact() {
+		t.Errorf("Expected IsExact while buffering %d observations", k)
+	}
+	e.Add(gaussianTestData[k])
+	if e.IsExact() {
+		t.Errorf("Expected the estimate not to be exact after %d observations", k+1)
+	}
+}
+
+func TestP2QuantileExactUntil(t *testing.T) {
+	p := 0.9
+	k := 100
+	q := NewP2QuantileExactUntil(p, k)
+	sorted := make([]float64, 0, k)
+	for i := 0; i < k; i++ {
+		x := exponentialTestData[i]
+		q.Add(x)
+		sorted = append(sorted, x)
+		sort.Float64s(sorted)
+		if q.N() != uint64(i+1) {
+			t.Errorf("Expected N %v, got %v", i+1, q.N())
+		}
+		// the quantiles are exact until k observations
+		if q.Quantile() != sortedQuantile(sorted, p) {
+			t.Errorf("Expected exact Quantile %v, got %v", sortedQuantile(sorted, p), q.Quantile())
+		}
+		if q.UpperQuantile() != sortedQuantile(sorted, (1+p)/2) {
+			t.Errorf("Expected exact UpperQuantile %v, got %v", sortedQuantile(sorted, (1+p)/2), q.UpperQuantile())
+		}
+		if q.LowerQuantile() != sortedQuantile(sorted, p/2) {
+			t.Errorf("Expected exact LowerQuantile %v, got %v", sortedQuantile(sorted, p/2), q.LowerQuantile())
+		}
+		if q.Min() != sorted[0] {
+			t.Errorf("Expected Min %v, got %v", sorted[0], q.Min())
+		}
+		if q.Max() != sorted[i] {
+			t.Errorf("Expected Max %v, got %v", sorted[i], q.Max())
+		}
+	}
+	// exceeding k seeds the markers from the stored observations
+	q.Add(exponentialTestData[k])
+	if q.exact != nil {
+		t.Errorf("Expected the exact observations to be released after %d observations", k)
+	}
+	for i := 1; i < 5; i++ {
+		if q.n[i] <= q.n[i-1] {
+			t.Errorf("Expected increasing marker positions, got %v", q.n)
+		}
+		if q.q[i] < q.q[i-1] {
+			t.Errorf("Expected non-decreasing marker heights, got %v", q.q)
+		}
+	}
+	if q.N() != uint64(k+1) {
+		t.Errorf("Expected N %v, got %v", k+1, q.N())
+	}
+	for i := k + 1; i < N; i++ {
+		q.Add(exponentialTestData[i])
+	}
+	eps := 0.03
+	if math.Abs((exponentialQuantile(p, 1.0)-q.Quantile())/exponentialQuantile(p, 1.0)) > eps {
+		t.Errorf("Expected %v, got %v", exponentialQuantile(p, 1.0), q.Quantile())
+	}
+
+	// small k is the same as the standard estimator
+	q = NewP2QuantileExactUntil(p, 3)
+	if q.exact != nil {
+		t.Errorf("Expected no exact storage for k <= 5")
+	}
+}
+
+func TestP2QuantileClone(t *testing.T) {
+	// a Clone made while the observations are stored exactly is independent of the original
+	q := NewP2QuantileExactUntil(0.5, 100)
+	for i := 0; i < 10; i++ {
+		q.Push(float64(i))
+	}
+	c := q.Clone()
+	for i := 0; i < 10; i++ {
+		q.Push(100.0 + float64(i))
+		c.Push(-100.0 - float64(i))
+	}
+	if q.Min() != 0.0 || q.Max() != 109.0 || q.Quantile() != 54.5 {
+		t.Errorf("Expected the original to have Min 0, Max 109 and median 54.5, got %v %v %v", q.Min(), q.Max(), q.Quantile())
+	}
+	if c.Min() != -109.0 || c.Max() != 9.0 || c.Quantile() != -50.0 {
+		t.Errorf("Expected the copy to have Min -109, Max 9 and median -50, got %v %v %v", c.Min(), c.Max(), c.Quantile())
+	}
+	bp := BoxPlot{NewP2QuantileExactUntil(0.5, 100)}
+	for i := 0; i < 10; i++ {
+		bp.Push(float64(i))
+	}
+	combined, err := bp.Combine(bp)
+	if err != nil {
+		t.Fatalf("Expected no error combining a BoxPlot with itself, got %v", err)
+	}
+	combined.Push(-1.0)
+	if bp.N() != 10 || bp.Min() != 0.0 {
+		t.Errorf("Expected the combined BoxPlot to be independent of its inputs, got N %d and Min %v", bp.N(), bp.Min())
+	}
+	clone := bp.Clone()
+	clone.Push(-1.0)
+	if bp.N() != 10 || bp.Min() != 0.0 || clone.N() != 11 || clone.Min() != -1.0 {
+		t.Errorf("Expected the cloned BoxPlot to be independent, got N %d and %d", bp.N(), clone.N())
+	}
+}
+
 func BenchmarkP2QuantileAdd(b *testing.B) {
 	q := NewP2Quantile(0.5)
 	for i := 0; i < b.N; i++ {
@@ -375,3 +767,22 @@ func BenchmarkP2QuantileAdd(b *testing.B) {
 	}
 	result = q.Quantile() // to avoid optimizing out the loop entirely
 }
+
+func TestP2QuantilePush(t *testing.T) {
+	added := NewP2Quantile(0.9)
+	pushed := NewP2Quantile(0.9)
+	bpAdded := NewBoxPlot()
+	bpPushed := NewBoxPlot()
+	for i := 0; i < 1000; i++ {
+		added.Add(exponentialTestData[i])
+		pushed.Push(exponentialTestData[i])
+		bpAdded.Add(exponentialTestData[i])
+		bpPushed.Push(exponentialTestData[i])
+	}
+	if added.String() != pushed.String() {
+		t.Errorf("Expected Add to be an alias of Push, got %s and %s", added.String(), pushed.String())
+	}
+	if bpAdded.String() != bpPushed.String() {
+		t.Errorf("Expected BoxPlot Add to be an alias of Push, got %s and %s", bpAdded, bpPushed)
+	}
+}
@@ -0,0 +1,61 @@
+package streamstats
+
+import "math"
+
+// PageHinkley is a Page-Hinkley test for an upward drift in the mean of a stream, e.g. concept drift in an error rate
+// it accumulates the deviations of each observation from the running mean of the stream so far, less the tolerance delta,
+// m_T = sum_t (x_t - mean_t - delta), and signals a drift when the gap m_T - min_t m_t exceeds lambda
+// unlike CUSUM no reference distribution is required, the baseline is the running MomentStats mean
+// to detect a downward drift add the negated observations
+type PageHinkley struct {
+	delta   float64     // the magnitude of changes that are tolerated
+	lambda  float64     // the detection threshold of the gap
+	stats   MomentStats // the running mean of the observations
+	sum     float64     // the cumulative deviation m_T
+	minimum float64     // the minimum cumulative deviation seen
+}
+
+// NewPageHinkley returns a PageHinkley test that tolerates changes of magnitude delta
+// and signals a drift when the cumulative deviation rises more than lambda above its minimum
+func NewPageHinkley(delta, lambda float64) *PageHinkley {
+	return &PageHinkley{delta: delta, lambda: lambda}
+}
+
+// Add is an alias of Push
+func (ph *PageHinkley) Add(x float64) {
+	ph.Push(x)
+}
+
+// Push updates the running mean and the cumulative deviation with the observation x
+func (ph *PageHinkley) Push(x float64) {
+	ph.stats.Add(x)
+	ph.sum += x - ph.stats.Mean() - ph.delta
+	ph.minimum = math.Min(ph.minimum, ph.sum)
+}
+
+// Statistic returns the gap between the cumulative deviation and its minimum
+func (ph *PageHinkley) Statistic() float64 {
+	return ph.sum - ph.minimum
+}
+
+// Drift returns true if the gap between the cumulative deviation and its minimum exceeds lambda
+func (ph *PageHinkley) Drift() bool {
+	return ph.Statistic() > ph.lambda
+}
+
+// Mean returns the running mean of the observations since creation or the last Reset
+func (ph *PageHinkley) Mean() float64 {
+	return ph.stats.Mean()
+}
+
+// N returns the number of observations since creation or the last Reset
+func (ph *PageHinkley) N() uint64 {
+	return ph.stats.N()
+}
+
+// Reset clears the running mean and the cumulative deviation, e.g. after a drift is handled
+func (ph *PageHinkley) Reset() {
+	ph.stats = MomentStats{}
+	ph.sum = 0.0
+	ph.minimum = 0.0
+}
@@ -0,0 +1,42 @@
+package streamstats
+
+import "testing"
+
+func TestPageHinkley(t *testing.T) {
+	ph := NewPageHinkley(0.5, 50.0)
+	for i := 0; i < N/2; i++ {
+		ph.Push(gaussianTestData[i])
+		if ph.Drift() {
+			t.Fatalf("Expected no drift in a stationary stream, got statistic %v after %d", ph.Statistic(), i+1)
+		}
+	}
+	// an upward shift of two standard deviations is detected quickly
+	var detectedAfter int
+	for i := N / 2; i < N; i++ {
+		ph.Push(2.0 + gaussianTestData[i])
+		if ph.Drift() {
+			detectedAfter = i - N/2 + 1
+			break
+		}
+	}
+	if detectedAfter == 0 || detectedAfter > 100 {
+		t.Errorf("Expected a shift of 2 to be detected within 100 observations, got %d", detectedAfter)
+	}
+	ph.Reset()
+	if ph.N() != 0 || ph.Statistic() != 0.0 || ph.Drift() {
+		t.Errorf("Expected Reset to clear the test, got N %d statistic %v", ph.N(), ph.Statistic())
+	}
+	// a downward shift is not an upward drift
+	for i := 0; i < N/2; i++ {
+		ph.Add(gaussianTestData[i])
+	}
+	for i := N / 2; i < N; i++ {
+		ph.Add(gaussianTestData[i] - 2.0)
+		if ph.Drift() {
+			t.Fatalf("Expected a downward shift not to signal drift, got statistic %v", ph.Statistic())
+		}
+	}
+	if ph.Mean() > 0.0 {
+		t.Errorf("Expected a negative running mean after the downward shift, got %v", ph.Mean())
+	}
+}
@@ -0,0 +1,106 @@
+package streamstats
+
+import (
+	"hash"
+	"runtime"
+	"sync"
+)
+
+// BuildHyperLogLogParallel returns a HyperLogLog with 2^p buckets of all of the items
+// built by splitting the items across the given number of workers, each adding to its own HyperLogLog
+// with its own hash function from newHash, then merging the buckets as in Union
+// if workers is less than 1, GOMAXPROCS workers are used
+func BuildHyperLogLogParallel(items [][]byte, p byte, newHash func() hash.Hash64, workers int) *HyperLogLog {
+	sketches := make([]*HyperLogLog, parallelWorkers(len(items), workers))
+	parallelAdd(items, len(sketches), func(w int, chunk [][]byte) {
+		hll := NewHyperLogLog(p, newHash())
+		for _, item := range chunk {
+			hll.Add(item)
+		}
+		sketches[w] = hll
+	})
+	combined := sketches[0]
+	for _, hll := range sketches[1:] {
+		for i := uint64(0); i < hll.data.len(); i++ {
+			if d := hll.data.get(i); d > combined.data.get(i) {
+				combined.data.set(i, d)
+			}
+		}
+	}
+	return combined
+}
+
+// BuildLinearCountingParallel returns a LinearCounting with 2^p buckets of all of the items
+// built by splitting the items across the given number of workers, each adding to its own LinearCounting
+// with its own hash function from newHash, then merging the buckets as in Union
+// if workers is less than 1, GOMAXPROCS workers are used
+func BuildLinearCountingParallel(items [][]byte, p byte, newHash func() hash.Hash64, workers int) *LinearCounting {
+	sketches := make([]*LinearCounting, parallelWorkers(len(items), workers))
+	parallelAdd(items, len(sketches), func(w int, chunk [][]byte) {
+		lc := NewLinearCounting(p, newHash())
+		for _, item := range chunk {
+			lc.Add(item)
+		}
+		sketches[w] = lc
+	})
+	combined := sketches[0]
+	for _, lc := range sketches[1:] {
+		for i, word := range lc.bits {
+			combined.bits[i] |= word
+		}
+	}
+	return combined
+}
+
+// BuildBloomFilterParallel returns a BloomFilter sized for Nitems at the given false positive rate
+// containing all of the items built by splitting the items across the given number of workers,
+// each adding to its own BloomFilter with its own hash function from newHash, then merging the bits as in Union
+// if workers is less than 1, GOMAXPROCS workers are used
+func BuildBloomFilterParallel(items [][]byte, Nitems uint64, FalsePositiveRate float64, newHash func() hash.Hash64, workers int) *BloomFilter {
+	filters := make([]*BloomFilter, parallelWorkers(len(items), workers))
+	parallelAdd(items, len(filters), func(w int, chunk [][]byte) {
+		bf := NewBloomFilter(Nitems, FalsePositiveRate, newHash())
+		for _, item := range chunk {
+			bf.Add(item)
+		}
+		filters[w] = bf
+	})
+	combined := filters[0]
+	for _, bf := range filters[1:] {
+		for i, word := range bf.bits {
+			combined.bits[i] |= word
+		}
+	}
+	return combined
+}
+
+// parallelWorkers returns the number of workers to use for n items, at least 1 and at most n
+// defaulting to GOMAXPROCS if workers is less than 1
+func parallelWorkers(n, workers int) int {
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > n {
+		workers = n
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	return workers
+}
+
+// parallelAdd splits the items into contiguous chunks and calls add for each chunk in its own goroutine
+// waiting for all of them to finish
+func parallelAdd(items [][]byte, workers int, add func(w int, chunk [][]byte)) {
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		start := w * len(items) / workers
+		end := (w + 1) * len(items) / workers
+		wg.Add(1)
+		go func(w int, chunk [][]byte) {
+			defer wg.Done()
+			add(w, chunk)
+		}(w, items[start:end])
+	}
+	wg.Wait()
+}
@@ -0,0 +1,43 @@
+package streamstats
+
+import (
+	"hash"
+	"hash/fnv"
+	"testing"
+)
+
+func TestBuildParallel(t *testing.T) {
+	items := randomBytes[:]
+	for _, workers := range []int{0, 1, 3, 8, 2 * N} {
+		hll := NewHyperLogLog(10, fnv.New64())
+		lc := NewLinearCounting(14, fnv.New64())
+		bf := NewBloomFilter(N, 0.01, fnv.New64())
+		for _, item := range items {
+			hll.Add(item)
+			lc.Add(item)
+			bf.Add(item)
+		}
+		// the parallel builds are identical to adding every item sequentially
+		if hllP := BuildHyperLogLogParallel(items, 10, fnv.New64, workers); !hllP.Equal(hll) {
+			t.Errorf("Expected parallel HyperLogLog with %d workers to match sequential", workers)
+		}
+		if lcP := BuildLinearCountingParallel(items, 14, fnv.New64, workers); !lcP.Equal(lc) {
+			t.Errorf("Expected parallel LinearCounting with %d workers to match sequential", workers)
+		}
+		if bfP := BuildBloomFilterParallel(items, N, 0.01, fnv.New64, workers); !bfP.bits.Equal(bf.bits) || bfP.k != bf.k {
+			t.Errorf("Expected parallel BloomFilter with %d workers to match sequential", workers)
+		}
+	}
+	// an empty slice of items gives an empty sketch
+	newHash := func() hash.Hash64 { return fnv.New64() }
+	if hll := BuildHyperLogLogParallel(nil, 10, newHash, 4); hll.Distinct() != 0 {
+		t.Errorf("Expected an empty HyperLogLog, got %d", hll.Distinct())
+	}
+}
+
+func BenchmarkBuildHyperLogLogParallel(b *testing.B) {
+	items := longRandomBytes[:]
+	for i := 0; i < b.N; i++ {
+		count = BuildHyperLogLogParallel(items, 14, fnv.New64, 0).Distinct()
+	}
+}
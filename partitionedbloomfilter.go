@@ -0,0 +1,167 @@
+package streamstats
+
+import (
+	"fmt"
+	"hash"
+	"math"
+)
+
+// PartitionedBloomFilter is a BloomFilter whose m bits are split into k disjoint partitions of s = m/k bits
+// with each of the k hash functions setting one bit in its own partition, so the k bits of an item are always distinct
+// each partition is a LinearCounting of s buckets that every item is added to once, which makes Distinct
+// the plain LinearCounting estimate instead of one that assumes the k bits of an item are independent
+// compared to a BloomFilter of the same m and k slightly more bits are set by the same items since they never
+// collide within an item, so the false positive rate is slightly higher, though the difference is negligible
+// when s is large, and the k bits of an item are in k different regions so there is no gain in memory locality
+type PartitionedBloomFilter struct {
+	hash        hash.Hash64 // the base hash function
+	bits        BitVector   // the underlying occupied buckets, partition i is the bits [i*s, (i+1)*s)
+	k           uint64      // number of hash functions and partitions
+	s           uint64      // size of each partition in bits
+	ignoreEmpty bool        // skip zero-length items in Add and reject them in Check
+}
+
+// NewPartitionedBloomFilter returns a pointer to a new PartitionedBloomFilter with k partitions of m/k bits
+// where m and k are the size and number of hash functions of NewBloomFilter for the given number of items
+// and false positive rate, using the given hash function
+func NewPartitionedBloomFilter(Nitems uint64, FalsePositiveRate float64, hash hash.Hash64) *PartitionedBloomFilter {
+	m, k := bloomFilterSize(Nitems, FalsePositiveRate)
+	if k < 1 {
+		k = 1
+	}
+	s := m / k
+	return &PartitionedBloomFilter{hash: hash, bits: NewBitVector(k * s), k: k, s: s}
+}
+
+// SetIgnoreEmpty sets whether Add skips zero-length items and Check rejects them, by default an empty item
+// is hashed like any other so it counts as one distinct item, the setting is kept by Union and Intersect
+func (pbf *PartitionedBloomFilter) SetIgnoreEmpty(ignore bool) {
+	pbf.ignoreEmpty = ignore
+}
+
+// Add puts an item in the set represented by the PartitionedBloomFilter
+// a zero-length item is added as a single item unless SetIgnoreEmpty is set
+func (pbf *PartitionedBloomFilter) Add(item []byte) {
+	if pbf.ignoreEmpty && len(item) == 0 {
+		return
+	}
+	h1, h2 := pbf.hashes(item)
+	for i := uint64(0); i < pbf.k; i++ {
+		pbf.bits.Set(pbf.bucket(i, h1+i*h2))
+	}
+}
+
+// Check returns false if an item in is definitely not in the set represented by the PartitionedBloomFilter
+func (pbf PartitionedBloomFilter) Check(item []byte) bool {
+	if pbf.ignoreEmpty && len(item) == 0 {
+		return false
+	}
+	h1, h2 := pbf.hashes(item)
+	for i := uint64(0); i < pbf.k; i++ {
+		if pbf.bits.Get(pbf.bucket(i, h1+i*h2)) != 1 { // if any bit is not set the item is not in the set
+			return false
+		}
+	}
+	return true // all hash functions check out
+}
+
+// AddFloat64 puts a float64 value in the set represented by the PartitionedBloomFilter
+// -0.0 and +0.0 are treated as the same value and all NaNs are treated as a single value
+func (pbf *PartitionedBloomFilter) AddFloat64(x float64) {
+	pbf.Add(float64Bytes(x))
+}
+
+// CheckFloat64 returns false if a float64 value is definitely not in the set represented by the PartitionedBloomFilter
+// using the same canonical -0.0 and NaN handling as AddFloat64
+func (pbf PartitionedBloomFilter) CheckFloat64(x float64) bool {
+	return pbf.Check(float64Bytes(x))
+}
+
+// hashes returns the bottom and top 32 bits of the hash of the item
+// which generate the k hash functions as h_i = h1 + i * h2 mod 2^32
+func (pbf PartitionedBloomFilter) hashes(item []byte) (h1, h2 uint64) {
+	pbf.hash.Reset()
+	pbf.hash.Write(item)
+	hash := pbf.hash.Sum64()
+	return hash & ((1 << 32) - 1), hash >> 32
+}
+
+// bucket returns the bit in partition i for the hash h, mapping the bottom 32 bits of h onto the s bits
+// of the partition by multiplying and shifting since s is not in general a power of two
+func (pbf PartitionedBloomFilter) bucket(i, h uint64) uint64 {
+	return i*pbf.s + ((h&((1<<32)-1))*pbf.s)>>32
+}
+
+// Occupancy returns the ratio of filled buckets in the PartitionedBloomFilter
+func (pbf PartitionedBloomFilter) Occupancy() float64 {
+	return float64(pbf.bits.PopCount()) / float64(pbf.k*pbf.s)
+}
+
+// FalsePositiveRate returns the expected false positive rate based on the ratio of filled buckets,
+// the product of the occupancy of each partition which is about the overall occupancy to the power k
+func (pbf PartitionedBloomFilter) FalsePositiveRate() float64 {
+	return math.Pow(pbf.Occupancy(), float64(pbf.k))
+}
+
+// Distinct estimates the number of elements in the filter by the LinearCounting estimate of the s buckets
+// of a partition using the average occupancy of the k partitions
+func (pbf PartitionedBloomFilter) Distinct() uint64 {
+	return pbf.distinctFromPopCount(pbf.bits.PopCount())
+}
+
+// Cardinality is an alias of Distinct, the name used by most other cardinality estimation libraries
+func (pbf PartitionedBloomFilter) Cardinality() uint64 {
+	return pbf.Distinct()
+}
+
+// ExpectedError returns the expected relative error of the Distinct estimate at the current filling
+// the LinearCounting error of the s buckets of a partition, or 0 for an empty PartitionedBloomFilter
+func (pbf PartitionedBloomFilter) ExpectedError() float64 {
+	return linearCountingErrorAt(pbf.Occupancy(), float64(pbf.s))
+}
+
+// Union combines two PartitionedBloomFilters producing one that contains all of the elements in either
+// the PartitionedBloomFilters must be the same size s and k as well as use the same hash function
+// the result is identical to a PartitionedBloomFilter built from both sets of items
+func (pbf PartitionedBloomFilter) Union(pbfB *PartitionedBloomFilter) (*PartitionedBloomFilter, error) {
+	if err := pbf.compatible(pbfB); err != nil {
+		return nil, err
+	}
+	bits := NewBitVector(pbf.k * pbf.s)
+	for i := range bits {
+		bits[i] = pbf.bits[i] | pbfB.bits[i]
+	}
+	return &PartitionedBloomFilter{hash: pbf.hash, bits: bits, k: pbf.k, s: pbf.s, ignoreEmpty: pbf.ignoreEmpty}, nil
+}
+
+// Intersect combines two PartitionedBloomFilters producing one that contains only of the elements in both
+// the PartitionedBloomFilters must be the same size s and k as well as use the same hash function
+// as for BloomFilter the result has no false negatives for items added to both, but Check on an item
+// from only one set should be treated as a possible false positive
+func (pbf PartitionedBloomFilter) Intersect(pbfB *PartitionedBloomFilter) (*PartitionedBloomFilter, error) {
+	if err := pbf.compatible(pbfB); err != nil {
+		return nil, err
+	}
+	bits := NewBitVector(pbf.k * pbf.s)
+	for i := range bits {
+		bits[i] = pbf.bits[i] & pbfB.bits[i]
+	}
+	return &PartitionedBloomFilter{hash: pbf.hash, bits: bits, k: pbf.k, s: pbf.s, ignoreEmpty: pbf.ignoreEmpty}, nil
+}
+
+// distinctFromPopCount returns the LinearCounting estimate of a partition for the given number of set bits
+func (pbf PartitionedBloomFilter) distinctFromPopCount(popCount uint64) uint64 {
+	occupancy := float64(popCount) / float64(pbf.k*pbf.s)
+	return roundEstimate(-float64(pbf.s) * math.Log(1-occupancy))
+}
+
+// compatible returns an error if the PartitionedBloomFilters can not be combined
+func (pbf PartitionedBloomFilter) compatible(pbfB *PartitionedBloomFilter) error {
+	if pbf.s != pbfB.s {
+		return fmt.Errorf("PartitionedBloomFilters do not have equal partition size s1 = %d != %d = s2", pbf.s, pbfB.s)
+	}
+	if pbf.k != pbfB.k {
+		return fmt.Errorf("PartitionedBloomFilters do not have equal number of partitions k1 = %d != %d = k2", pbf.k, pbfB.k)
+	}
+	return sameHash(pbf.hash, pbfB.hash, "PartitionedBloomFilter")
+}
@@ -0,0 +1,124 @@
+package streamstats
+
+import (
+	"hash/fnv"
+	"testing"
+)
+
+func TestPartitionedBloomFilter(t *testing.T) {
+	maxItems := uint64(1000)
+	pbf := NewPartitionedBloomFilter(maxItems, 0.01, fnv.New64())
+	bf := NewBloomFilter(maxItems, 0.01, fnv.New64())
+	if pbf.k != bf.k || pbf.s != bf.m/bf.k || uint64(len(pbf.bits)) != bitVectorWords(pbf.k*pbf.s) {
+		t.Errorf("Expected %d partitions of %d bits, got %d of %d", bf.k, bf.m/bf.k, pbf.k, pbf.s)
+	}
+	if pbf.ExpectedError() != 0.0 || pbf.Distinct() != 0 {
+		t.Errorf("Expected an empty PartitionedBloomFilter, got Distinct %d", pbf.Distinct())
+	}
+	for i := uint64(0); i < maxItems; i++ {
+		pbf.Add(randomBytes[i])
+	}
+	for i := uint64(0); i < maxItems; i++ {
+		if !pbf.Check(randomBytes[i]) {
+			t.Fatalf("Expected no false negatives, item %d was rejected", i)
+		}
+	}
+	// every item sets exactly one bit in each partition
+	for i := uint64(0); i < pbf.k; i++ {
+		var set uint64
+		for j := i * pbf.s; j < (i+1)*pbf.s; j++ {
+			set += pbf.bits.Get(j)
+		}
+		if set == 0 || set > maxItems {
+			t.Errorf("Expected between 1 and %d bits set in partition %d, got %d", maxItems, i, set)
+		}
+	}
+	var falsePositives int
+	for i := maxItems; i < maxItems+10000; i++ {
+		if pbf.Check(randomBytes[i]) {
+			falsePositives++
+		}
+	}
+	if fpr := float64(falsePositives) / 10000.0; fpr > 0.02 || fpr > 2.0*pbf.FalsePositiveRate()+0.005 {
+		t.Errorf("Expected a false positive rate near %v, got %v", pbf.FalsePositiveRate(), fpr)
+	}
+	if relativeError(pbf.Distinct(), maxItems) > 3.0*pbf.ExpectedError() || pbf.Cardinality() != pbf.Distinct() {
+		t.Errorf("Expected Distinct near %d within %v, got %d", maxItems, pbf.ExpectedError(), pbf.Distinct())
+	}
+	pbf.AddFloat64(-0.0)
+	if !pbf.CheckFloat64(0.0) {
+		t.Errorf("Expected -0.0 and +0.0 to be the same value")
+	}
+	pbf.SetIgnoreEmpty(true)
+	pbf.Add(nil)
+	if pbf.Check(nil) {
+		t.Errorf("Expected an empty item to be rejected when ignored")
+	}
+}
+
+func TestPartitionedBloomFilterUnionIntersect(t *testing.T) {
+	maxItems := uint64(300)
+	pbfA := NewPartitionedBloomFilter(maxItems, 0.01, fnv.New64())
+	pbfB := NewPartitionedBloomFilter(maxItems, 0.01, fnv.New64())
+	pbfAll := NewPartitionedBloomFilter(maxItems, 0.01, fnv.New64())
+	for i := uint64(0); i < 2*maxItems/3; i++ {
+		pbfA.Add(randomBytes[i])
+		pbfB.Add(randomBytes[i+maxItems/3])
+	}
+	for i := uint64(0); i < maxItems; i++ {
+		pbfAll.Add(randomBytes[i])
+	}
+	union, err := pbfA.Union(pbfB)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	for i := range union.bits {
+		if union.bits[i] != pbfAll.bits[i] {
+			t.Fatalf("Expected the Union to equal the filter of all the items")
+		}
+	}
+	intersect, err := pbfA.Intersect(pbfB)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	for i := maxItems / 3; i < 2*maxItems/3; i++ {
+		if !intersect.Check(randomBytes[i]) {
+			t.Fatalf("Expected no false negatives in the Intersect for items added to both filters")
+		}
+	}
+	if relativeError(intersect.Distinct(), maxItems/3) > 0.25 {
+		t.Errorf("Expected the Intersect to hold about %d items, got %d", maxItems/3, intersect.Distinct())
+	}
+	for _, other := range []*PartitionedBloomFilter{
+		NewPartitionedBloomFilter(10*maxItems, 0.01, fnv.New64()),
+		NewPartitionedBloomFilter(maxItems, 0.0001, fnv.New64()),
+		NewPartitionedBloomFilter(maxItems, 0.01, fnv.New64a()),
+	} {
+		if _, err := pbfA.Union(other); err == nil {
+			t.Errorf("Expected an error for the Union of incompatible filters")
+		}
+		if _, err := pbfA.Intersect(other); err == nil {
+			t.Errorf("Expected an error for the Intersect of incompatible filters")
+		}
+	}
+}
+
+func BenchmarkPartitionedBloomFilterAdd(b *testing.B) {
+	pbf := NewPartitionedBloomFilter(10000, 0.03, fnv.New64())
+	for i := 0; i < b.N; i++ {
+		pbf.Add(randomBytes[i&mask])
+	}
+}
+
+func BenchmarkPartitionedBloomFilterCheck(b *testing.B) {
+	pbf := NewPartitionedBloomFilter(10000, 0.03, fnv.New64())
+	for i := 0; i < 10000; i++ {
+		pbf.Add(randomBytes[i&mask])
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if pbf.Check(randomBytes[i&mask]) {
+			count++
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package streamstats
+
+import "math/rand"
+
+// randFloat64 returns a uniform random number in [0.0, 1.0) from the given source
+// or from the package level source of math/rand if the given source is nil
+func randFloat64(r *rand.Rand) float64 {
+	if r == nil {
+		return rand.Float64()
+	}
+	return r.Float64()
+}
+
+// randInt63n returns a uniform random number in [0, n) from the given source
+// or from the package level source of math/rand if the given source is nil
+func randInt63n(r *rand.Rand, n int64) int64 {
+	if r == nil {
+		return rand.Int63n(n)
+	}
+	return r.Int63n(n)
+}
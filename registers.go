@@ -0,0 +1,314 @@
+package streamstats
+
+import "sort"
+
+// registerStore is the storage of the HyperLogLog registers, trading the speed of one byte per register
+// for the memory of 6 bits per register, which holds the maximum register value 65-p < 64
+type registerStore interface {
+	get(i uint64) byte
+	set(i uint64, v byte)
+	len() uint64
+	// fold reduces the storage to newM registers in place, each the maximum of stride consecutive registers,
+	// and returns the reduced storage
+	fold(stride, newM uint64) registerStore
+	// each calls f with the index and value of every non-zero register in index order and returns their number,
+	// so a full scan of sparse storage only visits its entries and the zero registers are the rest of the m
+	each(f func(i uint64, v byte)) uint64
+	// reset sets every register to 0 keeping the kind of storage
+	reset()
+}
+
+// packedRegisterBits is the number of bits used for each register in packedRegisters
+const packedRegisterBits = 6
+
+// denseRegisters stores one register in each byte
+type denseRegisters []byte
+
+func (d denseRegisters) get(i uint64) byte {
+	return d[i]
+}
+
+func (d denseRegisters) set(i uint64, v byte) {
+	d[i] = v
+}
+
+func (d denseRegisters) len() uint64 {
+	return uint64(len(d))
+}
+
+func (d denseRegisters) each(f func(i uint64, v byte)) uint64 {
+	var n uint64
+	for i, v := range d {
+		if v != 0 {
+			f(uint64(i), v)
+			n++
+		}
+	}
+	return n
+}
+
+func (d denseRegisters) reset() {
+	clear(d)
+}
+
+// fold writes register i after reading registers i*stride and above, so no register is overwritten before it is read
+func (d denseRegisters) fold(stride, newM uint64) registerStore {
+	for i := uint64(0); i < newM; i++ {
+		v := d[i*stride]
+		for _, x := range d[i*stride+1 : (i+1)*stride] {
+			if x > v {
+				v = x
+			}
+		}
+		d[i] = v
+	}
+	return d[:newM:newM]
+}
+
+// packedRegisters stores the registers in consecutive 6-bit fields of 64-bit words
+// a register may span two words
+type packedRegisters struct {
+	words []uint64
+	m     uint64
+}
+
+// newPackedRegisters returns packed storage for m registers
+func newPackedRegisters(m uint64) *packedRegisters {
+	words := (m*packedRegisterBits + 63) / 64
+	return &packedRegisters{words: make([]uint64, words, words), m: m}
+}
+
+func (p *packedRegisters) get(i uint64) byte {
+	offset := i * packedRegisterBits
+	word, shift := offset/64, offset%64
+	v := p.words[word] >> shift
+	if shift > 64-packedRegisterBits { // the high bits are in the next word
+		v |= p.words[word+1] << (64 - shift)
+	}
+	return byte(v & (1<<packedRegisterBits - 1))
+}
+
+func (p *packedRegisters) set(i uint64, v byte) {
+	const mask = 1<<packedRegisterBits - 1
+	offset := i * packedRegisterBits
+	word, shift := offset/64, offset%64
+	x := uint64(v) & mask
+	p.words[word] = p.words[word]&^(mask<<shift) | x<<shift
+	if shift > 64-packedRegisterBits { // the high bits are in the next word
+		p.words[word+1] = p.words[word+1]&^(mask>>(64-shift)) | x>>(64-shift)
+	}
+}
+
+func (p *packedRegisters) len() uint64 {
+	return p.m
+}
+
+func (p *packedRegisters) each(f func(i uint64, v byte)) uint64 {
+	var n uint64
+	for i := uint64(0); i < p.m; i++ {
+		if v := p.get(i); v != 0 {
+			f(i, v)
+			n++
+		}
+	}
+	return n
+}
+
+func (p *packedRegisters) reset() {
+	clear(p.words)
+}
+
+func (p *packedRegisters) fold(stride, newM uint64) registerStore {
+	for i := uint64(0); i < newM; i++ {
+		v := p.get(i * stride)
+		for j := i*stride + 1; j < (i+1)*stride; j++ {
+			if x := p.get(j); x > v {
+				v = x
+			}
+		}
+		p.set(i, v)
+	}
+	p.words = p.words[:(newM*packedRegisterBits+63)/64]
+	p.m = newM
+	return p
+}
+
+// sparseRegisterBytes is the number of bytes used for each non-zero register in sparseRegisters
+const sparseRegisterBytes = 4
+
+// sparsePendingSize is the number of unsorted entries buffered by sparseRegisters before merging them
+// into the sorted entries, so filling to the threshold t takes O(t^2 / sparsePendingSize) instead of O(t^2)
+const sparsePendingSize = 256
+
+// sparseRegisters stores only the non-zero registers as entries of the index and value, index<<8 | value,
+// sorted by index, until there are more than threshold entries when they are converted to denseRegisters
+// a sparse entry uses 4 bytes so the sparse registers use less memory than dense while fewer than m/4 are non-zero
+// as in HyperLogLog++ new entries are appended to a small unsorted buffer that is merged into the sorted
+// entries once it is full, instead of shifting the sorted entries on every insert
+type sparseRegisters struct {
+	entries   []uint32
+	pending   []uint32       // the unsorted entries set since the last merge in order, a value of 0 removes the register
+	dense     denseRegisters // the registers after the conversion, nil while sparse
+	m         uint64
+	threshold int
+}
+
+// newSparseRegisters returns sparse storage for m registers that converts to dense after threshold entries
+// threshold is bounded by 0 and m
+func newSparseRegisters(m uint64, threshold int) *sparseRegisters {
+	if threshold < 0 {
+		threshold = 0
+	} else if uint64(threshold) > m {
+		threshold = int(m)
+	}
+	return &sparseRegisters{m: m, threshold: threshold}
+}
+
+// search returns the position of the entry for register i or where it would be inserted
+func (s *sparseRegisters) search(i uint64) int {
+	return sort.Search(len(s.entries), func(j int) bool { return uint64(s.entries[j]>>8) >= i })
+}
+
+func (s *sparseRegisters) get(i uint64) byte {
+	if s.dense != nil {
+		return s.dense[i]
+	}
+	for j := len(s.pending) - 1; j >= 0; j-- { // the latest pending entry overrides the sorted entries
+		if uint64(s.pending[j]>>8) == i {
+			return byte(s.pending[j])
+		}
+	}
+	if j := s.search(i); j < len(s.entries) && uint64(s.entries[j]>>8) == i {
+		return byte(s.entries[j])
+	}
+	return 0
+}
+
+func (s *sparseRegisters) set(i uint64, v byte) {
+	if s.dense != nil {
+		s.dense[i] = v
+		return
+	}
+	s.pending = append(s.pending, uint32(i)<<8|uint32(v))
+	switch {
+	case len(s.entries)+len(s.pending) > s.threshold:
+		// convert as soon as there may be more than threshold entries rather than merging on every set,
+		// which converts up to sparsePendingSize entries early if the pending entries update existing registers
+		s.densify()
+	case len(s.pending) >= sparsePendingSize:
+		s.merge()
+	}
+}
+
+// merge sorts the pending entries and merges them into the sorted entries, the latest pending entry
+// of a register replaces its value and a value of 0 removes it
+func (s *sparseRegisters) merge() {
+	if len(s.pending) == 0 {
+		return
+	}
+	sort.SliceStable(s.pending, func(a, b int) bool { return s.pending[a]>>8 < s.pending[b]>>8 })
+	merged := make([]uint32, 0, len(s.entries)+len(s.pending))
+	j := 0
+	for k := 0; k < len(s.pending); k++ {
+		e := s.pending[k]
+		if k+1 < len(s.pending) && s.pending[k+1]>>8 == e>>8 {
+			continue // a later entry for the same register follows
+		}
+		for j < len(s.entries) && s.entries[j]>>8 < e>>8 {
+			merged = append(merged, s.entries[j])
+			j++
+		}
+		if j < len(s.entries) && s.entries[j]>>8 == e>>8 {
+			j++ // replaced
+		}
+		if byte(e) != 0 {
+			merged = append(merged, e)
+		}
+	}
+	s.entries = append(merged, s.entries[j:]...)
+	s.pending = s.pending[:0]
+}
+
+// size returns the number of non-zero registers stored while sparse
+func (s *sparseRegisters) size() int {
+	s.merge()
+	return len(s.entries)
+}
+
+func (s *sparseRegisters) len() uint64 {
+	return s.m
+}
+
+func (s *sparseRegisters) each(f func(i uint64, v byte)) uint64 {
+	if s.dense != nil {
+		return s.dense.each(f)
+	}
+	s.merge()
+	for _, e := range s.entries {
+		f(uint64(e>>8), byte(e))
+	}
+	return uint64(len(s.entries))
+}
+
+func (s *sparseRegisters) reset() {
+	if s.dense != nil {
+		s.dense.reset()
+		return
+	}
+	s.entries = s.entries[:0]
+	s.pending = s.pending[:0]
+}
+
+// fold merges the entries of each stride of registers keeping the maximum value, which preserves the order
+func (s *sparseRegisters) fold(stride, newM uint64) registerStore {
+	if s.dense != nil {
+		s.dense = s.dense.fold(stride, newM).(denseRegisters)
+	} else {
+		s.merge()
+		folded := s.entries[:0]
+		for _, e := range s.entries {
+			i := uint32(uint64(e>>8) / stride)
+			if last := len(folded) - 1; last >= 0 && folded[last]>>8 == i {
+				if byte(e) > byte(folded[last]) {
+					folded[last] = e&0xff | i<<8
+				}
+				continue
+			}
+			folded = append(folded, e&0xff|i<<8)
+		}
+		s.entries = folded
+	}
+	s.m = newM
+	if uint64(s.threshold) > newM {
+		s.threshold = int(newM)
+	}
+	return s
+}
+
+// densify converts the entries to dense registers, which are used from then on
+func (s *sparseRegisters) densify() {
+	s.merge()
+	s.dense = make(denseRegisters, s.m, s.m)
+	for _, e := range s.entries {
+		s.dense[e>>8] = byte(e)
+	}
+	s.entries = nil
+	s.pending = nil
+}
+
+// isSparse returns true if the registers have not been converted to dense
+func (s *sparseRegisters) isSparse() bool {
+	return s.dense == nil
+}
+
+// newRegisterStoreLike returns empty storage for m registers of the same kind as store
+// sparse storage starts sparse again with the same threshold bounded by m
+func newRegisterStoreLike(store registerStore, m uint64) registerStore {
+	switch s := store.(type) {
+	case *packedRegisters:
+		return newPackedRegisters(m)
+	case *sparseRegisters:
+		return newSparseRegisters(m, s.threshold)
+	}
+	return make(denseRegisters, m, m)
+}
@@ -0,0 +1,188 @@
+package streamstats
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"testing"
+)
+
+func TestPackedRegisters(t *testing.T) {
+	m := uint64(1000)
+	packed := newPackedRegisters(m)
+	dense := make(denseRegisters, m, m)
+	if packed.len() != m || uint64(len(packed.words)) != (m*packedRegisterBits+63)/64 {
+		t.Errorf("Expected %d registers in %d words, got %d in %d", m, (m*packedRegisterBits+63)/64, packed.len(), len(packed.words))
+	}
+	testRand.Seed(42)
+	for round := 0; round < 3; round++ {
+		for i := uint64(0); i < m; i++ {
+			v := byte(testRand.Intn(64))
+			packed.set(i, v)
+			dense.set(i, v)
+		}
+		// every register including those spanning two words is independent of its neighbours
+		for i := uint64(0); i < m; i++ {
+			if packed.get(i) != dense.get(i) {
+				t.Errorf("Expected register %d to be %d, got %d", i, dense.get(i), packed.get(i))
+			}
+		}
+	}
+}
+
+func TestHyperLogLogPacked(t *testing.T) {
+	dense := NewHyperLogLog(10, fnv.New64())
+	packed := NewHyperLogLogPacked(10, fnv.New64())
+	for i := 0; i < N; i++ {
+		dense.Add(randomBytes[i])
+		packed.Add(randomBytes[i])
+	}
+	if !packed.Equal(dense) || packed.Distinct() != dense.Distinct() {
+		t.Errorf("Expected the packed HyperLogLog to equal the dense one, got Distinct %d and %d", packed.Distinct(), dense.Distinct())
+	}
+	compressed := packed.Compress(2)
+	if _, ok := compressed.data.(*packedRegisters); !ok || !compressed.Equal(dense.Compress(2)) {
+		t.Errorf("Expected Compress to keep the packed registers")
+	}
+	union, err := packed.Union(dense)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if _, ok := union.data.(*packedRegisters); !ok || !union.Equal(dense) {
+		t.Errorf("Expected Union to keep the packed registers of the receiver")
+	}
+}
+
+func TestSparseRegisters(t *testing.T) {
+	m := uint64(1000)
+	sparse := newSparseRegisters(m, 100)
+	dense := make(denseRegisters, m, m)
+	testRand.Seed(42)
+	for k := 0; k < 200; k++ {
+		i, v := uint64(testRand.Intn(int(m))), byte(testRand.Intn(64))
+		sparse.set(i, v)
+		dense.set(i, v)
+		for j := uint64(0); j < m; j++ {
+			if sparse.get(j) != dense.get(j) {
+				t.Fatalf("Expected register %d to be %d, got %d", j, dense.get(j), sparse.get(j))
+			}
+		}
+		nonZero := 0
+		for _, d := range dense {
+			if d != 0 {
+				nonZero++
+			}
+		}
+		if sparse.isSparse() != (nonZero <= 100) || (sparse.isSparse() && sparse.size() != nonZero) {
+			t.Fatalf("Expected sparse %v with %d entries, got %v with %d", nonZero <= 100, nonZero, sparse.isSparse(), sparse.size())
+		}
+		if !sparse.isSparse() {
+			break
+		}
+	}
+	if sparse.isSparse() {
+		t.Errorf("Expected the registers to convert to dense after more than 100 entries")
+	}
+	// zeroing a register removes its entry
+	zeroed := newSparseRegisters(m, 10)
+	zeroed.set(5, 3)
+	zeroed.set(5, 0)
+	zeroed.set(7, 0)
+	if zeroed.size() != 0 || zeroed.get(5) != 0 {
+		t.Errorf("Expected no entries after zeroing, got %d", zeroed.size())
+	}
+}
+
+func TestHyperLogLogSparse(t *testing.T) {
+	dense := NewHyperLogLog(10, fnv.New64())
+	sparse := NewHyperLogLogSparse(10, fnv.New64(), 0)
+	if !sparse.IsSparse() || sparse.SparseEntries() != 0 || dense.IsSparse() {
+		t.Errorf("Expected a new sparse HyperLogLog to be sparse with no entries")
+	}
+	var converted bool
+	for i := 0; i < N; i++ {
+		dense.Add(randomBytes[i])
+		sparse.Add(randomBytes[i])
+		if sparse.Distinct() != dense.Distinct() {
+			t.Fatalf("Expected the sparse HyperLogLog to estimate %d after %d items, got %d", dense.Distinct(), i+1, sparse.Distinct())
+		}
+		if sparse.IsSparse() && sparse.SparseEntries() > 1<<10/4 {
+			t.Fatalf("Expected at most %d sparse entries, got %d", 1<<10/4, sparse.SparseEntries())
+		}
+		if !sparse.IsSparse() && !converted {
+			converted = true
+			if i+1 <= 1<<10/4 {
+				t.Errorf("Expected the conversion after more than %d items, got %d", 1<<10/4, i+1)
+			}
+		}
+	}
+	if sparse.IsSparse() || sparse.SparseEntries() != 0 || !sparse.Equal(dense) {
+		t.Errorf("Expected the sparse HyperLogLog to convert to dense and equal the dense one")
+	}
+	// the threshold is kept by Compress and Union
+	small := NewHyperLogLogSparse(10, fnv.New64(), 16)
+	for i := 0; i < 8; i++ {
+		small.Add(randomBytes[i])
+	}
+	if !small.IsSparse() || small.SparseEntries() == 0 || small.SparseEntries() > 8 {
+		t.Errorf("Expected a sparse HyperLogLog with at most 8 entries, got sparse %v with %d", small.IsSparse(), small.SparseEntries())
+	}
+	// the full scans over only the non-zero entries agree with the dense registers
+	smallDense := NewHyperLogLog(10, fnv.New64())
+	for i := 0; i < 8; i++ {
+		smallDense.Add(randomBytes[i])
+	}
+	sparseBytes, _ := small.MarshalBinary()
+	denseBytes, _ := smallDense.MarshalBinary()
+	if !small.Equal(smallDense) || !smallDense.Equal(small) || string(sparseBytes) != string(denseBytes) ||
+		small.RegisterHistogram() != smallDense.RegisterHistogram() || small.RawEstimate() != smallDense.RawEstimate() {
+		t.Errorf("Expected the sparse registers to scan the same as the dense registers")
+	}
+	if intersect, err := small.Intersect(smallDense); err != nil || !intersect.IsSparse() || !intersect.Equal(small) {
+		t.Errorf("Expected the Intersect with the same items to keep the sparse registers, got %v", err)
+	}
+	compressed := small.Compress(2)
+	if !compressed.IsSparse() || !compressed.Equal(small.Compress(2)) {
+		t.Errorf("Expected Compress to keep the sparse registers")
+	}
+	union, err := small.Union(dense)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if union.IsSparse() || !union.Equal(dense) {
+		t.Errorf("Expected the Union with a full HyperLogLog to convert to dense")
+	}
+	small.Reset()
+	if !small.IsSparse() || small.SparseEntries() != 0 || small.Distinct() != 0 {
+		t.Errorf("Expected Reset to remove all the sparse entries, got %d", small.SparseEntries())
+	}
+}
+
+func BenchmarkHyperLogLogPackedP10Add(b *testing.B) {
+	hll := NewHyperLogLogPacked(10, fnv.New64())
+	for i := 0; i < b.N; i++ {
+		hll.Add(randomBytes[i&mask])
+	}
+}
+
+func BenchmarkHyperLogLogSparseP18Fill(b *testing.B) {
+	// add distinct items up to the default threshold of 2^18/4 where the sparse registers convert to dense
+	item := make([]byte, 8)
+	for i := 0; i < b.N; i++ {
+		hll := NewHyperLogLogSparse(18, fnv.New64(), 0)
+		for j := uint64(0); hll.IsSparse(); j++ {
+			binary.LittleEndian.PutUint64(item, j)
+			hll.Add(item)
+		}
+	}
+}
+
+func BenchmarkHyperLogLogSparseP18Distinct(b *testing.B) {
+	hll := NewHyperLogLogSparse(18, fnv.New64(), 0)
+	for i := 0; i < N; i++ {
+		hll.Add(randomBytes[i])
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		count = hll.Distinct()
+	}
+}
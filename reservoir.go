@@ -0,0 +1,60 @@
+package streamstats
+
+import "math/rand"
+
+// minimumReservoirK is the smallest number of values kept by a Reservoir
+const minimumReservoirK = 1
+
+// Reservoir keeps a uniform random sample of at most k values of a stream using Algorithm R
+// Random Sampling with a Reservoir, Jeffrey S. Vitter, ACM Transactions on Mathematical Software 11(1), 1985
+// after n values every value has been kept with equal probability k/n, it uses O(k) space
+type Reservoir struct {
+	k      int
+	n      uint64
+	values []float64
+	rand   *rand.Rand // the source of randomness, nil for the package level source of math/rand
+}
+
+// NewReservoir returns a pointer to a new empty Reservoir keeping at most k values, k is bounded below by 1
+// if r is nil the package level source of math/rand is used
+func NewReservoir(k int, r *rand.Rand) *Reservoir {
+	if k < minimumReservoirK {
+		k = minimumReservoirK
+	}
+	return &Reservoir{k: k, values: make([]float64, 0, k), rand: r}
+}
+
+// Add offers the value x to the sample, it is kept with probability k/n and replaces a random kept value
+func (r *Reservoir) Add(x float64) {
+	r.n++
+	if len(r.values) < r.k {
+		r.values = append(r.values, x)
+		return
+	}
+	if j := randInt63n(r.rand, int64(r.n)); j < int64(r.k) {
+		r.values[j] = x
+	}
+}
+
+// N returns the number of values seen so far
+func (r *Reservoir) N() uint64 {
+	return r.n
+}
+
+// K returns the maximum number of values kept
+func (r *Reservoir) K() int {
+	return r.k
+}
+
+// Values returns a copy of the values in the sample in no particular order
+func (r *Reservoir) Values() []float64 {
+	values := make([]float64, len(r.values))
+	copy(values, r.values)
+	return values
+}
+
+// Reset removes all values from the sample
+func (r *Reservoir) Reset() {
+	r.n = 0
+	r.values = r.values[:0]
+}
@@ -0,0 +1,53 @@
+package streamstats
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestReservoir(t *testing.T) {
+	r := NewReservoir(0, nil)
+	if r.K() != minimumReservoirK {
+		t.Errorf("Expected k bounded below by %d, got %d", minimumReservoirK, r.K())
+	}
+	r = NewReservoir(10, rand.New(rand.NewSource(42)))
+	for i := 0; i < 10; i++ {
+		r.Add(float64(i))
+	}
+	for i, v := range r.Values() {
+		if v != float64(i) {
+			t.Errorf("Expected the first k values to be kept, got %v at %d", v, i)
+		}
+	}
+	r.Reset()
+	if r.N() != 0 || len(r.Values()) != 0 {
+		t.Errorf("Expected Reset to empty the sample, got N %d with %d values", r.N(), len(r.Values()))
+	}
+}
+
+func TestReservoirUniformity(t *testing.T) {
+	k, n, trials := 10, 100, 2000
+	counts := make([]int, n)
+	source := rand.New(rand.NewSource(42))
+	for trial := 0; trial < trials; trial++ {
+		r := NewReservoir(k, source)
+		for i := 0; i < n; i++ {
+			r.Add(float64(i))
+		}
+		if r.N() != uint64(n) || len(r.Values()) != k {
+			t.Fatalf("Expected %d values of %d, got %d of %d", k, n, len(r.Values()), r.N())
+		}
+		for _, v := range r.Values() {
+			counts[int(v)]++
+		}
+	}
+	// every value is kept with probability k/n, the counts are binomial
+	expected := float64(trials*k) / float64(n)
+	sd := math.Sqrt(expected * (1.0 - float64(k)/float64(n)))
+	for i, c := range counts {
+		if math.Abs(float64(c)-expected) > 5*sd {
+			t.Errorf("Expected value %d kept about %0.0f times, got %d", i, expected, c)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package streamstats
+
+import (
+	"math/rand"
+	"sort"
+)
+
+// SampleQuantile estimates quantiles exactly over a uniform random sample of the stream kept by a Reservoir
+// it is exact while at most k values have been seen, and otherwise a reference for validating the P2 estimators
+// at the cost of O(k) space and sorting the sample, O(k log k), on the first Quantile after an Add
+type SampleQuantile struct {
+	reservoir *Reservoir
+	sorted    []float64 // the sorted sample, nil if values have been added since it was sorted
+}
+
+// NewSampleQuantile returns a pointer to a new SampleQuantile over a sample of at most k values
+// if r is nil the package level source of math/rand is used
+func NewSampleQuantile(k int, r *rand.Rand) *SampleQuantile {
+	return &SampleQuantile{reservoir: NewReservoir(k, r)}
+}
+
+// Add offers the value x to the sample
+func (s *SampleQuantile) Add(x float64) {
+	s.reservoir.Add(x)
+	s.sorted = nil
+}
+
+// N returns the number of values seen so far
+func (s *SampleQuantile) N() uint64 {
+	return s.reservoir.N()
+}
+
+// IsExact returns true if every value seen so far is in the sample so the quantiles are exact
+func (s *SampleQuantile) IsExact() bool {
+	return s.reservoir.N() <= uint64(s.reservoir.K())
+}
+
+// Quantile returns the p-quantile of the sample interpolating between the closest ranks like P2Quantile
+// with fewer than five observations, or 0 if no values have been seen
+// p is bounded by 0 and 1 for the minimum and maximum of the sample
+func (s *SampleQuantile) Quantile(p float64) float64 {
+	if s.sorted == nil {
+		s.sorted = s.reservoir.Values()
+		sort.Float64s(s.sorted)
+	}
+	return sortedQuantile(s.sorted, p)
+}
+
+// Reset removes all values from the sample
+func (s *SampleQuantile) Reset() {
+	s.reservoir.Reset()
+	s.sorted = nil
+}
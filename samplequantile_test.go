@@ -0,0 +1,76 @@
+package streamstats
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestSampleQuantileExact(t *testing.T) {
+	s := NewSampleQuantile(100, rand.New(rand.NewSource(42)))
+	if s.Quantile(0.5) != 0.0 {
+		t.Errorf("Expected 0 with no values, got %v", s.Quantile(0.5))
+	}
+	values := make([]float64, 100)
+	for i := range values {
+		values[i] = exponentialTestData[i]
+		s.Add(values[i])
+	}
+	if !s.IsExact() {
+		t.Errorf("Expected the quantiles to be exact while at most k values are seen")
+	}
+	sort.Float64s(values)
+	for _, p := range []float64{0.0, 0.1, 0.25, 0.5, 0.9, 1.0} {
+		if expected := sortedQuantile(values, p); s.Quantile(p) != expected {
+			t.Errorf("Expected exact %v-quantile %v, got %v", p, expected, s.Quantile(p))
+		}
+	}
+	s.Add(exponentialTestData[100])
+	if s.IsExact() {
+		t.Errorf("Expected the quantiles not to be exact after more than k values are seen")
+	}
+	s.Reset()
+	if s.N() != 0 || s.Quantile(0.5) != 0.0 {
+		t.Errorf("Expected Reset to empty the sample, got N %d", s.N())
+	}
+}
+
+func TestSampleQuantileBounds(t *testing.T) {
+	s := NewSampleQuantile(10, rand.New(rand.NewSource(42)))
+	s.Add(1.0)
+	s.Add(2.0)
+	for _, p := range []float64{-2.0, -0.5, math.Inf(-1), math.NaN()} {
+		if s.Quantile(p) != 1.0 {
+			t.Errorf("Expected the minimum 1 for p = %v, got %v", p, s.Quantile(p))
+		}
+	}
+	for _, p := range []float64{1.5, 3.0, math.Inf(1)} {
+		if s.Quantile(p) != 2.0 {
+			t.Errorf("Expected the maximum 2 for p = %v, got %v", p, s.Quantile(p))
+		}
+	}
+}
+
+func TestSampleQuantileVsP2Histogram(t *testing.T) {
+	s := NewSampleQuantile(4096, rand.New(rand.NewSource(42)))
+	h := NewP2Histogram(64)
+	for i := 0; i < N; i++ {
+		s.Add(gaussianTestData[i])
+		h.Add(gaussianTestData[i])
+	}
+	for _, tc := range []struct{ p, expected float64 }{
+		{0.1, -1.2816},
+		{0.25, -0.6745},
+		{0.5, 0.0},
+		{0.75, 0.6745},
+		{0.9, 1.2816},
+	} {
+		if actual := s.Quantile(tc.p); math.Abs(actual-tc.expected) > 0.1 {
+			t.Errorf("Expected %v-quantile %v, got %v", tc.p, tc.expected, actual)
+		}
+		if diff := math.Abs(s.Quantile(tc.p) - h.Quantile(tc.p)); diff > 0.1 {
+			t.Errorf("Expected P2Histogram %v-quantile %v near the sample %v", tc.p, h.Quantile(tc.p), s.Quantile(tc.p))
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package streamstats
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// FloatStream is any data structure that accepts a stream of float64 observations
+// e.g. MomentStats, P2Quantile, P2Histogram, EWMA or SampleQuantile
+type FloatStream interface {
+	Add(x float64)
+}
+
+// ScanFloats parses each token of the scanner as a float64 with strconv.ParseFloat and adds it to the stream
+// e.g. with bufio.ScanLines for a column of a file, surrounding whitespace and empty tokens are skipped
+// it returns the number of values added and stops at the first parse or read error
+func ScanFloats(scanner *bufio.Scanner, stream FloatStream) (uint64, error) {
+	var n, token uint64
+	for scanner.Scan() {
+		token++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		x, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return n, fmt.Errorf("Token %d is not a float: %w", token, err)
+		}
+		stream.Add(x)
+		n++
+	}
+	return n, scanner.Err()
+}
+
+// ScanMomentStats returns the MomentStats of the floats read from r separated by whitespace
+// with the stats of the values before the first parse or read error if there is one
+func ScanMomentStats(r io.Reader) (*MomentStats, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Split(bufio.ScanWords)
+	m := NewMomentStats()
+	_, err := ScanFloats(scanner, m)
+	return m, err
+}
@@ -0,0 +1,45 @@
+package streamstats
+
+import (
+	"bufio"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestScanFloats(t *testing.T) {
+	var text strings.Builder
+	expected := NewMomentStats()
+	for i := 0; i < 1000; i++ {
+		text.WriteString(strconv.FormatFloat(gaussianTestData[i], 'g', -1, 64))
+		text.WriteString("\r\n")
+		expected.Add(gaussianTestData[i])
+	}
+	text.WriteString("\n") // a trailing blank line is skipped
+	h := NewP2Histogram(16)
+	n, err := ScanFloats(bufio.NewScanner(strings.NewReader(text.String())), &h)
+	if err != nil || n != 1000 {
+		t.Fatalf("Expected 1000 values without error, got %d and %v", n, err)
+	}
+	m, err := ScanMomentStats(strings.NewReader(text.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Snapshot() != expected.Snapshot() {
+		t.Errorf("Expected scanned stats %s, got %s", expected, m)
+	}
+	if h.N() != 1000 {
+		t.Errorf("Expected 1000 values in the histogram, got %d", h.N())
+	}
+}
+
+func TestScanFloatsError(t *testing.T) {
+	m, err := ScanMomentStats(strings.NewReader("1.0 2.0 three 4.0"))
+	if err == nil || !errors.Is(err, strconv.ErrSyntax) {
+		t.Errorf("Expected a syntax error, got %v", err)
+	}
+	if m.N() != 2 || m.Mean() != 1.5 {
+		t.Errorf("Expected the stats of the values before the error, got %s", m)
+	}
+}
@@ -0,0 +1,96 @@
+package streamstats
+
+import (
+	"hash/fnv"
+	"testing"
+	"time"
+)
+
+func TestSlidingHyperLogLog(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	s := NewSlidingHyperLogLog(10, fnv.New64(), time.Hour)
+	if s.Window() != time.Hour || s.Distinct(start) != 0 {
+		t.Errorf("Expected an empty window of an hour, got %v and %d", s.Window(), s.Distinct(start))
+	}
+	all := NewHyperLogLog(10, fnv.New64())
+	recent := NewHyperLogLog(10, fnv.New64())
+	middle := start.Add(30 * time.Minute)
+	for i := 0; i < N; i++ {
+		at := start.Add(time.Duration(i) * time.Hour / N)
+		s.AddAt(randomBytes[i], at)
+		all.Add(randomBytes[i])
+		if !at.Before(middle) {
+			recent.Add(randomBytes[i])
+		}
+	}
+	// the registers of any window are exactly those of a HyperLogLog of the items in the window
+	if !s.Since(start).Equal(all) || s.Distinct(start) != all.Distinct() {
+		t.Errorf("Expected the whole window to equal a HyperLogLog of every item, got %d instead of %d", s.Distinct(start), all.Distinct())
+	}
+	if !s.Since(middle).Equal(recent) || s.Distinct(middle) != recent.Distinct() {
+		t.Errorf("Expected the last half hour to equal a HyperLogLog of its items, got %d instead of %d", s.Distinct(middle), recent.Distinct())
+	}
+	if relativeError(s.Distinct(middle), N/2) > 3.0*recent.ExpectedError() {
+		t.Errorf("Expected about %d distinct items in the last half hour, got %d", N/2, s.Distinct(middle))
+	}
+	if s.Distinct(start.Add(2*time.Hour)) != 0 {
+		t.Errorf("Expected no items after the latest, got %d", s.Distinct(start.Add(2*time.Hour)))
+	}
+	// the lists of future possible maxima are short
+	if s.Entries() < 1<<10 || s.Entries() > 1<<10*12 {
+		t.Errorf("Expected a few entries per bucket, got %d for %d buckets", s.Entries(), 1<<10)
+	}
+	// items older than the window before the latest item are dropped and their entries removed over time
+	later := start.Add(3 * time.Hour)
+	for i := 0; i < N; i++ {
+		s.AddAt(randomBytes[i], later)
+	}
+	s.AddAt(randomBytes[0], start)
+	if !s.Since(start).Equal(s.Since(later)) || s.Distinct(later) != all.Distinct() {
+		t.Errorf("Expected only the items at the latest time in the window")
+	}
+	// Since removes the expired entries so only one entry per non-zero bucket remains
+	nonZero := 0
+	for _, r := range s.Since(later).Registers() {
+		if r != 0 {
+			nonZero++
+		}
+	}
+	if s.Entries() != nonZero {
+		t.Errorf("Expected %d entries after the expired entries are removed, got %d", nonZero, s.Entries())
+	}
+	// an item that is not a future possible maximum does not allocate
+	if allocs := testing.AllocsPerRun(100, func() { s.AddAt(randomBytes[1], later) }); allocs != 0 {
+		t.Errorf("Expected no allocations adding an item already in the window, got %v", allocs)
+	}
+}
+
+func TestSlidingHyperLogLogOutOfOrder(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	inOrder := NewSlidingHyperLogLog(8, fnv.New64(), time.Hour)
+	shuffled := NewSlidingHyperLogLog(8, fnv.New64(), time.Hour)
+	at := func(i int) time.Time { return start.Add(time.Duration(i) * time.Second) }
+	for i := 0; i < 3000; i++ {
+		inOrder.AddAt(randomBytes[i], at(i))
+	}
+	testRand.Seed(42)
+	for _, i := range testRand.Perm(3000) {
+		shuffled.AddAt(randomBytes[i], at(i))
+	}
+	for _, since := range []int{0, 100, 1000, 2500, 2999} {
+		if !inOrder.Since(at(since)).Equal(shuffled.Since(at(since))) {
+			t.Errorf("Expected the same registers since %d regardless of the order added", since)
+		}
+	}
+	if inOrder.Entries() != shuffled.Entries() {
+		t.Errorf("Expected the same future possible maxima regardless of the order, got %d and %d", inOrder.Entries(), shuffled.Entries())
+	}
+}
+
+func BenchmarkSlidingHyperLogLogAddAt(b *testing.B) {
+	s := NewSlidingHyperLogLog(10, fnv.New64(), time.Minute)
+	start := time.Unix(1700000000, 0)
+	for i := 0; i < b.N; i++ {
+		s.AddAt(randomBytes[i&mask], start.Add(time.Duration(i)*time.Millisecond))
+	}
+}
@@ -14,6 +14,9 @@ const (
 	mask = N - 1
 )
 
+// testRand is the source of randomness for the tests, reseed it for deterministic testing
+var testRand = rand.New(rand.NewSource(42))
+
 var result float64
 var count32 uint32
 var count uint64
@@ -24,27 +27,27 @@ var randomBytes = [N][]byte{}
 var longRandomBytes = [N][]byte{}
 
 func TestMain(m *testing.M) {
-	rand.Seed(42)
+	testRand.Seed(42)
 	for i := 0; i < N; i++ {
 		gaussianTestData[i] = gaussianRandomVariable(0, 1)
 		exponentialTestData[i] = exponentialRandomVariable(1)
 		uniformTestData[i] = uniformRandomVariable(0, 1)
 		b := make([]byte, 8)
-		rand.Read(b)
+		testRand.Read(b)
 		randomBytes[i] = b
 		d := make([]byte, 29)
-		rand.Read(d)
+		testRand.Read(d)
 		longRandomBytes[i] = d
 	}
 	os.Exit(m.Run())
 }
 
 func gaussianRandomVariable(mean float64, stdev float64) float64 {
-	return mean + stdev*rand.NormFloat64()
+	return mean + stdev*testRand.NormFloat64()
 }
 
 func exponentialRandomVariable(lambda float64) float64 {
-	return rand.ExpFloat64() / lambda
+	return testRand.ExpFloat64() / lambda
 }
 
 func exponentialQuantile(p, lambda float64) float64 {
@@ -52,7 +55,7 @@ func exponentialQuantile(p, lambda float64) float64 {
 }
 
 func uniformRandomVariable(min, max float64) float64 {
-	return min + (max-min)*rand.Float64()
+	return min + (max-min)*testRand.Float64()
 }
 
 func uniformQuantile(p, min, max float64) float64 {
@@ -64,5 +67,5 @@ func cauchyQuantile(p, x0, gamma float64) float64 {
 }
 
 func cauchyRandomVariable(x0, gamma float64) float64 {
-	return cauchyQuantile(rand.Float64(), x0, gamma)
+	return cauchyQuantile(testRand.Float64(), x0, gamma)
 }
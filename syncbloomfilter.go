@@ -0,0 +1,88 @@
+package streamstats
+
+import (
+	"hash"
+	"sync"
+	"sync/atomic"
+)
+
+// SyncBloomFilter is a BloomFilter that is safe for concurrent Add and Check without locking
+// each call borrows its own hash function from a pool and sets the bits with an atomic OR of their words,
+// so concurrent Adds never lose a bit and a Check that happens after an Add of the same item always finds it
+type SyncBloomFilter struct {
+	hashes  sync.Pool // hash functions from newHash, a hash.Hash64 is not safe for concurrent use
+	newHash func() hash.Hash64
+	bits    BitVector // the underlying occupied buckets, only accessed atomically
+	k       uint64    // number of hash functions to calculate for each item
+	m       uint64    // size of the BloomFilter in bits
+}
+
+// NewSyncBloomFilter returns a pointer to a new SyncBloomFilter sized the same as NewBloomFilter
+// that creates hash functions with newHash as needed for concurrent calls
+func NewSyncBloomFilter(Nitems uint64, FalsePositiveRate float64, newHash func() hash.Hash64) *SyncBloomFilter {
+	m, k := bloomFilterSize(Nitems, FalsePositiveRate)
+	bf := &SyncBloomFilter{newHash: newHash, bits: NewBitVector(m), k: k, m: m}
+	bf.hashes.New = func() interface{} { return newHash() }
+	return bf
+}
+
+// sum64 returns the hash of the item using a hash function from the pool
+func (bf *SyncBloomFilter) sum64(item []byte) uint64 {
+	h := bf.hashes.Get().(hash.Hash64)
+	h.Reset()
+	h.Write(item)
+	sum := h.Sum64()
+	bf.hashes.Put(h)
+	return sum
+}
+
+// Add puts an item in the set represented by the SyncBloomFilter, it is safe to call concurrently
+func (bf *SyncBloomFilter) Add(item []byte) {
+	hash := bf.sum64(item)
+	h1 := hash & ((1 << 32) - 1) // take the bottom 32 bits as the first hash
+	h2 := hash >> 32             // take the top 32 bits as the second hash
+	bf.bits.SetAtomic(h1 & (bf.m - 1))
+	for i := uint64(1); i < bf.k; i++ {
+		h1 += h2 // generate the k hash functions as h_i = h1 + i * h2 mod m
+		bf.bits.SetAtomic(h1 & (bf.m - 1))
+	}
+}
+
+// Check returns false if an item in is definitely not in the set represented by the SyncBloomFilter
+// it is safe to call concurrently with Add
+func (bf *SyncBloomFilter) Check(item []byte) bool {
+	hash := bf.sum64(item)
+	h1 := hash & ((1 << 32) - 1) // take the bottom 32 bits as the first hash
+	h2 := hash >> 32             // take the top 32 bits as the second hash
+	if bf.bits.GetAtomic(h1&(bf.m-1)) != 1 {
+		return false
+	}
+	for i := uint64(1); i < bf.k; i++ {
+		h1 += h2 // generate the k hash functions as h_i = h1 + i * h2 mod m
+		if bf.bits.GetAtomic(h1&(bf.m-1)) != 1 {
+			return false
+		}
+	}
+	return true // all hash functions check out
+}
+
+// AddFloat64 puts a float64 value in the set represented by the SyncBloomFilter
+// with the same canonical -0.0 and NaN handling as BloomFilter.AddFloat64
+func (bf *SyncBloomFilter) AddFloat64(x float64) {
+	bf.Add(float64Bytes(x))
+}
+
+// CheckFloat64 returns false if a float64 value is definitely not in the set represented by the SyncBloomFilter
+func (bf *SyncBloomFilter) CheckFloat64(x float64) bool {
+	return bf.Check(float64Bytes(x))
+}
+
+// BloomFilter returns a copy of the SyncBloomFilter as a BloomFilter with a new hash function from newHash
+// e.g. for Distinct, Union or serialization, it includes every Add that happened before the call
+func (bf *SyncBloomFilter) BloomFilter() *BloomFilter {
+	bits := NewBitVector(bf.m)
+	for i := range bits {
+		bits[i] = atomic.LoadUint64(&bf.bits[i])
+	}
+	return &BloomFilter{hash: bf.newHash(), bits: bits, k: bf.k, m: bf.m}
+}
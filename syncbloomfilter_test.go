@@ -0,0 +1,75 @@
+package streamstats
+
+import (
+	"hash/fnv"
+	"sync"
+	"testing"
+)
+
+func TestSyncBloomFilter(t *testing.T) {
+	sbf := NewSyncBloomFilter(uint64(N), 0.01, fnv.New64)
+	expected := NewBloomFilter(uint64(N), 0.01, fnv.New64())
+	for i := 0; i < N/2; i++ {
+		expected.Add(randomBytes[i])
+	}
+	workers := 8
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < N/2; i += workers {
+				sbf.Add(randomBytes[i])
+				if !sbf.Check(randomBytes[i]) {
+					t.Errorf("Expected an added item to be found")
+				}
+				sbf.Check(randomBytes[N/2+i]) // concurrent checks of other items
+			}
+		}(w)
+	}
+	wg.Wait()
+	// no bit is lost to concurrent Adds so the bits are identical to adding sequentially
+	bf := sbf.BloomFilter()
+	if !bf.bits.Equal(expected.bits) || bf.Distinct() != expected.Distinct() {
+		t.Errorf("Expected concurrent Adds to set the same bits, got Distinct %d expected %d", bf.Distinct(), expected.Distinct())
+	}
+	if _, err := bf.Union(expected); err != nil {
+		t.Errorf("Expected the BloomFilter copy to be compatible, got %s", err)
+	}
+	sbf.AddFloat64(-0.0)
+	if !sbf.CheckFloat64(0.0) {
+		t.Errorf("Expected -0.0 and +0.0 to be the same value")
+	}
+}
+
+func BenchmarkSyncBloomFilterAdd(b *testing.B) {
+	sbf := NewSyncBloomFilter(10000, 0.03, fnv.New64)
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			sbf.Add(randomBytes[i&mask])
+			i++
+		}
+	})
+	if sbf.Check([]byte{}) {
+		count = 5
+	} // to avoid optimizing out the loop entirely
+}
+
+func BenchmarkSyncBloomFilterAddCheck(b *testing.B) {
+	sbf := NewSyncBloomFilter(10000, 0.03, fnv.New64)
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			if i&1 == 0 {
+				sbf.Add(randomBytes[i&mask])
+			} else {
+				sbf.Check(randomBytes[i&mask])
+			}
+			i++
+		}
+	})
+	if sbf.Check([]byte{}) {
+		count = 5
+	} // to avoid optimizing out the loop entirely
+}
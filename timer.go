@@ -0,0 +1,89 @@
+package streamstats
+
+import "time"
+
+// Timer is a data structure for latency instrumentation that records durations
+// in a P2Histogram for the distribution, a MomentStats for the mean and a Meter for the throughput
+type Timer struct {
+	now       func() time.Time // the clock used to time functions
+	histogram P2Histogram      // the distribution of the durations in nanoseconds
+	moments   MomentStats      // the moments of the durations in nanoseconds
+	meter     *Meter           // the rate of recorded durations
+}
+
+// TimerSnapshot is the distribution and throughput of the durations recorded by a Timer at a point in time
+// the percentiles are interpolated between the markers of the histogram, so the tail percentiles
+// are only as accurate as the resolution of the bins
+type TimerSnapshot struct {
+	Count    uint64
+	Min      time.Duration
+	Max      time.Duration
+	Mean     time.Duration
+	StdDev   time.Duration
+	P50      time.Duration
+	P75      time.Duration
+	P95      time.Duration
+	P99      time.Duration
+	Rate1    float64 // durations recorded per second with a 1 minute time constant
+	Rate5    float64 // durations recorded per second with a 5 minute time constant
+	Rate15   float64 // durations recorded per second with a 15 minute time constant
+	MeanRate float64 // durations recorded per second since the Timer was created
+}
+
+// NewTimer returns a new Timer tracking the distribution of durations with b bins using the system clock
+func NewTimer(b uint64) *Timer {
+	return NewTimerWithClock(b, time.Now)
+}
+
+// NewTimerWithClock returns a new Timer tracking the distribution of durations with b bins
+// that reads the current time from now, e.g. a fake clock in tests, a nil clock uses the system clock
+func NewTimerWithClock(b uint64, now func() time.Time) *Timer {
+	if now == nil {
+		now = time.Now
+	}
+	return &Timer{
+		now:       now,
+		histogram: NewP2Histogram(b),
+		meter:     NewMeterWithClock(now),
+	}
+}
+
+// Record adds a duration to the Timer
+func (t *Timer) Record(d time.Duration) {
+	x := float64(d)
+	t.histogram.Add(x)
+	t.moments.Add(x)
+	t.meter.Mark(1)
+}
+
+// Time calls f and records how long it took
+func (t *Timer) Time(f func()) {
+	start := t.now()
+	f()
+	t.Record(t.now().Sub(start))
+}
+
+// Snapshot returns the distribution and throughput of the durations recorded so far
+func (t *Timer) Snapshot() TimerSnapshot {
+	s := TimerSnapshot{
+		Count:    t.meter.Count(),
+		Rate1:    t.meter.Rate1(),
+		Rate5:    t.meter.Rate5(),
+		Rate15:   t.meter.Rate15(),
+		MeanRate: t.meter.MeanRate(),
+	}
+	if s.Count == 0 {
+		return s
+	}
+	s.Min = time.Duration(t.histogram.Min())
+	s.Max = time.Duration(t.histogram.Max())
+	s.Mean = time.Duration(t.moments.Mean())
+	if s.Count > 1 {
+		s.StdDev = time.Duration(t.moments.StdDev())
+	}
+	s.P50 = time.Duration(t.histogram.Quantile(0.5))
+	s.P75 = time.Duration(t.histogram.Quantile(0.75))
+	s.P95 = time.Duration(t.histogram.Quantile(0.95))
+	s.P99 = time.Duration(t.histogram.Quantile(0.99))
+	return s
+}
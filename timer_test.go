@@ -0,0 +1,52 @@
+package streamstats
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTimer(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)}
+	timer := NewTimerWithClock(20, clock.now)
+	if s := timer.Snapshot(); s.Count != 0 || s.P50 != 0 {
+		t.Errorf("Expected an empty snapshot, got %+v", s)
+	}
+	// uniform latencies between 0 and 100ms, one per second
+	for i := 0; i < N; i++ {
+		timer.Time(func() {
+			clock.advance(time.Duration(uniformTestData[i] * float64(100*time.Millisecond)))
+		})
+		clock.advance(time.Second)
+	}
+	s := timer.Snapshot()
+	if s.Count != uint64(N) {
+		t.Errorf("Expected Count %d, got %d", N, s.Count)
+	}
+	eps := 2 * time.Millisecond
+	for _, tc := range []struct {
+		name     string
+		expected time.Duration
+		actual   time.Duration
+	}{
+		{"P50", 50 * time.Millisecond, s.P50},
+		{"P75", 75 * time.Millisecond, s.P75},
+		{"P95", 95 * time.Millisecond, s.P95},
+		{"P99", 99 * time.Millisecond, s.P99},
+		{"Mean", 50 * time.Millisecond, s.Mean},
+		{"StdDev", time.Duration(float64(100*time.Millisecond) / math.Sqrt(12)), s.StdDev},
+		{"Min", 0, s.Min},
+		{"Max", 100 * time.Millisecond, s.Max},
+	} {
+		if d := tc.actual - tc.expected; d > eps || d < -eps {
+			t.Errorf("Expected %s %v, got %v", tc.name, tc.expected, tc.actual)
+		}
+	}
+	// just under one duration recorded per second
+	if s.Rate1 < 0.9 || s.Rate1 > 1.0 {
+		t.Errorf("Expected Rate1 near 1 per second, got %v", s.Rate1)
+	}
+	if s.MeanRate < 0.9 || s.MeanRate > 1.0 {
+		t.Errorf("Expected MeanRate near 1 per second, got %v", s.MeanRate)
+	}
+}
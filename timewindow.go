@@ -0,0 +1,114 @@
+package streamstats
+
+import "time"
+
+// Windowable is the constraint on the aggregators held by a TimeWindow
+// a pointer to the aggregator must Add observations and Combine with another aggregator of the same type
+// and the zero value of the aggregator must be an empty aggregator ready to use, e.g. MomentStats
+type Windowable[T any] interface {
+	*T
+	Add(float64)
+	Combine(*T) T
+}
+
+// TimeWindow is a datastructure for aggregating the observations of a stream over a sliding window of time
+// it holds a chain of per time bucket sub-aggregators that are merged on query, rotating out expired buckets
+type TimeWindow[T any, PT Windowable[T]] struct {
+	bucket     time.Duration // the duration of each bucket
+	aggregates []T           // ring buffer of the aggregate of each bucket
+	ids        []int64       // the id of the bucket held in each position of the ring buffer
+	counts     []uint64      // the number of observations in each bucket
+	latest     int64         // the id of the latest bucket with an observation
+	started    bool          // whether any observation has been pushed
+}
+
+// NewTimeWindow returns an empty TimeWindow that aggregates observations into buckets of the given duration
+// and retains the buckets covering at least the given retention, e.g. NewTimeWindow[MomentStats](time.Second, time.Minute)
+// the bucket duration is bounded below by 1ns and the retention by one bucket
+func NewTimeWindow[T any, PT Windowable[T]](bucket, retention time.Duration) *TimeWindow[T, PT] {
+	if bucket < 1 {
+		bucket = 1
+	}
+	n := int((retention + bucket - 1) / bucket) // the number of buckets rounded up to cover the retention
+	if n < 1 {
+		n = 1
+	}
+	return &TimeWindow[T, PT]{
+		bucket:     bucket,
+		aggregates: make([]T, n, n),
+		ids:        make([]int64, n, n),
+		counts:     make([]uint64, n, n),
+	}
+}
+
+// Push adds an observation x at time t to the bucket containing t
+// a bucket is reset when it is reused for a later time, observations older than the retention
+// relative to the latest observation are dropped
+func (w *TimeWindow[T, PT]) Push(x float64, t time.Time) {
+	id := w.bucketID(t)
+	if w.started && id <= w.latest-int64(len(w.ids)) {
+		return // expired
+	}
+	if !w.started || id > w.latest {
+		w.latest = id
+		w.started = true
+	}
+	i := w.position(id)
+	if w.ids[i] != id || w.counts[i] == 0 {
+		var empty T
+		w.aggregates[i] = empty
+		w.ids[i] = id
+		w.counts[i] = 0
+	}
+	PT(&w.aggregates[i]).Add(x)
+	w.counts[i]++
+}
+
+// Snapshot returns the combined aggregate of the buckets retained relative to the latest observation
+func (w *TimeWindow[T, PT]) Snapshot() T {
+	return w.snapshot(w.latest)
+}
+
+// SnapshotAt returns the combined aggregate of the buckets retained relative to the time t
+// e.g. the current time, so that buckets expire even when there are no new observations
+func (w *TimeWindow[T, PT]) SnapshotAt(t time.Time) T {
+	return w.snapshot(w.bucketID(t))
+}
+
+// snapshot combines the non-empty buckets in the retention ending with the bucket id
+// buckets after the given id are excluded
+func (w *TimeWindow[T, PT]) snapshot(id int64) T {
+	var combined T
+	empty := true
+	for i := range w.aggregates {
+		if w.counts[i] == 0 || w.ids[i] > id || w.ids[i] <= id-int64(len(w.ids)) {
+			continue // skip empty buckets since combining two empty aggregates may not be well defined
+		}
+		if empty {
+			combined = w.aggregates[i]
+			empty = false
+		} else {
+			combined = PT(&combined).Combine(&w.aggregates[i])
+		}
+	}
+	return combined
+}
+
+// bucketID returns the id of the bucket containing the time t
+func (w *TimeWindow[T, PT]) bucketID(t time.Time) int64 {
+	nanos := t.UnixNano()
+	id := nanos / int64(w.bucket)
+	if nanos < 0 && nanos%int64(w.bucket) != 0 {
+		id-- // round down for times before the epoch
+	}
+	return id
+}
+
+// position returns the position in the ring buffer of the bucket id
+func (w *TimeWindow[T, PT]) position(id int64) int {
+	i := id % int64(len(w.ids))
+	if i < 0 {
+		i += int64(len(w.ids))
+	}
+	return int(i)
+}
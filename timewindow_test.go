@@ -0,0 +1,68 @@
+package streamstats
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTimeWindow(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	w := NewTimeWindow[MomentStats](time.Second, 10*time.Second)
+	if len(w.aggregates) != 10 {
+		t.Errorf("Expected 10 buckets, got %d", len(w.aggregates))
+	}
+	empty := w.Snapshot()
+	if empty.N() != 0 {
+		t.Errorf("Expected an empty snapshot, got N %d", empty.N())
+	}
+	// ten observations per second for a minute, the value is the second
+	for s := 0; s < 60; s++ {
+		for i := 0; i < 10; i++ {
+			w.Push(float64(s), start.Add(time.Duration(s)*time.Second+time.Duration(i)*100*time.Millisecond))
+		}
+		snapshot := w.Snapshot()
+		retained := s + 1
+		if retained > 10 {
+			retained = 10
+		}
+		if snapshot.N() != uint64(10*retained) {
+			t.Errorf("Expected %d observations at second %d, got %d", 10*retained, s, snapshot.N())
+		}
+		expectedMean := float64(s) - float64(retained-1)/2.0
+		if math.Abs(snapshot.Mean()-expectedMean) > 1e-9 {
+			t.Errorf("Expected mean %f at second %d, got %f", expectedMean, s, snapshot.Mean())
+		}
+	}
+	// an observation older than the retention is dropped
+	w.Push(1000.0, start)
+	if snapshot := w.Snapshot(); snapshot.N() != 100 || snapshot.Mean() != 54.5 {
+		t.Errorf("Expected an expired observation to be dropped, got N %d mean %f", snapshot.N(), snapshot.Mean())
+	}
+	// buckets expire relative to the given time without new observations
+	later := w.SnapshotAt(start.Add(65 * time.Second))
+	if later.N() != 40 || later.Mean() != 57.5 {
+		t.Errorf("Expected the last 4 seconds to be retained, got N %d mean %f", later.N(), later.Mean())
+	}
+	if expired := w.SnapshotAt(start.Add(2 * time.Minute)); expired.N() != 0 {
+		t.Errorf("Expected all buckets to expire, got N %d", expired.N())
+	}
+	// a gap longer than the retention resets the reused buckets
+	w.Push(-1.0, start.Add(5*time.Minute))
+	if snapshot := w.Snapshot(); snapshot.N() != 1 || snapshot.Mean() != -1.0 {
+		t.Errorf("Expected only the observation after the gap, got N %d mean %f", snapshot.N(), snapshot.Mean())
+	}
+}
+
+func TestTimeWindowBeforeEpoch(t *testing.T) {
+	w := NewTimeWindow[MomentStats](time.Second, 0)
+	if len(w.aggregates) != 1 {
+		t.Errorf("Expected the retention to be at least one bucket, got %d", len(w.aggregates))
+	}
+	before := time.Unix(-10, 500)
+	w.Push(1.0, before)
+	w.Push(3.0, before.Add(time.Millisecond))
+	if snapshot := w.Snapshot(); snapshot.N() != 2 || snapshot.Mean() != 2.0 {
+		t.Errorf("Expected both observations in the same bucket before the epoch, got N %d mean %f", snapshot.N(), snapshot.Mean())
+	}
+}
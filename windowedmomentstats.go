@@ -0,0 +1,93 @@
+package streamstats
+
+import "fmt"
+
+// WindowedMomentStats is a datastructure for computing the first four moments of the most recent
+// window observations of a stream, the exact-window complement to EWMA
+type WindowedMomentStats struct {
+	stats  MomentStats // the moments of the observations in the window
+	values []float64   // ring buffer of the observations in the window
+	next   int         // the position in the ring buffer of the next observation
+}
+
+// NewWindowedMomentStats returns an empty WindowedMomentStats over the last window observations
+// window is bounded below by 1, memory use is O(window)
+func NewWindowedMomentStats(window int) *WindowedMomentStats {
+	if window < 1 {
+		window = 1
+	}
+	return &WindowedMomentStats{values: make([]float64, 0, window)}
+}
+
+// Add updates the moment stats with a new observation evicting the oldest observation once the window is full
+// the new observation is added and the evicted observation removed with the inverse update in O(1)
+// to bound the accumulated rounding error the moments are recomputed from the window once per window
+// observations, so the amortized cost is still O(1)
+func (w *WindowedMomentStats) Add(x float64) {
+	if len(w.values) < cap(w.values) {
+		w.values = append(w.values, x)
+		w.stats.Add(x)
+		return
+	}
+	w.stats.RemoveValue(w.values[w.next])
+	w.stats.Add(x)
+	w.values[w.next] = x
+	w.next++
+	if w.next == len(w.values) {
+		w.next = 0
+		w.recompute()
+	}
+}
+
+// recompute recalculates the moments from the observations in the window
+func (w *WindowedMomentStats) recompute() {
+	w.stats = MomentStats{}
+	for _, x := range w.values {
+		w.stats.Add(x)
+	}
+}
+
+// Window returns the maximum number of observations in the window
+func (w *WindowedMomentStats) Window() int {
+	return cap(w.values)
+}
+
+// N returns the number of observations in the window
+func (w *WindowedMomentStats) N() uint64 {
+	return w.stats.N()
+}
+
+// Mean returns the mean of the observations in the window
+func (w *WindowedMomentStats) Mean() float64 {
+	return w.stats.Mean()
+}
+
+// Variance returns the variance of the observations in the window
+func (w *WindowedMomentStats) Variance() float64 {
+	return w.stats.Variance()
+}
+
+// StdDev returns the standard deviation of the observations in the window
+func (w *WindowedMomentStats) StdDev() float64 {
+	return w.stats.StdDev()
+}
+
+// Skewness returns the skewness of the observations in the window
+func (w *WindowedMomentStats) Skewness() float64 {
+	return w.stats.Skewness()
+}
+
+// Kurtosis returns the excess kurtosis of the observations in the window
+func (w *WindowedMomentStats) Kurtosis() float64 {
+	return w.stats.Kurtosis()
+}
+
+// MomentStats returns a copy of the moment stats of the observations in the window
+func (w *WindowedMomentStats) MomentStats() MomentStats {
+	return w.stats
+}
+
+// String returns the standard string representation of the observations in the window
+func (w *WindowedMomentStats) String() string {
+	return fmt.Sprintf("Mean: %0.3f Variance: %0.3f Skewness: %0.3f Kurtosis: %0.3f N: %d Window: %d", w.Mean(), w.Variance(), w.Skewness(), w.Kurtosis(), w.N(), w.Window())
+}
@@ -0,0 +1,64 @@
+package streamstats
+
+import (
+	"math"
+	"testing"
+)
+
+func TestWindowedMomentStats(t *testing.T) {
+	window := 100
+	w := NewWindowedMomentStats(window)
+	if w.Window() != window {
+		t.Errorf("Expected window %d, got %d", window, w.Window())
+	}
+	for i := 0; i < 1000; i++ {
+		// shift the mean partway through so stale observations would bias the moments
+		x := exponentialTestData[i]
+		if i > 500 {
+			x += 10.0
+		}
+		w.Add(x)
+		start := i + 1 - window
+		if start < 0 {
+			start = 0
+		}
+		exact := NewMomentStats()
+		for j := start; j <= i; j++ {
+			y := exponentialTestData[j]
+			if j > 500 {
+				y += 10.0
+			}
+			exact.Add(y)
+		}
+		if w.N() != exact.N() {
+			t.Fatalf("Expected N %d after %d observations, got %d", exact.N(), i+1, w.N())
+		}
+		eps := 1e-9
+		if math.Abs(w.Mean()-exact.Mean()) > eps {
+			t.Errorf("Expected Mean %f after %d observations, got %f", exact.Mean(), i+1, w.Mean())
+		}
+		if math.Abs(w.Variance()-exact.Variance()) > eps*math.Max(1.0, exact.Variance()) {
+			t.Errorf("Expected Variance %f after %d observations, got %f", exact.Variance(), i+1, w.Variance())
+		}
+		if math.Abs(w.Skewness()-exact.Skewness()) > 1e-6 {
+			t.Errorf("Expected Skewness %f after %d observations, got %f", exact.Skewness(), i+1, w.Skewness())
+		}
+		if math.Abs(w.Kurtosis()-exact.Kurtosis()) > 1e-6 {
+			t.Errorf("Expected Kurtosis %f after %d observations, got %f", exact.Kurtosis(), i+1, w.Kurtosis())
+		}
+	}
+	// a window of one only holds the latest observation
+	w = NewWindowedMomentStats(0)
+	w.Add(1.0)
+	w.Add(2.0)
+	if w.Window() != 1 || w.N() != 1 || w.Mean() != 2.0 {
+		t.Errorf("Expected a window of one holding the last observation 2.0, got window %d N %d mean %f", w.Window(), w.N(), w.Mean())
+	}
+}
+
+func BenchmarkWindowedMomentStatsAdd(b *testing.B) {
+	w := NewWindowedMomentStats(1000)
+	for i := 0; i < b.N; i++ {
+		w.Add(gaussianTestData[i&mask])
+	}
+}